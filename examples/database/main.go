@@ -186,8 +186,9 @@ func seedData() {
 		{"name": "Alice Brown", "email": "alice@example.com", "status": "active"},
 		{"name": "Charlie Davis", "email": "charlie@example.com", "status": "pending"},
 	}
-	for _, u := range users {
-		db.Table("users").Insert(u)
+	if err := db.Table("users").InsertBatch(users, 100); err != nil {
+		log.Printf("Seeding users failed: %v", err)
+		return
 	}
 
 	// Seed products
@@ -198,8 +199,9 @@ func seedData() {
 		{"name": "Monitor", "price": 3500000, "stock": 15},
 		{"name": "Headphone", "price": 500000, "stock": 25},
 	}
-	for _, p := range products {
-		db.Table("products").Insert(p)
+	if err := db.Table("products").InsertBatch(products, 100); err != nil {
+		log.Printf("Seeding products failed: %v", err)
+		return
 	}
 
 	// Seed orders
@@ -210,8 +212,9 @@ func seedData() {
 		{"user_id": 3, "product_id": 4, "quantity": 1, "total": 3500000},
 		{"user_id": 4, "product_id": 5, "quantity": 3, "total": 1500000},
 	}
-	for _, o := range orders {
-		db.Table("orders").Insert(o)
+	if err := db.Table("orders").InsertBatch(orders, 100); err != nil {
+		log.Printf("Seeding orders failed: %v", err)
+		return
 	}
 
 	log.Println("Sample data seeded successfully!")
@@ -93,7 +93,10 @@ func (p *Product) Data() {
 	if length <= 0 {
 		length = 10
 	}
-	if orderDir == "" {
+	if start < 0 {
+		start = 0
+	}
+	if orderDir = strings.ToLower(orderDir); orderDir != "desc" {
 		orderDir = "asc"
 	}
 
@@ -111,24 +114,27 @@ func (p *Product) Data() {
 	}
 
 	var products []models.Product
-	var totalRecords int64
-	var filteredRecords int64
 
 	// Total records
-	totalRecords, _ = database.Table("products").Count()
+	totalRecords, _ := database.For(p.Ctx).Table("products").Count()
 
 	// Filtered query
-	query := database.Table("products")
+	query := database.For(p.Ctx).Table("products")
 	if search != "" {
 		query = query.Where("name", "LIKE", "%"+search+"%")
 	}
 
-	filteredRecords, _ = query.Count()
-
-	query.OrderBy(orderColumn, orderDir).
-		Offset(start).
-		Limit(length).
-		Get(&products)
+	// DataTables' start needn't be a multiple of length, so page by
+	// offset rather than by page number.
+	query = query.OrderBy(orderColumn, orderDir)
+	filteredRecords, err := query.Count()
+	if err == nil {
+		err = query.Offset(start).Limit(length).Get(&products)
+	}
+	if err != nil {
+		p.Ctx.JSON(http.StatusInternalServerError, core.Map{"error": "Gagal memuat data product"})
+		return
+	}
 
 	response := DataTablesResponse{
 		Draw:            draw,
@@ -225,7 +231,7 @@ func (p *Product) Store() {
 	}
 
 	now := time.Now()
-	database.Table("products").Insert(map[string]any{
+	database.For(p.Ctx).Table("products").Insert(map[string]any{
 		"name":       name,
 		"price":      price,
 		"stock":      stock,
@@ -247,7 +253,7 @@ func (p *Product) Edit() {
 
 	id := p.Ctx.Param("id")
 	var product models.Product
-	err := database.Table("products").Where("id", id).First(&product)
+	err := database.For(p.Ctx).Table("products").Where("id", id).First(&product)
 	if err != nil {
 		libs.SetFlash(p.Ctx, "error", "Product tidak ditemukan")
 		p.Ctx.Redirect(http.StatusSeeOther, "/admin/product/index")
@@ -280,7 +286,7 @@ func (p *Product) Update() {
 
 	id := p.Ctx.Param("id")
 	var product models.Product
-	err := database.Table("products").Where("id", id).First(&product)
+	err := database.For(p.Ctx).Table("products").Where("id", id).First(&product)
 	if err != nil {
 		libs.SetFlash(p.Ctx, "error", "Product tidak ditemukan")
 		p.Ctx.Redirect(http.StatusSeeOther, "/admin/product/index")
@@ -357,7 +363,7 @@ func (p *Product) Update() {
 		return
 	}
 
-	database.Table("products").Where("id", id).Update(map[string]any{
+	database.For(p.Ctx).Table("products").Where("id", id).Update(map[string]any{
 		"name":       name,
 		"price":      price,
 		"stock":      stock,
@@ -380,14 +386,14 @@ func (p *Product) Delete() {
 
 	// Get product to delete image
 	var product models.Product
-	database.Table("products").Where("id", id).First(&product)
+	database.For(p.Ctx).Table("products").Where("id", id).First(&product)
 
 	// Delete image files
 	if product.Image != "" {
 		deleteProductImage(product.Image)
 	}
 
-	err := database.Table("products").Where("id", id).Delete()
+	err := database.For(p.Ctx).Table("products").Where("id", id).Delete()
 	if err != nil {
 		p.Ctx.JSON(http.StatusInternalServerError, core.Map{"error": "Gagal menghapus product"})
 		return
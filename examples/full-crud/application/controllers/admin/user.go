@@ -52,11 +52,11 @@ func (u *User) Index() {
 	}
 
 	var users []models.User
-	database.Table("users").OrderBy("id", "desc").Get(&users)
+	database.For(u.Ctx).Table("users").OrderBy("id", "desc").Get(&users)
 
 	// Load groups for each user
 	for i := range users {
-		loadUserGroupsAdmin(&users[i])
+		loadUserGroupsAdmin(u.Ctx, &users[i])
 	}
 
 	data := core.Map{
@@ -118,7 +118,7 @@ func (u *User) Store() {
 
 	// Check if email already exists
 	var existingUser models.User
-	err := database.Table("users").Where("email", email).First(&existingUser)
+	err := database.For(u.Ctx).Table("users").Where("email", email).First(&existingUser)
 	if err == nil {
 		errors["Email"] = "Email sudah terdaftar"
 	}
@@ -154,7 +154,7 @@ func (u *User) Store() {
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 
 	now := time.Now().Unix()
-	userID, err := database.Table("users").InsertGetId(map[string]any{
+	userID, err := database.For(u.Ctx).Table("users").InsertGetId(map[string]any{
 		"email":      email,
 		"password":   string(hashedPassword),
 		"first_name": firstName,
@@ -185,10 +185,10 @@ func (u *User) Store() {
 
 	// Get members group ID
 	var membersGroupID int64
-	database.Table("groups").Where("name", "members").Select("id").First(&membersGroupID)
+	database.For(u.Ctx).Table("groups").Where("name", "members").Select("id").First(&membersGroupID)
 
 	// Assign to members group
-	database.Table("users_groups").Insert(map[string]any{
+	database.For(u.Ctx).Table("users_groups").Insert(map[string]any{
 		"user_id":  userID,
 		"group_id": membersGroupID,
 	})
@@ -212,7 +212,7 @@ func (u *User) Edit() {
 
 	id := u.Ctx.Param("id")
 	var user models.User
-	err := database.Table("users").Where("id", id).First(&user)
+	err := database.For(u.Ctx).Table("users").Where("id", id).First(&user)
 	if err != nil {
 		libs.SetFlash(u.Ctx, "error", "User tidak ditemukan")
 		u.Ctx.Redirect(http.StatusSeeOther, "/admin/user/index")
@@ -220,7 +220,7 @@ func (u *User) Edit() {
 	}
 
 	// Load groups
-	loadUserGroupsAdmin(&user)
+	loadUserGroupsAdmin(u.Ctx, &user)
 
 	data := core.Map{
 		"Title": "Edit User",
@@ -249,7 +249,7 @@ func (u *User) Update() {
 
 	id := u.Ctx.Param("id")
 	var user models.User
-	err := database.Table("users").Where("id", id).First(&user)
+	err := database.For(u.Ctx).Table("users").Where("id", id).First(&user)
 	if err != nil {
 		libs.SetFlash(u.Ctx, "error", "User tidak ditemukan")
 		u.Ctx.Redirect(http.StatusSeeOther, "/admin/user/index")
@@ -271,7 +271,7 @@ func (u *User) Update() {
 
 	// Check if email already exists (other user)
 	var existingUser models.User
-	err = database.Table("users").Where("email", email).Where("id !=", id).First(&existingUser)
+	err = database.For(u.Ctx).Table("users").Where("email", email).Where("id", "!=", id).First(&existingUser)
 	if err == nil {
 		errors["Email"] = "Email sudah digunakan user lain"
 	}
@@ -316,7 +316,7 @@ func (u *User) Update() {
 		updateData["password"] = string(hashedPassword)
 	}
 
-	database.Table("users").Where("id", id).Update(updateData)
+	database.For(u.Ctx).Table("users").Where("id", id).Update(updateData)
 
 	libs.SetFlash(u.Ctx, "success", "User berhasil diupdate")
 	u.Ctx.Redirect(http.StatusSeeOther, "/admin/user/index")
@@ -339,10 +339,10 @@ func (u *User) Delete() {
 	}
 
 	// Delete from users_groups first
-	database.Table("users_groups").Where("user_id", id).Delete()
+	database.For(u.Ctx).Table("users_groups").Where("user_id", id).Delete()
 
 	// Delete user
-	err := database.Table("users").Where("id", id).Delete()
+	err := database.For(u.Ctx).Table("users").Where("id", id).Delete()
 	if err != nil {
 		u.Ctx.JSON(http.StatusInternalServerError, core.Map{"error": "Gagal menghapus user"})
 		return
@@ -361,7 +361,7 @@ func (u *User) Activate() {
 	id := u.Ctx.Param("id")
 
 	var user models.User
-	err := database.Table("users").Where("id", id).First(&user)
+	err := database.For(u.Ctx).Table("users").Where("id", id).First(&user)
 	if err != nil {
 		u.Ctx.JSON(http.StatusNotFound, core.Map{"error": "User tidak ditemukan"})
 		return
@@ -369,7 +369,7 @@ func (u *User) Activate() {
 
 	// Toggle active status
 	newStatus := !user.Active
-	database.Table("users").Where("id", id).Update(map[string]any{
+	database.For(u.Ctx).Table("users").Where("id", id).Update(map[string]any{
 		"active": newStatus,
 	})
 
@@ -385,9 +385,9 @@ func (u *User) Activate() {
 }
 
 // Helper functions
-func loadUserGroupsAdmin(user *models.User) {
+func loadUserGroupsAdmin(c *core.Context, user *models.User) {
 	var groups []models.Group
-	database.Query(`
+	database.For(c).Query(`
 		SELECT g.id, g.name, g.description
 		FROM groups g
 		INNER JOIN users_groups ug ON g.id = ug.group_id
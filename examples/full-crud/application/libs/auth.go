@@ -65,7 +65,7 @@ func Login(identity, password, ipAddress string) (*models.User, error) {
 	}
 
 	// Load user groups
-	loadUserGroups(&user)
+	loadUserGroups(database.Default(), &user)
 
 	// Update last login
 	now := time.Now().Unix()
@@ -259,13 +259,14 @@ func GetSession(c *core.Context) *models.User {
 		return nil
 	}
 
+	db := database.For(c)
 	var user models.User
-	err = database.Table("users").Where("id", sessionData.UserID).First(&user)
+	err = db.Table("users").Where("id", sessionData.UserID).First(&user)
 	if err != nil {
 		return nil
 	}
 
-	loadUserGroups(&user)
+	loadUserGroups(db, &user)
 	return &user
 }
 
@@ -329,15 +330,15 @@ func ValidateJWT(tokenString string) (*models.User, error) {
 		return nil, ErrUserNotFound
 	}
 
-	loadUserGroups(&user)
+	loadUserGroups(database.Default(), &user)
 	return &user, nil
 }
 
 // --- Helper Functions ---
 
-func loadUserGroups(user *models.User) {
+func loadUserGroups(db *database.DB, user *models.User) {
 	var groups []models.Group
-	database.Query(`
+	db.Query(`
 		SELECT g.id, g.name, g.description
 		FROM groups g
 		INNER JOIN users_groups ug ON g.id = ug.group_id
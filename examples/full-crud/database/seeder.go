@@ -111,27 +111,17 @@ func runMigrations(db *database.DB) {
 }
 
 func seedGroups(db *database.DB) {
-	groups := []struct {
-		Name        string
-		Description string
-	}{
-		{"admin", "Administrator"},
-		{"members", "General User"},
+	groups := []map[string]any{
+		{"name": "admin", "description": "Administrator"},
+		{"name": "members", "description": "General User"},
 	}
 
-	for _, g := range groups {
-		// Check if exists
-		var count int64
-		db.Query("SELECT COUNT(*) FROM groups WHERE name = ?", g.Name).Get(&count)
-		if count == 0 {
-			_, err := db.Exec("INSERT INTO groups (name, description) VALUES (?, ?)", g.Name, g.Description)
-			if err != nil {
-				log.Printf("Error creating group %s: %v\n", g.Name, err)
-			} else {
-				log.Printf("Created group: %s\n", g.Name)
-			}
-		}
+	// Existing groups are left unchanged
+	if err := db.Table("groups").Upsert(groups, []string{"name"}, nil); err != nil {
+		log.Printf("Error creating groups: %v\n", err)
+		return
 	}
+	log.Println("Seeded groups: admin, members")
 }
 
 func seedAdminUser(db *database.DB) {
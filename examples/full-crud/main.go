@@ -59,6 +59,7 @@ func main() {
 	// Global middleware
 	app.Use(middleware.Logger())
 	app.Use(middleware.Recovery())
+	app.Use(middleware.CSRF())
 
 	// Static files
 	app.Static("/static/", "./public")
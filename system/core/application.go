@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"io"
@@ -11,14 +12,26 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template/parse"
+	"time"
 )
 
 // Application is the main framework instance.
 type Application struct {
-	router      *Router
-	middlewares []Middleware
-	groups      []*Group
-	renderer    *TemplateEngine
+	router       *Router
+	pre          []Middleware
+	middlewares  []Middleware
+	groups       []*Group
+	renderer     *TemplateEngine
+	errorHandler ErrorHandler
+	env          string
+	health       *Health
+	autoOptions  bool
+
+	serverMu     sync.Mutex
+	server       *http.Server
+	shuttingDown atomic.Bool
 }
 
 // Group represents a route group with shared prefix and middleware.
@@ -33,39 +46,46 @@ func (app *Application) Use(middlewares ...Middleware) {
 	app.middlewares = append(app.middlewares, middlewares...)
 }
 
+// Pre adds middleware that runs before routing, for every request.
+// It may rewrite the request method or path, which is then used to pick
+// the route. c.Route() and c.Param() are not yet available to it.
+func (app *Application) Pre(middlewares ...Middleware) {
+	app.pre = append(app.pre, middlewares...)
+}
+
 // GET registers a GET route.
 func (app *Application) GET(pattern string, handler HandlerFunc) {
-	app.router.Add(http.MethodGet, pattern, handler)
+	app.add(http.MethodGet, pattern, handler, nil)
 }
 
 // POST registers a POST route.
 func (app *Application) POST(pattern string, handler HandlerFunc) {
-	app.router.Add(http.MethodPost, pattern, handler)
+	app.add(http.MethodPost, pattern, handler, nil)
 }
 
 // PUT registers a PUT route.
 func (app *Application) PUT(pattern string, handler HandlerFunc) {
-	app.router.Add(http.MethodPut, pattern, handler)
+	app.add(http.MethodPut, pattern, handler, nil)
 }
 
 // DELETE registers a DELETE route.
 func (app *Application) DELETE(pattern string, handler HandlerFunc) {
-	app.router.Add(http.MethodDelete, pattern, handler)
+	app.add(http.MethodDelete, pattern, handler, nil)
 }
 
 // PATCH registers a PATCH route.
 func (app *Application) PATCH(pattern string, handler HandlerFunc) {
-	app.router.Add(http.MethodPatch, pattern, handler)
+	app.add(http.MethodPatch, pattern, handler, nil)
 }
 
 // OPTIONS registers an OPTIONS route.
 func (app *Application) OPTIONS(pattern string, handler HandlerFunc) {
-	app.router.Add(http.MethodOptions, pattern, handler)
+	app.add(http.MethodOptions, pattern, handler, nil)
 }
 
 // HEAD registers a HEAD route.
 func (app *Application) HEAD(pattern string, handler HandlerFunc) {
-	app.router.Add(http.MethodHead, pattern, handler)
+	app.add(http.MethodHead, pattern, handler, nil)
 }
 
 // Group creates a new route group with the given prefix and middleware.
@@ -81,51 +101,37 @@ func (app *Application) Group(prefix string, middlewares ...Middleware) *Group {
 
 // GET registers a GET route in the group.
 func (g *Group) GET(pattern string, handler HandlerFunc) {
-	fullPath := path.Join(g.prefix, pattern)
-	wrapped := g.wrapHandler(handler)
-	g.app.router.Add(http.MethodGet, fullPath, wrapped)
+	g.app.add(http.MethodGet, path.Join(g.prefix, pattern), handler, g.middlewares)
 }
 
 // POST registers a POST route in the group.
 func (g *Group) POST(pattern string, handler HandlerFunc) {
-	fullPath := path.Join(g.prefix, pattern)
-	wrapped := g.wrapHandler(handler)
-	g.app.router.Add(http.MethodPost, fullPath, wrapped)
+	g.app.add(http.MethodPost, path.Join(g.prefix, pattern), handler, g.middlewares)
 }
 
 // PUT registers a PUT route in the group.
 func (g *Group) PUT(pattern string, handler HandlerFunc) {
-	fullPath := path.Join(g.prefix, pattern)
-	wrapped := g.wrapHandler(handler)
-	g.app.router.Add(http.MethodPut, fullPath, wrapped)
+	g.app.add(http.MethodPut, path.Join(g.prefix, pattern), handler, g.middlewares)
 }
 
 // DELETE registers a DELETE route in the group.
 func (g *Group) DELETE(pattern string, handler HandlerFunc) {
-	fullPath := path.Join(g.prefix, pattern)
-	wrapped := g.wrapHandler(handler)
-	g.app.router.Add(http.MethodDelete, fullPath, wrapped)
+	g.app.add(http.MethodDelete, path.Join(g.prefix, pattern), handler, g.middlewares)
 }
 
 // PATCH registers a PATCH route in the group.
 func (g *Group) PATCH(pattern string, handler HandlerFunc) {
-	fullPath := path.Join(g.prefix, pattern)
-	wrapped := g.wrapHandler(handler)
-	g.app.router.Add(http.MethodPatch, fullPath, wrapped)
+	g.app.add(http.MethodPatch, path.Join(g.prefix, pattern), handler, g.middlewares)
 }
 
 // OPTIONS registers an OPTIONS route in the group.
 func (g *Group) OPTIONS(pattern string, handler HandlerFunc) {
-	fullPath := path.Join(g.prefix, pattern)
-	wrapped := g.wrapHandler(handler)
-	g.app.router.Add(http.MethodOptions, fullPath, wrapped)
+	g.app.add(http.MethodOptions, path.Join(g.prefix, pattern), handler, g.middlewares)
 }
 
 // HEAD registers a HEAD route in the group.
 func (g *Group) HEAD(pattern string, handler HandlerFunc) {
-	fullPath := path.Join(g.prefix, pattern)
-	wrapped := g.wrapHandler(handler)
-	g.app.router.Add(http.MethodHead, fullPath, wrapped)
+	g.app.add(http.MethodHead, path.Join(g.prefix, pattern), handler, g.middlewares)
 }
 
 // Group creates a nested group.
@@ -137,9 +143,33 @@ func (g *Group) Group(prefix string, middlewares ...Middleware) *Group {
 	}
 }
 
-// wrapHandler wraps handler with group middleware.
-func (g *Group) wrapHandler(handler HandlerFunc) HandlerFunc {
-	return applyMiddleware(handler, g.middlewares...)
+// add registers handler wrapped with the route's middleware. Patterns
+// without an explicit OPTIONS route also get an OPTIONS route through the
+// same middleware, so e.g. a group's CORS policy can handle preflight
+// requests; see SetAutoOptions for what it answers otherwise.
+func (app *Application) add(method, pattern string, handler HandlerFunc, middlewares []Middleware) {
+	app.router.add(method, pattern, applyMiddleware(handler, middlewares...), middlewares)
+	if method != http.MethodOptions {
+		app.router.addAutoOptions(pattern, applyMiddleware(autoOptions, middlewares...), middlewares)
+	}
+}
+
+// SetAutoOptions makes routes without an OPTIONS handler answer OPTIONS
+// requests with 204 and an Allow header listing their methods. By default
+// they answer 404 as unknown routes do, unless their middleware, such as
+// CORS for preflight requests, answers first.
+func (app *Application) SetAutoOptions(enabled bool) {
+	app.autoOptions = enabled
+}
+
+// autoOptions answers OPTIONS for routes that don't define it.
+func autoOptions(c *Context) error {
+	if !c.app.autoOptions {
+		http.NotFound(c.Response, c.Request)
+		return nil
+	}
+	c.SetHeader("Allow", c.app.router.allow(c.route))
+	return c.NoContent(http.StatusNoContent)
 }
 
 // Static serves static files from the given directory.
@@ -156,7 +186,7 @@ func (app *Application) Static(prefix, root string) {
 		return nil
 	}
 
-	app.router.Add(http.MethodGet, pattern, handler)
+	app.add(http.MethodGet, pattern, handler, nil)
 }
 
 // AutoRoute registers routes for all controllers in the registry.
@@ -169,25 +199,93 @@ func (app *Application) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := acquireContext(w, r, app)
 	defer releaseContext(ctx)
 
-	handler, params, found := app.router.Find(r.Method, r.URL.Path)
+	var err error
+	if len(app.pre) > 0 {
+		err = applyMiddleware(app.route, app.pre...)(ctx)
+	} else {
+		err = app.route(ctx)
+	}
+	if err != nil {
+		ctx.Error(err)
+	}
+}
+
+// route finds the handler for the request and runs it with the global
+// middleware.
+func (app *Application) route(c *Context) error {
+	rt, params, found := app.router.find(c.Request.Method, c.Request.URL.Path)
 	if !found {
-		http.NotFound(w, r)
-		return
+		http.NotFound(c.Response, c.Request)
+		return nil
 	}
 
-	ctx.params = params
+	c.params = params
+	c.route = rt.pattern
+	c.routeMiddleware = rt.middleware
 
-	finalHandler := applyMiddleware(handler, app.middlewares...)
-	if err := finalHandler(ctx); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	return applyMiddleware(rt.handler, app.middlewares...)(c)
+}
+
+// SetErrorHandler sets the handler for errors returned by route handlers
+// and middleware. By default DefaultErrorHandler is used.
+func (app *Application) SetErrorHandler(h ErrorHandler) {
+	app.errorHandler = h
 }
 
-// Run starts the HTTP server on the given address.
+// Run starts the HTTP server on the given address. After Shutdown it
+// returns http.ErrServerClosed.
 func (app *Application) Run(addr string) error {
 	// Print banner automatically
 	printBanner(addr)
-	return http.ListenAndServe(addr, app)
+
+	srv := &http.Server{Addr: addr, Handler: app}
+	app.serverMu.Lock()
+	app.server = srv
+	app.serverMu.Unlock()
+	return srv.ListenAndServe()
+}
+
+// Shutdown gracefully stops the server started by Run: readiness checks
+// start failing, and after the health ShutdownDelay the server stops
+// accepting connections and waits for active requests until ctx is done.
+//
+//	go func() {
+//		if err := app.Run(":8080"); err != http.ErrServerClosed {
+//			log.Fatal(err)
+//		}
+//	}()
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+//	defer stop()
+//	<-ctx.Done()
+//
+//	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+//	defer cancel()
+//	app.Shutdown(shutdownCtx)
+func (app *Application) Shutdown(ctx context.Context) error {
+	app.shuttingDown.Store(true)
+
+	if app.health != nil && app.health.config.ShutdownDelay > 0 {
+		timer := time.NewTimer(app.health.config.ShutdownDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	app.serverMu.Lock()
+	srv := app.server
+	app.serverMu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+// ShuttingDown reports whether Shutdown has been called.
+func (app *Application) ShuttingDown() bool {
+	return app.shuttingDown.Load()
 }
 
 // printBanner prints the startup banner
@@ -284,7 +382,7 @@ type TemplateEngine struct {
 	dir       string
 	ext       string
 	funcMap   template.FuncMap
-	templates map[string]*template.Template
+	templates map[string]*compiledTemplate
 	reload    bool
 	mu        sync.RWMutex
 }
@@ -310,7 +408,7 @@ func NewTemplateEngine(config TemplateConfig) (*TemplateEngine, error) {
 		dir:       config.Dir,
 		ext:       config.Ext,
 		funcMap:   config.FuncMap,
-		templates: make(map[string]*template.Template),
+		templates: make(map[string]*compiledTemplate),
 		reload:    config.Reload,
 	}
 
@@ -325,7 +423,7 @@ func (e *TemplateEngine) loadTemplates() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	e.templates = make(map[string]*template.Template)
+	e.templates = make(map[string]*compiledTemplate)
 
 	return filepath.Walk(e.dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -354,18 +452,112 @@ func (e *TemplateEngine) loadTemplates() error {
 	})
 }
 
-func (e *TemplateEngine) parseTemplate(path string) (*template.Template, error) {
+// compiledTemplate is a parsed template file. master is never executed,
+// so it can be cloned for renders with request-scoped functions.
+type compiledTemplate struct {
+	t      *template.Template
+	master *template.Template
+	funcs  map[string]bool
+}
+
+func (e *TemplateEngine) parseTemplate(path string) (*compiledTemplate, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	t := template.New(filepath.Base(path)).Funcs(e.funcMap)
-	return t.Parse(string(content))
+	master, err := template.New(filepath.Base(path)).Funcs(e.funcMap).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	t, err := master.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	ct := &compiledTemplate{t: t, master: master, funcs: make(map[string]bool)}
+	for _, tmpl := range master.Templates() {
+		if tmpl.Tree != nil {
+			collectFuncs(tmpl.Tree.Root, ct.funcs)
+		}
+	}
+	return ct, nil
+}
+
+// collectFuncs records the names of the functions called in node.
+func collectFuncs(node parse.Node, funcs map[string]bool) {
+	switch n := node.(type) {
+	case *parse.IdentifierNode:
+		funcs[n.Ident] = true
+	case *parse.ListNode:
+		if n != nil {
+			for _, child := range n.Nodes {
+				collectFuncs(child, funcs)
+			}
+		}
+	case *parse.ActionNode:
+		collectFuncs(n.Pipe, funcs)
+	case *parse.PipeNode:
+		if n != nil {
+			for _, cmd := range n.Cmds {
+				collectFuncs(cmd, funcs)
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFuncs(arg, funcs)
+		}
+	case *parse.ChainNode:
+		collectFuncs(n.Node, funcs)
+	case *parse.IfNode:
+		collectFuncs(&n.BranchNode, funcs)
+	case *parse.RangeNode:
+		collectFuncs(&n.BranchNode, funcs)
+	case *parse.WithNode:
+		collectFuncs(&n.BranchNode, funcs)
+	case *parse.BranchNode:
+		collectFuncs(n.Pipe, funcs)
+		collectFuncs(n.List, funcs)
+		collectFuncs(n.ElseList, funcs)
+	case *parse.TemplateNode:
+		collectFuncs(n.Pipe, funcs)
+	}
+}
+
+// template returns the template to execute, a clone bound to the
+// request-scoped funcs when it calls any of them.
+func (ct *compiledTemplate) template(funcs template.FuncMap) (*template.Template, error) {
+	for name := range funcs {
+		if ct.funcs[name] {
+			t, err := ct.master.Clone()
+			if err != nil {
+				return nil, err
+			}
+			return t.Funcs(funcs), nil
+		}
+	}
+	return ct.t, nil
 }
 
 // Render renders a template with the given data.
 func (e *TemplateEngine) Render(w io.Writer, name string, data any) error {
+	return e.RenderContext(context.Background(), w, name, data)
+}
+
+// RenderContext renders a template, reporting it to the OnRender hooks
+// with ctx. Functions set with Context.SetViewFunc for the request of ctx
+// replace those of the FuncMap.
+func (e *TemplateEngine) RenderContext(ctx context.Context, w io.Writer, name string, data any) (err error) {
+	start := time.Now()
+	defer func() {
+		if hooks := renderHooks.Load(); hooks != nil {
+			event := RenderEvent{Name: name, Start: start, Duration: time.Since(start), Err: err}
+			for _, hook := range *hooks {
+				hook(ctx, event)
+			}
+		}
+	}()
+
 	if e.reload {
 		if err := e.loadTemplates(); err != nil {
 			return err
@@ -373,16 +565,49 @@ func (e *TemplateEngine) Render(w io.Writer, name string, data any) error {
 	}
 
 	e.mu.RLock()
-	t, ok := e.templates[name]
+	ct, ok := e.templates[name]
 	e.mu.RUnlock()
 
 	if !ok {
 		return &TemplateNotFoundError{Name: name}
 	}
 
+	funcs, _ := ctx.Value(viewFuncsKey{}).(template.FuncMap)
+	t, err := ct.template(funcs)
+	if err != nil {
+		return err
+	}
 	return t.Execute(w, data)
 }
 
+// RenderEvent describes a finished template render.
+type RenderEvent struct {
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+var (
+	renderHooksMu sync.Mutex
+	renderHooks   atomic.Pointer[[]func(ctx context.Context, e RenderEvent)]
+)
+
+// OnRender registers fn to be called after every template render with
+// the context passed to RenderContext (c.Context() for c.View). It is
+// meant for development tools such as the profiler and runs inline, so
+// it must be fast.
+func OnRender(fn func(ctx context.Context, e RenderEvent)) {
+	renderHooksMu.Lock()
+	defer renderHooksMu.Unlock()
+	var hooks []func(ctx context.Context, e RenderEvent)
+	if old := renderHooks.Load(); old != nil {
+		hooks = append(hooks, *old...)
+	}
+	hooks = append(hooks, fn)
+	renderHooks.Store(&hooks)
+}
+
 // TemplateNotFoundError is returned when a template is not found.
 type TemplateNotFoundError struct {
 	Name string
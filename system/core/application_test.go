@@ -1,9 +1,18 @@
 package core
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
 )
 
 func TestApplication_BasicRouting(t *testing.T) {
@@ -133,3 +142,266 @@ func TestApplication_Middleware(t *testing.T) {
 		t.Errorf("Middleware not executed, got: %s", rec.Body.String())
 	}
 }
+
+func TestApplication_RouteAndStatus(t *testing.T) {
+	app := New()
+
+	var route string
+	var status int
+	var size int64
+	app.Use(func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			err := next(c)
+			route, status, size = c.Route(), c.Status(), c.Size()
+			return err
+		}
+	})
+	app.GET("/users/:id", func(c *Context) error {
+		return c.String(http.StatusAccepted, "queued")
+	})
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	if route != "/users/:id" {
+		t.Errorf("Expected route /users/:id, got %q", route)
+	}
+	if status != http.StatusAccepted || size != 6 {
+		t.Errorf("Expected status 202 and 6 bytes, got %d and %d", status, size)
+	}
+}
+
+func TestApplication_ErrorHandler(t *testing.T) {
+	app := New()
+	app.GET("/teapot", func(c *Context) error {
+		return NewHTTPError(http.StatusTeapot, "short and stout")
+	})
+
+	req := httptest.NewRequest("GET", "/teapot", nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTeapot || !strings.Contains(rec.Body.String(), "short and stout") {
+		t.Errorf("Expected 418 from HTTPError, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	var handled error
+	app.SetErrorHandler(func(c *Context, err error) {
+		handled = err
+		c.String(http.StatusBadGateway, "custom")
+	})
+
+	rec2 := httptest.NewRecorder()
+	app.ServeHTTP(rec2, httptest.NewRequest("GET", "/teapot", nil))
+
+	if handled == nil || rec2.Code != http.StatusBadGateway {
+		t.Errorf("Expected custom ErrorHandler to run, got %d", rec2.Code)
+	}
+}
+
+func TestApplication_Pre(t *testing.T) {
+	app := New()
+	var order []string
+	app.Pre(func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			order = append(order, "pre:"+c.Route())
+			c.Request.URL.Path = strings.TrimSuffix(c.Request.URL.Path, "/")
+			return next(c)
+		}
+	})
+	app.Use(func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			order = append(order, "use:"+c.Route())
+			return next(c)
+		}
+	})
+	app.GET("/users", func(c *Context) error {
+		return c.String(200, "users")
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/users/", nil))
+
+	if rec.Code != 200 || rec.Body.String() != "users" {
+		t.Errorf("Expected rewritten path to route, got %d %q", rec.Code, rec.Body.String())
+	}
+	if strings.Join(order, ",") != "pre:,use:/users" {
+		t.Errorf("Unexpected middleware order %v", order)
+	}
+}
+
+func TestApplication_AutoOptions(t *testing.T) {
+	app := New()
+	app.GET("/items", func(c *Context) error { return c.String(200, "list") })
+	app.POST("/items", func(c *Context) error { return c.String(201, "created") })
+	app.GET("/custom", func(c *Context) error { return c.String(200, "custom") })
+	app.OPTIONS("/custom", func(c *Context) error { return c.String(200, "explicit") })
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "/items", nil))
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Allow") != "" {
+		t.Errorf("Expected 404 without SetAutoOptions, got %d Allow=%q", rec.Code, rec.Header().Get("Allow"))
+	}
+
+	app.SetAutoOptions(true)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "/items", nil))
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Allow") != "GET, POST, OPTIONS" {
+		t.Errorf("Expected automatic OPTIONS, got %d Allow=%q", rec.Code, rec.Header().Get("Allow"))
+	}
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "/custom", nil))
+	if rec.Body.String() != "explicit" {
+		t.Errorf("Expected explicit OPTIONS handler to win, got %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown path, got %d", rec.Code)
+	}
+}
+
+func TestApplication_RouteConflict(t *testing.T) {
+	app := New()
+	app.GET("/files/*path", func(c *Context) error { return nil })
+	app.DELETE("/files/*name", func(c *Context) error { return nil })
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for a conflicting wildcard")
+		}
+	}()
+	app.GET("/files/*name", func(c *Context) error { return nil })
+}
+
+func TestApplication_Health(t *testing.T) {
+	var calls atomic.Int32
+	failing := atomic.Bool{}
+
+	app := New()
+	app.Health("/healthz", "/readyz").
+		CheckWithConfig(HealthCheck{
+			Name:     "db",
+			CacheTTL: time.Minute,
+			Func: func(ctx context.Context) error {
+				calls.Add(1)
+				return nil
+			},
+		}).
+		Check("queue", func(ctx context.Context) error {
+			if failing.Load() {
+				return errors.New("queue unreachable")
+			}
+			return nil
+		}).
+		CheckWithConfig(HealthCheck{
+			Name:    "slow",
+			Timeout: 10 * time.Millisecond,
+			Func: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		})
+
+	get := func(path string) (int, HealthReport) {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var report HealthReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Invalid JSON from %s: %q", path, rec.Body.String())
+		}
+		return rec.Code, report
+	}
+
+	// Liveness ignores readiness-only checks.
+	if code, report := get("/healthz"); code != 200 || report.Status != HealthStatusOK || len(report.Checks) != 0 {
+		t.Errorf("Expected healthy liveness, got %d %+v", code, report)
+	}
+
+	code, report := get("/readyz")
+	if code != http.StatusServiceUnavailable || report.Status != HealthStatusFail {
+		t.Fatalf("Expected timed-out check to fail readiness, got %d %+v", code, report)
+	}
+	if r := report.Checks["slow"]; r.Status != HealthStatusFail || !strings.Contains(r.Error, "timed out") {
+		t.Errorf("Unexpected slow result %+v", r)
+	}
+	if r := report.Checks["db"]; r.Status != HealthStatusOK || r.Cached {
+		t.Errorf("Unexpected db result %+v", r)
+	}
+
+	_, report = get("/readyz")
+	if !report.Checks["db"].Cached || calls.Load() != 1 {
+		t.Errorf("Expected cached db result, got %+v after %d calls", report.Checks["db"], calls.Load())
+	}
+
+	failing.Store(true)
+	if _, report = get("/readyz"); report.Checks["queue"].Error != "queue unreachable" {
+		t.Errorf("Expected queue error, got %+v", report.Checks["queue"])
+	}
+}
+
+func TestApplication_HealthShutdown(t *testing.T) {
+	app := New()
+	app.Health("/healthz", "/readyz")
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != 200 {
+		t.Fatalf("Expected ready, got %d", rec.Code)
+	}
+
+	if err := app.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !app.ShuttingDown() {
+		t.Error("Expected ShuttingDown after Shutdown")
+	}
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), HealthStatusShuttingDown) {
+		t.Errorf("Expected readiness to fail during shutdown, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != 200 {
+		t.Errorf("Expected liveness to pass during shutdown, got %d", rec.Code)
+	}
+}
+
+func TestDiskSpaceCheck(t *testing.T) {
+	dir := t.TempDir()
+	if err := DiskSpaceCheck(dir, 0)(context.Background()); err != nil {
+		t.Errorf("Expected check to pass, got %v", err)
+	}
+
+	free, ok, _ := diskFree(dir)
+	if !ok {
+		t.Skip("free space not available on this platform")
+	}
+	if err := DiskSpaceCheck(dir, free+1<<40)(context.Background()); err == nil {
+		t.Error("Expected check to fail when not enough space is free")
+	}
+	if err := DiskSpaceCheck(dir+"/missing", 0)(context.Background()); err == nil {
+		t.Error("Expected error for missing path")
+	}
+}
+
+func TestDatabaseCheck(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := DatabaseCheck(db)
+	if err := check(context.Background()); err != nil {
+		t.Errorf("Expected ping to succeed, got %v", err)
+	}
+	db.Close()
+	if err := check(context.Background()); err == nil {
+		t.Error("Expected ping on closed database to fail")
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag sets the ETag response header and answers a matching
+// If-None-Match with 304 Not Modified (412 Precondition Failed for
+// unsafe methods). It reports whether a response was sent, so handlers
+// can stop before doing expensive work:
+//
+//	if c.ETag(product.Version) {
+//		return nil
+//	}
+//	return c.View("product/detail", data)
+//
+// Unquoted tags are quoted; prefix with "W/" for a weak validator.
+func (c *Context) ETag(tag string) bool {
+	tag = quoteETag(tag)
+	c.Response.Header().Set("ETag", tag)
+
+	inm := c.Request.Header.Get("If-None-Match")
+	if inm == "" || !ETagMatch(inm, tag) {
+		return false
+	}
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		writeNotModified(c)
+	} else {
+		c.NoContent(http.StatusPreconditionFailed)
+	}
+	return true
+}
+
+// LastModified sets the Last-Modified response header and answers an
+// If-Modified-Since that is not older than t with 304 Not Modified.
+// Like ETag it reports whether a response was sent. If-Modified-Since is
+// ignored when the request carries If-None-Match.
+func (c *Context) LastModified(t time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	t = t.UTC().Truncate(time.Second)
+	c.Response.Header().Set("Last-Modified", t.Format(http.TimeFormat))
+
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+	if c.Request.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	if !NotModifiedSince(c.Request.Header.Get("If-Modified-Since"), t) {
+		return false
+	}
+	writeNotModified(c)
+	return true
+}
+
+// ETagMatch reports whether the If-None-Match header value matches etag
+// using weak comparison ("*" matches anything).
+func ETagMatch(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// NotModifiedSince reports whether an If-Modified-Since header value is
+// at or after modtime.
+func NotModifiedSince(ifModifiedSince string, modtime time.Time) bool {
+	if ifModifiedSince == "" || modtime.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	return !modtime.Truncate(time.Second).After(since)
+}
+
+func quoteETag(tag string) string {
+	weak := strings.HasPrefix(tag, "W/")
+	tag = strings.TrimPrefix(tag, "W/")
+	if !strings.HasPrefix(tag, `"`) {
+		tag = `"` + tag + `"`
+	}
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// writeNotModified sends 304, dropping headers that describe a body.
+func writeNotModified(c *Context) {
+	h := c.Response.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	c.NoContent(http.StatusNotModified)
+}
@@ -2,12 +2,21 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"html/template"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Context represents the context of an HTTP request.
@@ -21,6 +30,13 @@ type Context struct {
 	controller ControllerInterface
 	written    bool
 	app        *Application
+	route      string
+	writer     ResponseWriter
+	viewVars   Map
+	viewFuncs  template.FuncMap
+	viewScoped bool
+
+	routeMiddleware []Middleware
 }
 
 var contextPool = sync.Pool{
@@ -34,9 +50,15 @@ var contextPool = sync.Pool{
 
 func acquireContext(w http.ResponseWriter, r *http.Request, app *Application) *Context {
 	ctx := contextPool.Get().(*Context)
+	ctx.writer.reset(w)
 	ctx.Request = r
-	ctx.Response = w
+	ctx.Response = &ctx.writer
 	ctx.query = nil
+	ctx.route = ""
+	ctx.routeMiddleware = nil
+	ctx.viewVars = nil
+	ctx.viewFuncs = nil
+	ctx.viewScoped = false
 	ctx.written = false
 	ctx.app = app
 	return ctx
@@ -45,6 +67,7 @@ func acquireContext(w http.ResponseWriter, r *http.Request, app *Application) *C
 func releaseContext(ctx *Context) {
 	ctx.Request = nil
 	ctx.Response = nil
+	ctx.writer.reset(nil)
 	ctx.controller = nil
 	ctx.app = nil
 	for k := range ctx.params {
@@ -96,6 +119,122 @@ func (c *Context) File(filepath string) error {
 	return nil
 }
 
+// Attachment sends the file at path as a download named name.
+// If name is empty the base name of path is used. Range and
+// conditional requests are handled as in ServeContent.
+func (c *Context) Attachment(path, name string) error {
+	return c.serveFileAs(path, name, "attachment")
+}
+
+// Inline sends the file at path for display in the browser, suggesting
+// name if the user decides to save it.
+func (c *Context) Inline(path, name string) error {
+	return c.serveFileAs(path, name, "inline")
+}
+
+func (c *Context) serveFileAs(path, name, disposition string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return &os.PathError{Op: "open", Path: path, Err: os.ErrInvalid}
+	}
+
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	c.Response.Header().Set("Content-Disposition", ContentDisposition(disposition, name))
+	return c.ServeContent(name, fi.ModTime(), f)
+}
+
+// ServeContent replies with the content of rs, using name to detect the
+// Content-Type when it isn't already set. Range, If-Range,
+// If-Modified-Since and If-None-Match are honoured, see http.ServeContent.
+func (c *Context) ServeContent(name string, modtime time.Time, rs io.ReadSeeker) error {
+	http.ServeContent(c.Response, c.Request, name, modtime, rs)
+	c.written = true
+	return nil
+}
+
+// Stream copies r to the response, flushing after every chunk so that
+// generated exports reach the client while they are being produced.
+func (c *Context) Stream(code int, contentType string, r io.Reader) error {
+	c.Response.Header().Set("Content-Type", contentType)
+	c.Response.WriteHeader(code)
+	c.written = true
+
+	flusher, _ := c.Response.(http.Flusher)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := c.Response.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ContentDisposition builds a Content-Disposition header value such as
+// `attachment; filename="report.csv"`. Names that are not plain ASCII
+// also get an RFC 5987 filename* parameter, with an ASCII fallback in
+// filename for older clients.
+func ContentDisposition(disposition, name string) string {
+	var fallback strings.Builder
+	ascii := true
+	for _, r := range name {
+		switch {
+		case r >= 0x80:
+			ascii = false
+			fallback.WriteByte('_')
+		case r < 0x20 || r == 0x7f || r == '"' || r == '\\':
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+
+	v := disposition + `; filename="` + fallback.String() + `"`
+	if !ascii {
+		v += "; filename*=UTF-8''" + encodeRFC5987(name)
+	}
+	return v
+}
+
+// encodeRFC5987 percent-encodes everything outside the RFC 5987 attr-char set.
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9') ||
+			strings.IndexByte("!#$&+-.^_`|~", ch) >= 0 {
+			b.WriteByte(ch)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[ch>>4])
+		b.WriteByte(hex[ch&0x0f])
+	}
+	return b.String()
+}
+
 func (c *Context) NoContent(code int) error {
 	c.Response.WriteHeader(code)
 	c.written = true
@@ -116,6 +255,15 @@ func (c *Context) Param(name string) string {
 	return c.params[name]
 }
 
+// Params returns a copy of all route parameters.
+func (c *Context) Params() map[string]string {
+	params := make(map[string]string, len(c.params))
+	for k, v := range c.params {
+		params[k] = v
+	}
+	return params
+}
+
 func (c *Context) ParamInt(name string) (int, error) {
 	return strconv.Atoi(c.params[name])
 }
@@ -161,17 +309,28 @@ func (c *Context) Bind(dest any) error {
 	contentType := c.Request.Header.Get("Content-Type")
 	switch {
 	case contentType == "application/json" || contentType == "":
-		return json.NewDecoder(c.Request.Body).Decode(dest)
+		return bodyError(json.NewDecoder(c.Request.Body).Decode(dest))
 	default:
 		if err := c.Request.ParseForm(); err != nil {
-			return err
+			return bodyError(err)
 		}
-		return json.NewDecoder(c.Request.Body).Decode(dest)
+		return bodyError(json.NewDecoder(c.Request.Body).Decode(dest))
 	}
 }
 
 func (c *Context) Body() ([]byte, error) {
-	return io.ReadAll(c.Request.Body)
+	b, err := io.ReadAll(c.Request.Body)
+	return b, bodyError(err)
+}
+
+// bodyError turns a body that exceeded its limit (see middleware.BodyLimit)
+// into a 413 HTTPError.
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return NewHTTPError(http.StatusRequestEntityTooLarge).WithInternal(err)
+	}
+	return err
 }
 
 // --- Request Info ---
@@ -194,6 +353,101 @@ func (c *Context) IP() string {
 	return c.Request.RemoteAddr
 }
 
+// Route returns the pattern of the matched route (e.g. "/users/:id"),
+// or "" if the request didn't match a route.
+func (c *Context) Route() string {
+	return c.route
+}
+
+// MiddlewareChain returns the names of the middleware handling the
+// request, outermost first: pre-routing, global, then the route's own
+// (group and controller middleware).
+func (c *Context) MiddlewareChain() []string {
+	var chain []Middleware
+	if c.app != nil {
+		chain = append(chain, c.app.pre...)
+		chain = append(chain, c.app.middlewares...)
+	}
+	chain = append(chain, c.routeMiddleware...)
+
+	names := make([]string, len(chain))
+	for i, m := range chain {
+		names[i] = middlewareName(m)
+	}
+	return names
+}
+
+// middlewareName derives a readable name from the function that built
+// m, e.g. "middleware.LoggerWithConfig" for the closure it returns.
+func middlewareName(m Middleware) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(m).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	// Strip closure suffixes such as ".func1.2".
+	for {
+		i := strings.LastIndex(name, ".")
+		if i < 0 || strings.Trim(strings.TrimPrefix(name[i+1:], "func"), "0123456789") != "" {
+			return name
+		}
+		name = name[:i]
+	}
+}
+
+// Status returns the response status code written so far, or 0.
+func (c *Context) Status() int {
+	if rw := findResponseWriter(c.Response); rw != nil {
+		return rw.Status()
+	}
+	return 0
+}
+
+// ResultStatus returns the status of the response to a handler that
+// returned err: the status written so far, or when nothing was written
+// the one DefaultErrorHandler answers with, and 200 without error.
+func (c *Context) ResultStatus(err error) int {
+	if status := c.Status(); status != 0 {
+		return status
+	}
+	if err == nil {
+		return http.StatusOK
+	}
+	code, _ := errorResponse(err)
+	return code
+}
+
+// Size returns the number of response body bytes written so far.
+func (c *Context) Size() int64 {
+	if rw := findResponseWriter(c.Response); rw != nil {
+		return rw.Size()
+	}
+	return 0
+}
+
+// CaptureResponse wraps c.Response in a ResponseWriter unless it already
+// is one, so Status and Size work. Contexts created by the Application
+// are always wrapped; this is for contexts built by hand, e.g. in tests.
+func (c *Context) CaptureResponse() {
+	if findResponseWriter(c.Response) == nil {
+		c.Response = NewResponseWriter(c.Response)
+	}
+}
+
+// Written reports whether a response has already been started.
+func (c *Context) Written() bool {
+	if c.written {
+		return true
+	}
+	if rw := findResponseWriter(c.Response); rw != nil {
+		return rw.Written()
+	}
+	return false
+}
+
 func (c *Context) Header(name string) string {
 	return c.Request.Header.Get(name)
 }
@@ -210,9 +464,102 @@ func (c *Context) SetCookie(cookie *http.Cookie) {
 	http.SetCookie(c.Response, cookie)
 }
 
+// --- Standard Context ---
+
+// Context returns the request's context.Context.
+// It is cancelled when the client disconnects or a deadline set by
+// middleware (such as middleware.Timeout) expires.
+func (c *Context) Context() context.Context {
+	return c.Request.Context()
+}
+
+// SetContext replaces the request's context.Context.
+// Use this to attach deadlines or values that downstream handlers and
+// libraries should observe through c.Context().
+func (c *Context) SetContext(ctx context.Context) {
+	c.Request = c.Request.WithContext(ctx)
+}
+
+// RequestIDKey is the key under which the request ID is kept in the
+// request-scoped store (see middleware.RequestID).
+const RequestIDKey = "request_id"
+
+type requestIDCtxKey struct{}
+
+// WithRequestID returns a copy of ctx that carries the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or "".
+// Libraries that only see a context.Context use this to correlate logs.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// RequestID returns the ID assigned to the current request, or "" when
+// no request ID middleware is installed.
+func (c *Context) RequestID() string {
+	if id := c.GetString(RequestIDKey); id != "" {
+		return id
+	}
+	if c.Request == nil {
+		return ""
+	}
+	return RequestIDFromContext(c.Request.Context())
+}
+
+// Copy returns a snapshot of the context that is safe to use outside the
+// request scope, e.g. from a goroutine started by the handler.
+// The original context is returned to a pool once the request finishes,
+// so goroutines must never keep a reference to it.
+// The copy has no ResponseWriter and must not be used to write the response.
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		Request: c.Request,
+		params:  make(map[string]string, len(c.params)),
+		store:   make(map[string]any, len(c.store)),
+		written: c.written,
+		app:     c.app,
+		route:   c.route,
+	}
+	if c.viewVars != nil {
+		cp.viewVars = make(Map, len(c.viewVars))
+		for k, v := range c.viewVars {
+			cp.viewVars[k] = v
+		}
+	}
+	if c.viewFuncs != nil {
+		cp.viewFuncs = make(template.FuncMap, len(c.viewFuncs))
+		for k, v := range c.viewFuncs {
+			cp.viewFuncs[k] = v
+		}
+	}
+	for k, v := range c.params {
+		cp.params[k] = v
+	}
+	for k, v := range c.store {
+		cp.store[k] = v
+	}
+	if c.query != nil {
+		cp.query = make(url.Values, len(c.query))
+		for k, v := range c.query {
+			cp.query[k] = append([]string(nil), v...)
+		}
+	}
+	return cp
+}
+
 // --- Request-Scoped Storage ---
 
 func (c *Context) Set(key string, value any) {
+	if c.store == nil {
+		c.store = make(map[string]any)
+	}
 	c.store[key] = value
 }
 
@@ -234,8 +581,76 @@ func (c *Context) GetInt(key string) int {
 	return 0
 }
 
+// CacheForKey is the store key set by CacheFor.
+const CacheForKey = "page_cache_ttl"
+
+// CacheFor asks middleware.PageCache to cache this response for d,
+// like CodeIgniter's $this->output->cache(). A zero or negative d
+// disables caching for this response.
+func (c *Context) CacheFor(d time.Duration) {
+	c.Set(CacheForKey, d)
+}
+
 // --- View Rendering ---
 
+// SetViewData makes a value available to every template rendered for
+// this request, e.g. {{.csp_nonce}}. Data passed to View takes
+// precedence over keys set here.
+func (c *Context) SetViewData(key string, value any) {
+	if c.viewVars == nil {
+		c.viewVars = make(Map)
+	}
+	c.viewVars[key] = value
+}
+
+// SetViewFunc makes fn the template function name for templates
+// rendered for this request, e.g. {{csrf_field}}. The engine's FuncMap
+// must define a function of that name too, so templates using it parse;
+// it is what renders outside a request.
+func (c *Context) SetViewFunc(name string, fn any) {
+	if c.viewFuncs == nil {
+		c.viewFuncs = make(template.FuncMap)
+	}
+	c.viewFuncs[name] = fn
+}
+
+type viewFuncsKey struct{}
+
+// viewContext returns the context templates are rendered with, carrying
+// the request-scoped view functions.
+func (c *Context) viewContext() context.Context {
+	if len(c.viewFuncs) == 0 {
+		return c.Context()
+	}
+	return context.WithValue(c.Context(), viewFuncsKey{}, c.viewFuncs)
+}
+
+// ViewDataRendered reports whether a template was rendered for this
+// request with values set by SetViewData or SetViewFunc, which makes the
+// output specific to the request. Caches use it to skip such responses.
+func (c *Context) ViewDataRendered() bool {
+	return c.viewScoped
+}
+
+// viewData merges request-scoped view data into data.
+func (c *Context) viewData(data Map) Map {
+	if len(c.viewFuncs) > 0 {
+		c.viewScoped = true
+	}
+	if len(c.viewVars) == 0 {
+		return data
+	}
+	c.viewScoped = true
+	merged := make(Map, len(c.viewVars)+len(data))
+	for k, v := range c.viewVars {
+		merged[k] = v
+	}
+	for k, v := range data {
+		merged[k] = v
+	}
+	return merged
+}
+
 func (c *Context) View(name string, data Map) error {
 	if c.app == nil || c.app.renderer == nil {
 		return c.HTML(200, "Template engine not configured")
@@ -246,7 +661,7 @@ func (c *Context) View(name string, data Map) error {
 		c.Response.WriteHeader(200)
 		c.written = true
 	}
-	return c.app.renderer.Render(c.Response, name, data)
+	return c.app.renderer.RenderContext(c.viewContext(), c.Response, name, c.viewData(data))
 }
 
 func (c *Context) ViewWithCode(code int, name string, data Map) error {
@@ -259,7 +674,7 @@ func (c *Context) ViewWithCode(code int, name string, data Map) error {
 		c.Response.WriteHeader(code)
 		c.written = true
 	}
-	return c.app.renderer.Render(c.Response, name, data)
+	return c.app.renderer.RenderContext(c.viewContext(), c.Response, name, c.viewData(data))
 }
 
 // Render renders a template to string for composition.
@@ -274,7 +689,7 @@ func (c *Context) Render(name string, data Map) (string, error) {
 	}
 
 	var buf bytes.Buffer
-	err := c.app.renderer.Render(&buf, name, data)
+	err := c.app.renderer.RenderContext(c.viewContext(), &buf, name, c.viewData(data))
 	if err != nil {
 		return "", err
 	}
@@ -2,11 +2,16 @@ package core
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestContext_JSON(t *testing.T) {
@@ -187,6 +192,40 @@ func TestContext_Headers(t *testing.T) {
 	}
 }
 
+func TestContext_ResultStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		written int
+		err     error
+		want    int
+	}{
+		{"no error", 0, nil, http.StatusOK},
+		{"error", 0, io.EOF, http.StatusInternalServerError},
+		{"http error", 0, NewHTTPError(http.StatusNotFound), http.StatusNotFound},
+		{"wrapped http error", 0, fmt.Errorf("load: %w", NewHTTPError(http.StatusForbidden)), http.StatusForbidden},
+		{"body too large", 0, fmt.Errorf("read: %w", &http.MaxBytesError{Limit: 10}), http.StatusRequestEntityTooLarge},
+		{"written", http.StatusCreated, NewHTTPError(http.StatusNotFound), http.StatusCreated},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		ctx := acquireContext(rec, httptest.NewRequest("GET", "/", nil), nil)
+		if tt.written != 0 {
+			ctx.NoContent(tt.written)
+		}
+		if got := ctx.ResultStatus(tt.err); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+		// The status must match what the error handler answers with.
+		if tt.err != nil {
+			DefaultErrorHandler(ctx, tt.err)
+			if rec.Code != tt.want {
+				t.Errorf("%s: error handler answered %d, expected %d", tt.name, rec.Code, tt.want)
+			}
+		}
+		releaseContext(ctx)
+	}
+}
+
 func TestContext_Cookie(t *testing.T) {
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "/", nil)
@@ -312,3 +351,217 @@ func TestContext_NoContent(t *testing.T) {
 		t.Error("Expected empty body")
 	}
 }
+
+func TestContext_SetContext(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx := acquireContext(rec, req, nil)
+	defer releaseContext(ctx)
+
+	type key struct{}
+	ctx.SetContext(context.WithValue(ctx.Context(), key{}, "value"))
+
+	if ctx.Context().Value(key{}) != "value" {
+		t.Error("Expected value from replaced context")
+	}
+	if ctx.Request.Context().Value(key{}) != "value" {
+		t.Error("Expected Request.Context() to be replaced too")
+	}
+}
+
+func TestContext_Copy(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/?page=2", nil)
+	ctx := acquireContext(rec, req, nil)
+	ctx.params["id"] = "7"
+	ctx.Set("user", "john")
+	ctx.Query("page")
+
+	cp := ctx.Copy()
+	releaseContext(ctx)
+
+	if cp.Param("id") != "7" {
+		t.Errorf("Expected id=7 in copy, got %s", cp.Param("id"))
+	}
+	if cp.GetString("user") != "john" {
+		t.Errorf("Expected user=john in copy, got %s", cp.GetString("user"))
+	}
+	if cp.Query("page") != "2" {
+		t.Errorf("Expected page=2 in copy, got %s", cp.Query("page"))
+	}
+	if cp.Response != nil {
+		t.Error("Copy must not carry the ResponseWriter")
+	}
+}
+
+func TestContext_Attachment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invoice.txt")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	ctx := acquireContext(rec, req, nil)
+	defer releaseContext(ctx)
+
+	if err := ctx.Attachment(path, "faktur-ñ.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `attachment; filename="faktur-_.txt"; filename*=UTF-8''faktur-%C3%B1.txt`
+	if got := rec.Header().Get("Content-Disposition"); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if rec.Code != http.StatusPartialContent {
+		t.Errorf("Expected 206, got %d", rec.Code)
+	}
+	if rec.Body.String() != "2345" {
+		t.Errorf("Expected '2345', got %s", rec.Body.String())
+	}
+}
+
+func TestContext_Inline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx := acquireContext(rec, req, nil)
+	defer releaseContext(ctx)
+
+	if err := ctx.Inline(path, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rec.Header().Get("Content-Disposition"); got != `inline; filename="report.pdf"` {
+		t.Errorf("Unexpected Content-Disposition: %s", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("Expected application/pdf, got %s", got)
+	}
+}
+
+func TestContext_Stream(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx := acquireContext(rec, req, nil)
+	defer releaseContext(ctx)
+
+	err := ctx.Stream(200, "text/csv", strings.NewReader("id,name\n1,John\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Header().Get("Content-Type") != "text/csv" {
+		t.Errorf("Expected text/csv, got %s", rec.Header().Get("Content-Type"))
+	}
+	if rec.Body.String() != "id,name\n1,John\n" {
+		t.Errorf("Unexpected body %q", rec.Body.String())
+	}
+	if !rec.Flushed {
+		t.Error("Expected response to be flushed")
+	}
+}
+
+func TestContext_ETag(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", `"v1", W/"v2"`)
+	ctx := acquireContext(rec, req, nil)
+	defer releaseContext(ctx)
+
+	if !ctx.ETag("v2") {
+		t.Fatal("Expected weak match on v2")
+	}
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", rec.Code)
+	}
+	if rec.Header().Get("ETag") != `"v2"` {
+		t.Errorf("Expected quoted ETag, got %s", rec.Header().Get("ETag"))
+	}
+
+	rec2 := httptest.NewRecorder()
+	req2 := httptest.NewRequest("GET", "/", nil)
+	req2.Header.Set("If-None-Match", `"v1"`)
+	ctx2 := acquireContext(rec2, req2, nil)
+	defer releaseContext(ctx2)
+
+	if ctx2.ETag(`W/"v3"`) {
+		t.Error("Expected no match on v3")
+	}
+}
+
+func TestContext_LastModified(t *testing.T) {
+	modtime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-Modified-Since", modtime.Format(http.TimeFormat))
+	ctx := acquireContext(rec, req, nil)
+	defer releaseContext(ctx)
+
+	if !ctx.LastModified(modtime.Add(500 * time.Millisecond)) {
+		t.Fatal("Expected not modified")
+	}
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", rec.Code)
+	}
+
+	rec2 := httptest.NewRecorder()
+	req2 := httptest.NewRequest("GET", "/", nil)
+	req2.Header.Set("If-Modified-Since", modtime.Format(http.TimeFormat))
+	ctx2 := acquireContext(rec2, req2, nil)
+	defer releaseContext(ctx2)
+
+	if ctx2.LastModified(modtime.Add(time.Hour)) {
+		t.Error("Expected modified resource")
+	}
+	if rec2.Header().Get("Last-Modified") != modtime.Add(time.Hour).Format(http.TimeFormat) {
+		t.Errorf("Unexpected Last-Modified %s", rec2.Header().Get("Last-Modified"))
+	}
+}
+
+func TestContext_SetViewFunc(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "form.html"), []byte(`<form>{{token}}</form>`), 0o644)
+	os.WriteFile(filepath.Join(dir, "plain.html"), []byte(`<p>{{upper .Name}}</p>`), 0o644)
+
+	funcs := DefaultTemplateFuncs()
+	funcs["token"] = func() string { return "" }
+	app := New()
+	if err := app.LoadTemplatesWithFuncs(dir, false, funcs); err != nil {
+		t.Fatal(err)
+	}
+	app.GET("/form/:token", func(c *Context) error {
+		token := c.Param("token")
+		c.SetViewFunc("token", func() string { return token })
+		return c.View("form", nil)
+	})
+	app.GET("/plain", func(c *Context) error {
+		c.SetViewFunc("token", func() string { return "x" })
+		return c.View("plain", Map{"Name": "go"})
+	})
+
+	for _, token := range []string{"a", "b"} {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", "/form/"+token, nil))
+		if want := "<form>" + token + "</form>"; rec.Body.String() != want {
+			t.Errorf("Expected %q, got %q", want, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/plain", nil))
+	if rec.Body.String() != "<p>GO</p>" {
+		t.Errorf("Expected template without view funcs to render, got %q", rec.Body.String())
+	}
+
+	var buf bytes.Buffer
+	if err := app.Renderer().Render(&buf, "form", nil); err != nil || buf.String() != "<form></form>" {
+		t.Errorf("Expected FuncMap function outside a request, got %q, %v", buf.String(), err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package core
+
+// diskFree is not implemented on this platform.
+func diskFree(path string) (uint64, bool, error) {
+	return 0, false, nil
+}
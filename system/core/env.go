@@ -0,0 +1,51 @@
+package core
+
+import "os"
+
+// Application environments.
+const (
+	EnvDevelopment = "development"
+	EnvTesting     = "testing"
+	EnvProduction  = "production"
+)
+
+// envFromOS returns APP_ENV, defaulting to production.
+func envFromOS() string {
+	if env := os.Getenv("APP_ENV"); env != "" {
+		return env
+	}
+	return EnvProduction
+}
+
+// SetEnv sets the application environment (see the Env* constants).
+func (app *Application) SetEnv(env string) {
+	app.env = env
+}
+
+// Env returns the application environment. Unless set with SetEnv it
+// is read from APP_ENV, defaulting to "production".
+func (app *Application) Env() string {
+	if app.env == "" {
+		return envFromOS()
+	}
+	return app.env
+}
+
+// IsDevelopment reports whether the application runs in development mode.
+func (app *Application) IsDevelopment() bool {
+	return app.Env() == EnvDevelopment
+}
+
+// App returns the application serving the request, or nil.
+func (c *Context) App() *Application {
+	return c.app
+}
+
+// IsDevelopment reports whether the request is served in development
+// mode. Contexts without an application fall back to APP_ENV.
+func (c *Context) IsDevelopment() bool {
+	if c.app != nil {
+		return c.app.IsDevelopment()
+	}
+	return envFromOS() == EnvDevelopment
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HTTPError is an error that carries an HTTP status code.
+// Return it from a handler (or middleware) to control the status
+// the ErrorHandler responds with.
+type HTTPError struct {
+	Code    int
+	Message string
+	Err     error
+}
+
+// NewHTTPError creates a new HTTPError. If message is empty the
+// standard status text is used.
+func NewHTTPError(code int, message ...string) *HTTPError {
+	e := &HTTPError{Code: code, Message: http.StatusText(code)}
+	if len(message) > 0 && message[0] != "" {
+		e.Message = message[0]
+	}
+	return e
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the wrapped error, if any.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// WithInternal returns a copy of e wrapping err, which is kept out of the
+// response but available to logging via errors.Unwrap.
+func (e *HTTPError) WithInternal(err error) *HTTPError {
+	cp := *e
+	cp.Err = err
+	return &cp
+}
+
+// ErrorHandler handles errors returned by handlers.
+type ErrorHandler func(c *Context, err error)
+
+// DefaultErrorHandler writes err as plain text. *HTTPError values use
+// their own status code; any other error results in 500. Nothing is
+// written if the response has already been started.
+func DefaultErrorHandler(c *Context, err error) {
+	if c.Written() {
+		return
+	}
+
+	code, message := errorResponse(err)
+	http.Error(c.Response, message, code)
+	c.written = true
+}
+
+// errorResponse returns the status and message DefaultErrorHandler
+// answers err with. Context.ResultStatus uses the same status.
+func errorResponse(err error) (int, string) {
+	var he *HTTPError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &he):
+		return he.Code, he.Message
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge)
+	}
+	return http.StatusInternalServerError, err.Error()
+}
+
+// Error hands err to the application's ErrorHandler
+// (DefaultErrorHandler if none is set).
+func (c *Context) Error(err error) {
+	if err == nil {
+		return
+	}
+	if c.app != nil && c.app.errorHandler != nil {
+		c.app.errorHandler(c, err)
+		return
+	}
+	DefaultErrorHandler(c, err)
+}
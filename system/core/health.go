@@ -0,0 +1,289 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthCheckFunc reports an unhealthy dependency by returning an error.
+// It should give up when ctx is done.
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheck describes a check registered with Health.
+type HealthCheck struct {
+	// Name identifies the check in the JSON output.
+	Name string
+
+	// Func performs the check.
+	Func HealthCheckFunc
+
+	// Timeout bounds the check; a check still running then fails
+	// (default: HealthConfig.Timeout).
+	Timeout time.Duration
+
+	// CacheTTL reuses the last result for this long, so frequent probes
+	// don't hammer the dependency (default: 0, run on every probe).
+	CacheTTL time.Duration
+
+	// Liveness also runs the check on the liveness endpoint. Leave it
+	// off for external dependencies: a failing liveness probe restarts
+	// the process, which does not fix a database outage.
+	Liveness bool
+}
+
+// HealthConfig holds configuration for the health endpoints.
+type HealthConfig struct {
+	// LivePath serves the liveness probe (default: "/healthz").
+	LivePath string
+
+	// ReadyPath serves the readiness probe (default: "/readyz").
+	ReadyPath string
+
+	// Timeout is the default per-check timeout (default: 5s).
+	Timeout time.Duration
+
+	// ShutdownDelay is how long Shutdown keeps serving with readiness
+	// failing before it stops accepting connections, giving load
+	// balancers time to take the instance out of rotation (default: 0).
+	ShutdownDelay time.Duration
+}
+
+// Health runs the checks behind the liveness and readiness endpoints.
+type Health struct {
+	app    *Application
+	config HealthConfig
+
+	mu     sync.RWMutex
+	checks []*healthEntry
+}
+
+type healthEntry struct {
+	HealthCheck
+
+	mu     sync.Mutex
+	result HealthResult
+}
+
+// HealthResult is the outcome of a single check.
+type HealthResult struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  float64   `json:"duration_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+	Cached    bool      `json:"cached,omitempty"`
+}
+
+// HealthReport is the JSON body served by the health endpoints.
+type HealthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]HealthResult `json:"checks,omitempty"`
+}
+
+// Health statuses.
+const (
+	HealthStatusOK           = "ok"
+	HealthStatusFail         = "fail"
+	HealthStatusShuttingDown = "shutting_down"
+)
+
+// Health registers liveness and readiness endpoints at the given paths
+// and returns the Health to add checks to:
+//
+//	app.Health("/healthz", "/readyz").
+//		Check("database", core.DatabaseCheck(db.Conn())).
+//		Check("uploads", core.DiskSpaceCheck("./uploads", 100<<20))
+//
+// Both answer 200 with a JSON report when all their checks pass and 503
+// otherwise. Readiness also fails once Shutdown has been called.
+func (app *Application) Health(livePath, readyPath string) *Health {
+	return app.HealthWithConfig(HealthConfig{LivePath: livePath, ReadyPath: readyPath})
+}
+
+// HealthWithConfig registers the health endpoints with custom config.
+func (app *Application) HealthWithConfig(config HealthConfig) *Health {
+	if config.LivePath == "" {
+		config.LivePath = "/healthz"
+	}
+	if config.ReadyPath == "" {
+		config.ReadyPath = "/readyz"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	h := &Health{app: app, config: config}
+	app.health = h
+
+	app.GET(config.LivePath, func(c *Context) error {
+		return h.serve(c, true)
+	})
+	app.HEAD(config.LivePath, func(c *Context) error {
+		return h.serve(c, true)
+	})
+	app.GET(config.ReadyPath, func(c *Context) error {
+		return h.serve(c, false)
+	})
+	app.HEAD(config.ReadyPath, func(c *Context) error {
+		return h.serve(c, false)
+	})
+	return h
+}
+
+// Check adds a readiness check with default settings.
+func (h *Health) Check(name string, fn HealthCheckFunc) *Health {
+	return h.CheckWithConfig(HealthCheck{Name: name, Func: fn})
+}
+
+// CheckWithConfig adds a check with custom timeout, caching or liveness.
+func (h *Health) CheckWithConfig(check HealthCheck) *Health {
+	if check.Timeout == 0 {
+		check.Timeout = h.config.Timeout
+	}
+	h.mu.Lock()
+	h.checks = append(h.checks, &healthEntry{HealthCheck: check})
+	h.mu.Unlock()
+	return h
+}
+
+// Live runs the liveness checks.
+func (h *Health) Live(ctx context.Context) HealthReport {
+	return h.run(ctx, true)
+}
+
+// Ready runs the readiness checks. It fails without running them once
+// the application is shutting down.
+func (h *Health) Ready(ctx context.Context) HealthReport {
+	if h.app.ShuttingDown() {
+		return HealthReport{Status: HealthStatusShuttingDown}
+	}
+	return h.run(ctx, false)
+}
+
+func (h *Health) serve(c *Context, live bool) error {
+	var report HealthReport
+	if live {
+		report = h.Live(c.Context())
+	} else {
+		report = h.Ready(c.Context())
+	}
+
+	code := http.StatusOK
+	if report.Status != HealthStatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	c.SetHeader("Cache-Control", "no-store")
+	if c.Method() == http.MethodHead {
+		return c.NoContent(code)
+	}
+	return c.JSON(code, report)
+}
+
+func (h *Health) run(ctx context.Context, live bool) HealthReport {
+	h.mu.RLock()
+	var checks []*healthEntry
+	for _, e := range h.checks {
+		if !live || e.Liveness {
+			checks = append(checks, e)
+		}
+	}
+	h.mu.RUnlock()
+
+	report := HealthReport{Status: HealthStatusOK}
+	if len(checks) == 0 {
+		return report
+	}
+
+	results := make([]HealthResult, len(checks))
+	var wg sync.WaitGroup
+	for i, e := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = e.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	report.Checks = make(map[string]HealthResult, len(checks))
+	for i, e := range checks {
+		report.Checks[e.Name] = results[i]
+		if results[i].Status != HealthStatusOK {
+			report.Status = HealthStatusFail
+		}
+	}
+	return report
+}
+
+// run performs the check, or returns the cached result. Concurrent
+// probes wait for a running check and share its result.
+func (e *healthEntry) run(ctx context.Context) HealthResult {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.CacheTTL > 0 && !e.result.CheckedAt.IsZero() && time.Since(e.result.CheckedAt) < e.CacheTTL {
+		result := e.result
+		result.Cached = true
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- e.Func(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Don't wait for checks that ignore ctx.
+		err = fmt.Errorf("timed out after %s", e.Timeout)
+	}
+
+	result := HealthResult{
+		Status:    HealthStatusOK,
+		Duration:  float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = HealthStatusFail
+		result.Error = err.Error()
+	}
+	e.result = result
+	return result
+}
+
+// DatabaseCheck returns a check pinging db, typically database.DB.Conn().
+func DatabaseCheck(db *sql.DB) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// DiskSpaceCheck returns a check failing when the file system holding
+// path, such as the upload directory, has less than minFree bytes free.
+// Where free space can't be determined the check passes.
+func DiskSpaceCheck(path string, minFree uint64) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		free, ok, err := diskFree(path)
+		if err != nil {
+			return err
+		}
+		if ok && free < minFree {
+			return fmt.Errorf("%s: %d bytes free, need %d", path, free, minFree)
+		}
+		return nil
+	}
+}
@@ -1,5 +1,7 @@
 package radix
 
+import "fmt"
+
 // Node represents a node in the radix tree.
 type Node struct {
 	path     string
@@ -23,9 +25,11 @@ func New() *Tree {
 	}
 }
 
-// Insert adds a new route pattern with its handler.
-func (t *Tree) Insert(pattern string, handler any) {
-	t.root.insert(pattern, handler)
+// Insert adds a new route pattern with its handler. Inserting a pattern
+// again replaces its handler; a wildcard named differently from an
+// existing one at the same position is a conflict.
+func (t *Tree) Insert(pattern string, handler any) error {
+	return t.root.insert(pattern, handler)
 }
 
 // Search finds a handler for the given path and returns path parameters.
@@ -35,11 +39,11 @@ func (t *Tree) Search(path string) (handler any, params map[string]string, found
 	return handler, params, found
 }
 
-func (n *Node) insert(path string, handler any) {
+func (n *Node) insert(path string, handler any) error {
 	// Handle root path
 	if path == "" || path == "/" {
 		n.handler = handler
-		return
+		return nil
 	}
 
 	// Remove leading slash for processing
@@ -47,10 +51,10 @@ func (n *Node) insert(path string, handler any) {
 		path = path[1:]
 	}
 
-	n.insertPath(path, handler)
+	return n.insertPath(path, handler)
 }
 
-func (n *Node) insertPath(path string, handler any) {
+func (n *Node) insertPath(path string, handler any) error {
 	// Find the next segment
 	segment, rest := splitPath(path)
 
@@ -68,15 +72,23 @@ func (n *Node) insertPath(path string, handler any) {
 		}
 		if rest == "" {
 			child.handler = handler
-		} else {
-			child.insertPath(rest, handler)
+			return nil
 		}
-		return
+		return child.insertPath(rest, handler)
 	}
 
 	// Check if this is a wildcard segment
 	if len(segment) > 0 && segment[0] == '*' {
 		paramName := segment[1:]
+		for _, child := range n.children {
+			if child.wildcard {
+				if child.param != paramName {
+					return fmt.Errorf("wildcard *%s conflicts with *%s", paramName, child.param)
+				}
+				child.handler = handler
+				return nil
+			}
+		}
 		child := &Node{
 			path:     "*",
 			param:    paramName,
@@ -85,7 +97,7 @@ func (n *Node) insertPath(path string, handler any) {
 			handler:  handler, // Wildcard always terminates
 		}
 		n.children = append(n.children, child)
-		return
+		return nil
 	}
 
 	// Static segment
@@ -100,9 +112,9 @@ func (n *Node) insertPath(path string, handler any) {
 
 	if rest == "" {
 		child.handler = handler
-	} else {
-		child.insertPath(rest, handler)
+		return nil
 	}
+	return child.insertPath(rest, handler)
 }
 
 func (n *Node) search(path string, params map[string]string) (handler any, found bool) {
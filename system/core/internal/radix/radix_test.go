@@ -103,6 +103,25 @@ func TestTree_WildcardRoutes(t *testing.T) {
 	}
 }
 
+func TestTree_WildcardConflict(t *testing.T) {
+	tree := New()
+	tree.Insert("/files/*filepath", "files")
+
+	if err := tree.Insert("/files/*filepath", "replaced"); err != nil {
+		t.Errorf("Expected the same pattern to be replaced, got %v", err)
+	}
+	if handler, _, _ := tree.Search("/files/a.txt"); handler != "replaced" {
+		t.Errorf("Expected replaced handler, got %v", handler)
+	}
+
+	if err := tree.Insert("/files/*name", "other"); err == nil {
+		t.Error("Expected a conflict for a differently named wildcard")
+	}
+	if handler, params, _ := tree.Search("/files/a.txt"); handler != "replaced" || params["filepath"] != "a.txt" {
+		t.Errorf("Expected existing route to be kept, got %v %v", handler, params)
+	}
+}
+
 func TestTree_Priority(t *testing.T) {
 	tree := New()
 	tree.Insert("/users/new", "new")
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"net/http"
 	"reflect"
+	"slices"
 	"strings"
 )
 
@@ -58,10 +60,14 @@ func (r *controllerRegistry) registerControllerRoutes(app *Application, basePath
 		httpMethods := resolveHTTPMethods(methodName, allowedMethods)
 
 		handler := createControllerHandler(factory, methodName, controllerMiddleware, methodMiddleware[methodName])
+		chain := append(slices.Clone(controllerMiddleware), methodMiddleware[methodName]...)
 
 		// Register route for each HTTP method
 		for _, httpMethod := range httpMethods {
-			app.router.Add(httpMethod, routePath, handler)
+			app.router.add(httpMethod, routePath, handler, chain)
+			if httpMethod != http.MethodOptions {
+				app.router.addAutoOptions(routePath, applyMiddleware(autoOptions, controllerMiddleware...), controllerMiddleware)
+			}
 		}
 	}
 }
@@ -1,39 +1,96 @@
 package core
 
 import (
+	"net/http"
+	"slices"
+	"strings"
+
 	"github.com/semutdev/goigniter/system/core/internal/radix"
 )
 
 // Router manages HTTP routes using a radix tree for each HTTP method.
 type Router struct {
-	trees map[string]*radix.Tree
+	trees   map[string]*radix.Tree
+	methods map[string][]string // pattern -> registered methods
+	auto    map[string]bool     // patterns with an automatic OPTIONS route
 }
 
 func newRouter() *Router {
 	return &Router{
-		trees: make(map[string]*radix.Tree),
+		trees:   make(map[string]*radix.Tree),
+		methods: make(map[string][]string),
+		auto:    make(map[string]bool),
 	}
 }
 
+// route is what the radix tree stores for every registered pattern.
+type route struct {
+	pattern    string
+	handler    HandlerFunc
+	middleware []Middleware // already applied to handler; kept for MiddlewareChain
+}
+
 func (r *Router) Add(method, pattern string, handler HandlerFunc) {
+	r.add(method, pattern, handler, nil)
+}
+
+// add registers a route. It panics when pattern conflicts with an
+// existing route, like a wildcard named differently at the same position.
+func (r *Router) add(method, pattern string, handler HandlerFunc, middleware []Middleware) {
+	if err := r.insert(method, route{pattern: pattern, handler: handler, middleware: middleware}); err != nil {
+		panic("core: route " + method + " " + pattern + ": " + err.Error())
+	}
+	if !slices.Contains(r.methods[pattern], method) {
+		r.methods[pattern] = append(r.methods[pattern], method)
+	}
+}
+
+func (r *Router) insert(method string, rt route) error {
 	tree, ok := r.trees[method]
 	if !ok {
 		tree = radix.New()
 		r.trees[method] = tree
 	}
-	tree.Insert(pattern, handler)
+	return tree.Insert(rt.pattern, rt)
+}
+
+// addAutoOptions registers handler for OPTIONS on pattern unless an
+// OPTIONS route exists. An explicit OPTIONS route added later replaces it.
+// Patterns whose methods name a wildcard differently, which only
+// conflict in the shared OPTIONS tree, keep the first one's route.
+func (r *Router) addAutoOptions(pattern string, handler HandlerFunc, middleware []Middleware) {
+	if r.auto[pattern] || slices.Contains(r.methods[pattern], http.MethodOptions) {
+		return
+	}
+	if r.insert(http.MethodOptions, route{pattern: pattern, handler: handler, middleware: middleware}) == nil {
+		r.auto[pattern] = true
+	}
+}
+
+// allow returns the Allow header value for pattern.
+func (r *Router) allow(pattern string) string {
+	methods := slices.Clone(r.methods[pattern])
+	if !slices.Contains(methods, http.MethodOptions) {
+		methods = append(methods, http.MethodOptions)
+	}
+	return strings.Join(methods, ", ")
 }
 
 func (r *Router) Find(method, path string) (HandlerFunc, map[string]string, bool) {
+	rt, params, found := r.find(method, path)
+	return rt.handler, params, found
+}
+
+// find is like Find but returns the whole matched route.
+func (r *Router) find(method, path string) (route, map[string]string, bool) {
 	tree, ok := r.trees[method]
 	if !ok {
-		return nil, nil, false
+		return route{}, nil, false
 	}
 
-	handler, params, found := tree.Search(path)
+	value, params, found := tree.Search(path)
 	if !found {
-		return nil, nil, false
+		return route{}, nil, false
 	}
-
-	return handler.(HandlerFunc), params, true
+	return value.(route), params, true
 }
@@ -8,7 +8,8 @@ import (
 
 // PrintDebug prints data in a formatted way for debugging purposes.
 // It outputs to stdout with clear formatting, supporting maps, structs, slices, and basic types.
-// Use this during development to inspect controller data.
+// Use this during development to inspect controller data; for queries,
+// templates and request details see middleware.Profiler.
 //
 // Example usage in controller:
 //
@@ -19,7 +20,7 @@ func PrintDebug(data any) {
 
 	if data == nil {
 		fmt.Println("Data is nil")
-		fmt.Println("=========== DEBUG END ===========\n")
+		fmt.Print("=========== DEBUG END ===========\n\n")
 		return
 	}
 
@@ -32,7 +33,7 @@ func PrintDebug(data any) {
 		printValue(reflect.ValueOf(data), 0)
 	}
 
-	fmt.Println("=========== DEBUG END ===========\n")
+	fmt.Print("=========== DEBUG END ===========\n\n")
 }
 
 // printValue recursively prints reflect.Value with indentation
@@ -39,7 +39,25 @@ func AllTemplateFuncs() template.FuncMap {
 		"ne": func(a, b any) bool {
 			return a != b
 		},
+
+		// Pagination helpers
+		"pagination": Pagination,
+
+		// Form helpers, bound per request by middleware.CSRF. Without
+		// it they render nothing.
+		"csrf_token": func() string { return "" },
+		"csrf_field": func() template.HTML { return "" },
 	}
 
 	return funcs
 }
+
+// Pagination renders the page links of p, usually a *database.Pagination:
+//
+//	{{pagination .Pagination}}
+func Pagination(p interface{ Links() template.HTML }) template.HTML {
+	if p == nil {
+		return ""
+	}
+	return p.Links()
+}
@@ -0,0 +1,109 @@
+// Package cache provides a small key/value cache with pluggable stores.
+package cache
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store is the interface implemented by cache backends.
+// A zero ttl means the entry never expires.
+type Store interface {
+	// Get returns the value for key and whether it was found.
+	Get(key string) ([]byte, bool, error)
+
+	// Set stores value under key for ttl.
+	Set(key string, value []byte, ttl time.Duration) error
+
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+
+	// DeletePrefix removes every key starting with prefix.
+	DeletePrefix(prefix string) error
+}
+
+// MemoryStore is a process-local Store.
+// Expired entries are dropped lazily when read and swept on writes,
+// so no background goroutine is needed.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+	writes  int
+}
+
+type memoryEntry struct {
+	value    []byte
+	expireAt time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && now.After(e.expireAt)
+}
+
+// sweepEvery is the number of writes between sweeps of expired entries.
+const sweepEvery = 1000
+
+// NewMemory creates a new in-memory store.
+func NewMemory() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// Get returns the value for key.
+func (s *MemoryStore) Get(key string) ([]byte, bool, error) {
+	s.mu.RLock()
+	e, ok := s.entries[key]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, false, nil
+	}
+	if e.expired(time.Now()) {
+		s.Delete(key)
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// Set stores value under key for ttl.
+func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	e := memoryEntry{value: value}
+	if ttl > 0 {
+		e.expireAt = time.Now().Add(ttl)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = e
+	s.writes++
+	if s.writes >= sweepEvery {
+		s.writes = 0
+		now := time.Now()
+		for k, e := range s.entries {
+			if e.expired(now) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete removes key.
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// DeletePrefix removes every key starting with prefix.
+func (s *MemoryStore) DeletePrefix(prefix string) error {
+	s.mu.Lock()
+	for k := range s.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(s.entries, k)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T, s Store) {
+	if _, ok, _ := s.Get("missing"); ok {
+		t.Error("Expected missing key not to be found")
+	}
+
+	s.Set("page:/products/1", []byte("one"), 0)
+	s.Set("page:/products/2", []byte("two"), 0)
+	s.Set("page:/about", []byte("about"), 0)
+	s.Set("short", []byte("gone"), time.Millisecond)
+
+	v, ok, err := s.Get("page:/products/1")
+	if err != nil || !ok || string(v) != "one" {
+		t.Errorf("Expected 'one', got %q ok=%v err=%v", v, ok, err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := s.Get("short"); ok {
+		t.Error("Expected expired key not to be found")
+	}
+
+	if err := s.DeletePrefix("page:/products/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Get("page:/products/2"); ok {
+		t.Error("Expected prefix purge to remove /products/2")
+	}
+	if _, ok, _ := s.Get("page:/about"); !ok {
+		t.Error("Expected /about to survive prefix purge")
+	}
+
+	s.Delete("page:/about")
+	if _, ok, _ := s.Get("page:/about"); ok {
+		t.Error("Expected deleted key not to be found")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestFileStore(t *testing.T) {
+	s, err := NewFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileStore is a Store that keeps one file per key in a directory.
+// It survives restarts and can be shared by processes on the same host.
+type FileStore struct {
+	dir string
+}
+
+type fileEntry struct {
+	Key      string `json:"key"`
+	ExpireAt int64  `json:"expire_at"`
+	Value    []byte `json:"value"`
+}
+
+// NewFile creates a file store in dir, creating the directory if needed.
+func NewFile(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cache: failed to create directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".cache")
+}
+
+func (s *FileStore) read(path string) (*fileEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e fileEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Get returns the value for key.
+func (s *FileStore) Get(key string) ([]byte, bool, error) {
+	path := s.path(key)
+	e, err := s.read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if e.ExpireAt > 0 && time.Now().UnixNano() > e.ExpireAt {
+		os.Remove(path)
+		return nil, false, nil
+	}
+	return e.Value, true, nil
+}
+
+// Set stores value under key for ttl.
+// The file is written to a temporary name and renamed into place, so
+// concurrent readers never see a partial entry.
+func (s *FileStore) Set(key string, value []byte, ttl time.Duration) error {
+	e := fileEntry{Key: key, Value: value}
+	if ttl > 0 {
+		e.ExpireAt = time.Now().Add(ttl).UnixNano()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+// Delete removes key.
+func (s *FileStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// DeletePrefix removes every key starting with prefix.
+// It reads every entry, so it is meant for occasional purges.
+func (s *FileStore) DeletePrefix(prefix string) error {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.cache"))
+	if err != nil {
+		return err
+	}
+	for _, path := range matches {
+		e, err := s.read(path)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(e.Key, prefix) {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// maxBatchArgs bounds the arguments of one batch statement, below the
+// limits of SQLite (32766) and SQL Server (2100).
+const maxBatchArgs = 2000
+
+// statement is a query with its arguments, run by execAll.
+type statement struct {
+	query string
+	args  []any
+}
+
+// InsertBatch inserts rows, a []map[string]any or a slice of structs or
+// struct pointers, with chunkSize rows per INSERT statement (default:
+// 100). All rows must have the same columns; structs are converted as
+// InsertStruct does. Chunks are shrunk to stay below the argument limits
+// of the database, and run in one transaction unless the DB is one
+// already:
+//
+//	err := db.Table("products").InsertBatch([]map[string]any{
+//		{"name": "Keyboard", "price": 25, "stock": 10},
+//		{"name": "Mouse", "price": 15, "stock": 40},
+//	}, 500)
+func (b *Builder) InsertBatch(rows any, chunkSize int) error {
+	data, columns := b.batchRows(rows)
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i], _ = b.column(col, false)
+	}
+	if err := b.invalid(); err != nil {
+		return err
+	}
+
+	var statements []statement
+	for _, chunk := range chunkRows(data, len(columns), chunkSize) {
+		var sb strings.Builder
+		var args []any
+		fmt.Fprintf(&sb, "INSERT INTO %s (%s) VALUES ", b.from, strings.Join(quoted, ", "))
+		for i, row := range chunk {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString("(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")")
+			for _, col := range columns {
+				args = append(args, row[col])
+			}
+		}
+		statements = append(statements, statement{b.db.rebind(sb.String()), args})
+	}
+	return b.execAll(statements)
+}
+
+// Upsert inserts rows like InsertBatch, updating the update columns of
+// rows that conflict with an existing row on the conflict columns
+// instead. With no update columns, conflicting rows are left unchanged:
+//
+//	err := db.Table("products").Upsert(products, []string{"sku"}, []string{"price", "stock"})
+//
+// The statement comes from the dialect: ON CONFLICT on SQLite and
+// PostgreSQL, which need a unique index on the conflict columns, ON
+// DUPLICATE KEY UPDATE on MySQL, which uses any unique key, and MERGE on
+// SQL Server. The conflict and update columns must be among the inserted
+// ones, and the table can't have an alias.
+func (b *Builder) Upsert(rows any, conflict, update []string) error {
+	data, columns := b.batchRows(rows)
+	b.plainColumns(columns)
+	b.plainColumns(conflict)
+	b.plainColumns(update)
+	if len(conflict) == 0 {
+		b.setError(fmt.Errorf("%w: Upsert needs conflict columns", ErrInvalidArgument))
+	}
+	if len(b.tables) > 1 {
+		b.setError(fmt.Errorf("%w: Upsert takes a table without alias", ErrInvalidArgument))
+	}
+	inserted := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		inserted[col] = true
+	}
+	for _, col := range append(append([]string{}, conflict...), update...) {
+		if len(data) > 0 && !inserted[col] {
+			b.setError(fmt.Errorf("%w: Upsert column %q is not inserted", ErrInvalidArgument, col))
+		}
+	}
+	if err := b.invalid(); err != nil {
+		return err
+	}
+
+	var statements []statement
+	for _, chunk := range chunkRows(data, len(columns), 0) {
+		args := make([]any, 0, len(chunk)*len(columns))
+		for _, row := range chunk {
+			for _, col := range columns {
+				args = append(args, row[col])
+			}
+		}
+		query := b.db.dialect.Upsert(b.from, columns, len(chunk), conflict, update)
+		statements = append(statements, statement{query, args})
+	}
+	return b.execAll(statements)
+}
+
+// Increment adds n to column in the matching rows:
+//
+//	db.Table("products").Where("id", id).Increment("stock", 5)
+func (b *Builder) Increment(column string, n int64) error {
+	return b.increment(column, "+", n)
+}
+
+// Decrement subtracts n from column in the matching rows.
+func (b *Builder) Decrement(column string, n int64) error {
+	return b.increment(column, "-", n)
+}
+
+func (b *Builder) increment(column, operator string, n int64) error {
+	col, _ := b.column(column, false)
+	return b.Update(map[string]any{column: Raw(col+" "+operator+" ?", n)})
+}
+
+// UpdateBatch updates rows, a []map[string]any or a slice of structs or
+// struct pointers, each identified by its key column, with one UPDATE
+// statement per chunk of 100 rows using CASE expressions:
+//
+//	err := db.Table("products").UpdateBatch([]map[string]any{
+//		{"id": 1, "price": 20, "stock": 8},
+//		{"id": 2, "price": 12, "stock": 35},
+//	}, "id")
+//
+// All rows must have the same columns. Where clauses further restrict
+// the rows updated. Chunks run in one transaction unless the DB is one
+// already.
+func (b *Builder) UpdateBatch(rows any, key string) error {
+	data, columns := b.batchRows(rows)
+	keyCol, _ := b.column(key, false)
+	set := make([]string, 0, len(columns))
+	var quoted []string
+	for _, col := range columns {
+		if col == key {
+			continue
+		}
+		set = append(set, col)
+		q, _ := b.column(col, false)
+		quoted = append(quoted, q)
+	}
+	if len(data) > 0 && len(set) == len(columns) {
+		b.setError(fmt.Errorf("%w: UpdateBatch rows have no key column %q", ErrInvalidArgument, key))
+	}
+	if len(data) > 0 && len(set) == 0 {
+		b.setError(fmt.Errorf("%w: UpdateBatch rows have no columns to update", ErrInvalidArgument))
+	}
+	if err := b.invalid(); err != nil {
+		return err
+	}
+
+	var statements []statement
+	// Each column takes two arguments per row and the key one more.
+	for _, chunk := range chunkRows(data, 2*len(set)+1, 0) {
+		var parts []string
+		var args []any
+		for i, col := range set {
+			var sb strings.Builder
+			sb.WriteString(quoted[i] + " = CASE " + keyCol)
+			for _, row := range chunk {
+				sb.WriteString(" WHEN ? THEN ?")
+				args = append(args, row[key], row[col])
+			}
+			sb.WriteString(" ELSE " + quoted[i] + " END")
+			parts = append(parts, sb.String())
+		}
+
+		where := keyCol + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ") + ")"
+		for _, row := range chunk {
+			args = append(args, row[key])
+		}
+		if len(b.wheres) > 0 {
+			whereSQL, whereArgs := b.buildWheres()
+			where += " AND (" + whereSQL + ")"
+			args = append(args, whereArgs...)
+		}
+
+		query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", b.from, strings.Join(parts, ", "), where)
+		statements = append(statements, statement{b.db.rebind(query), args})
+	}
+	return b.execAll(statements)
+}
+
+// batchRows converts rows to maps and returns them with their columns in
+// order, recording an error unless all rows have the same columns.
+func (b *Builder) batchRows(rows any) ([]map[string]any, []string) {
+	var data []map[string]any
+	switch v := rows.(type) {
+	case []map[string]any:
+		data = v
+	default:
+		rv := reflect.ValueOf(rows)
+		if rv.Kind() != reflect.Slice {
+			b.setError(fmt.Errorf("%w: rows must be a slice of maps or structs, got %T", ErrInvalidArgument, rows))
+			return nil, nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			elem := rv.Index(i)
+			if elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+			if elem.Kind() != reflect.Struct {
+				b.setError(fmt.Errorf("%w: rows must be a slice of maps or structs, got %T", ErrInvalidArgument, rows))
+				return nil, nil
+			}
+			data = append(data, structToMap(elem.Interface()))
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	columns := sortedColumns(data[0])
+	for i, row := range data {
+		if len(row) != len(columns) {
+			b.setError(fmt.Errorf("%w: row %d has different columns than row 0", ErrInvalidArgument, i))
+			return nil, nil
+		}
+		for _, col := range columns {
+			if _, ok := row[col]; !ok {
+				b.setError(fmt.Errorf("%w: row %d has different columns than row 0", ErrInvalidArgument, i))
+				return nil, nil
+			}
+		}
+	}
+	return data, columns
+}
+
+// plainColumns checks that columns are unqualified names allowed on the
+// builder's table, for statements built by the dialect.
+func (b *Builder) plainColumns(columns []string) {
+	for _, col := range columns {
+		if !isIdentifier(col) {
+			b.setError(fmt.Errorf("%w: %q", ErrInvalidIdentifier, col))
+		} else if !b.allowed(identifier{parts: []string{col}}) {
+			b.setError(fmt.Errorf("%w: %q", ErrColumnNotAllowed, col))
+		}
+	}
+}
+
+// chunkRows splits rows in chunks of size rows (default: 100), smaller
+// when a chunk would take more than maxBatchArgs arguments of perRow each.
+func chunkRows(rows []map[string]any, perRow, size int) [][]map[string]any {
+	if size < 1 {
+		size = 100
+	}
+	if perRow > 0 {
+		size = max(1, min(size, maxBatchArgs/perRow))
+	}
+	var chunks [][]map[string]any
+	for len(rows) > size {
+		chunks = append(chunks, rows[:size])
+		rows = rows[size:]
+	}
+	if len(rows) > 0 {
+		chunks = append(chunks, rows)
+	}
+	return chunks
+}
+
+// execAll runs statements, in a transaction when there are several and
+// the DB isn't one already.
+func (b *Builder) execAll(statements []statement) error {
+	run := func(db *DB) error {
+		for _, s := range statements {
+			if _, err := db.exec(b.context(), b.table, s.query, s.args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if len(statements) > 1 && !b.db.inTransaction {
+		err = b.db.Transaction(run)
+	} else {
+		err = run(b.db)
+	}
+	if err != nil {
+		b.db.setError(err)
+	}
+	return err
+}
@@ -1,37 +1,63 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 )
 
 // Builder represents a query builder.
+//
+// Table and column names are quoted for the database and may only
+// contain letters, digits and underscores, qualified with dots and
+// followed by an alias where a table or selected column is expected
+// ("users u", "users.email AS contact"). Operators and order directions
+// are checked too. Anything else makes the query fail with an error
+// such as ErrInvalidIdentifier; use Raw for SQL expressions.
 type Builder struct {
 	db          *DB
-	table       string
+	table       string            // table name without alias
+	from        string            // quoted table and alias
+	tables      map[string]string // table names by qualifier, for the whitelist
 	columns     []string
+	columnArgs  []any
+	aliases     map[string]bool // aliases of selected columns
 	wheres      []whereClause
 	orders      []orderClause
 	joins       []joinClause
 	limitVal    int
 	offsetVal   int
 	groupByVal  []string
+	groupByArgs []any
 	havingVal   string
 	havingArgs  []any
+	unions      []unionClause
+	ctx         context.Context
+	err         error // first error found while building
 }
 
 type whereClause struct {
-	column   string
-	operator string
-	value    any
-	boolean  string // "AND" or "OR"
-	isRaw    bool
-	rawSQL   string
+	column     string
+	columnArgs []any
+	operator   string
+	value      any
+	boolean    string // "AND" or "OR"
+	isRaw      bool
+	rawSQL     string
+}
+
+type unionClause struct {
+	sql  string // " UNION SELECT ..."
+	args []any
 }
 
 type orderClause struct {
 	column    string
 	direction string
+	args      []any
 }
 
 type joinClause struct {
@@ -44,20 +70,126 @@ type joinClause struct {
 
 // newBuilder creates a new query builder.
 func newBuilder(db *DB, table string) *Builder {
-	return &Builder{
+	b := &Builder{
 		db:      db,
 		table:   table,
+		tables:  make(map[string]string),
 		columns: []string{"*"},
 	}
+	b.from, b.table = b.tableRef(table)
+	return b
+}
+
+// setError records the first error found while building the query,
+// which is returned when it runs.
+func (b *Builder) setError(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// invalid returns the error recorded while building, if any.
+func (b *Builder) invalid() error {
+	if b.err != nil {
+		b.db.setError(b.err)
+	}
+	return b.err
+}
+
+// tableRef quotes a table reference such as "app.users u" and records
+// its name for qualified columns. It returns the quoted reference and
+// the table name without alias.
+func (b *Builder) tableRef(table string) (string, string) {
+	id, err := parseIdentifier(table, true)
+	if err == nil && id.name() == "*" {
+		err = fmt.Errorf("%w: %q", ErrInvalidIdentifier, table)
+	}
+	if err != nil {
+		b.setError(err)
+		return "", table
+	}
+
+	name := strings.Join(id.parts, ".")
+	b.tables[id.name()] = name
+	if id.alias != "" {
+		b.tables[id.alias] = name
+	}
+	return b.db.quoteIdentifier(id), name
+}
+
+// column quotes a column reference, or returns the SQL and args of an
+// Expr. Aliases are only accepted for selected columns.
+func (b *Builder) column(column any, selected bool) (string, []any) {
+	switch v := column.(type) {
+	case Expr:
+		return v.SQL, v.Args
+	case string:
+		id, err := parseIdentifier(v, selected)
+		if err != nil {
+			b.setError(err)
+			return "", nil
+		}
+		if id.name() != "*" && !b.allowed(id) {
+			b.setError(fmt.Errorf("%w: %q", ErrColumnNotAllowed, v))
+			return "", nil
+		}
+		if selected && id.alias != "" {
+			if b.aliases == nil {
+				b.aliases = make(map[string]bool)
+			}
+			b.aliases[id.alias] = true
+		}
+		return b.db.quoteIdentifier(id), nil
+	default:
+		b.setError(fmt.Errorf("%w: %v", ErrInvalidIdentifier, column))
+		return "", nil
+	}
+}
+
+// allowed checks id against the whitelist of its table, see
+// DB.AllowColumns. Aliases of selected columns are always allowed.
+func (b *Builder) allowed(id identifier) bool {
+	if len(id.parts) == 1 && b.aliases[id.name()] {
+		return true
+	}
+	table := b.table
+	if q := id.qualifier(); q != "" {
+		var ok bool
+		if table, ok = b.tables[q]; !ok || len(id.parts) == 3 {
+			table = strings.Join(id.parts[:len(id.parts)-1], ".")
+		}
+	}
+	return b.db.columns.allowed(table, id.name())
 }
 
-// Select specifies which columns to select.
-func (b *Builder) Select(columns ...string) *Builder {
-	b.columns = columns
+// WithContext sets the context the query runs with, overriding the one
+// set with DB.WithContext.
+func (b *Builder) WithContext(ctx context.Context) *Builder {
+	b.ctx = ctx
 	return b
 }
 
-// Where adds a WHERE clause.
+func (b *Builder) context() context.Context {
+	if b.ctx != nil {
+		return b.ctx
+	}
+	return b.db.context()
+}
+
+// Select specifies which columns to select. Columns are names, which
+// may have an alias, or Raw expressions.
+func (b *Builder) Select(columns ...any) *Builder {
+	b.columns = nil
+	b.columnArgs = nil
+	for _, column := range columns {
+		col, args := b.column(column, true)
+		b.columns = append(b.columns, col)
+		b.columnArgs = append(b.columnArgs, args...)
+	}
+	return b
+}
+
+// Where adds a WHERE clause. The column may be a Raw expression.
 func (b *Builder) Where(args ...any) *Builder {
 	b.addWhere("AND", args...)
 	return b
@@ -76,79 +208,278 @@ func (b *Builder) addWhere(boolean string, args ...any) {
 	switch len(args) {
 	case 2:
 		// Where("column", value) -> column = value
-		w.column = args[0].(string)
 		w.operator = "="
 		w.value = args[1]
 	case 3:
 		// Where("column", ">", value) -> column > value
-		w.column = args[0].(string)
-		w.operator = args[1].(string)
+		op, _ := args[1].(string)
+		operator, err := normalizeOperator(op, whereOperators)
+		if err != nil {
+			b.setError(err)
+			return
+		}
+		w.operator = operator
 		w.value = args[2]
 	default:
+		b.setError(fmt.Errorf("%w: Where takes 2 or 3 arguments, got %d", ErrInvalidArgument, len(args)))
 		return
 	}
 
+	w.column, w.columnArgs = b.column(args[0], false)
 	b.wheres = append(b.wheres, w)
 }
 
-// WhereIn adds a WHERE IN clause.
-func (b *Builder) WhereIn(column string, values any) *Builder {
+// addRaw adds a condition built by the builder itself.
+func (b *Builder) addRaw(boolean, sql string, args []any) *Builder {
 	b.wheres = append(b.wheres, whereClause{
-		column:   column,
-		operator: "IN",
-		value:    values,
-		boolean:  "AND",
+		isRaw:   true,
+		rawSQL:  sql,
+		value:   args,
+		boolean: boolean,
 	})
 	return b
 }
 
-// WhereNotIn adds a WHERE NOT IN clause.
-func (b *Builder) WhereNotIn(column string, values any) *Builder {
+// WhereGroup adds conditions in parentheses:
+//
+//	// WHERE status = ? AND (role = ? OR role = ?)
+//	db.Table("users").Where("status", "active").WhereGroup(func(q *database.Builder) {
+//		q.Where("role", "admin").OrWhere("role", "editor")
+//	})
+//
+// Only the conditions added to q are used.
+func (b *Builder) WhereGroup(fn func(q *Builder)) *Builder {
+	return b.whereGroup("AND", fn)
+}
+
+// OrWhereGroup adds conditions in parentheses, joined with OR.
+func (b *Builder) OrWhereGroup(fn func(q *Builder)) *Builder {
+	return b.whereGroup("OR", fn)
+}
+
+func (b *Builder) whereGroup(boolean string, fn func(q *Builder)) *Builder {
+	q := &Builder{db: b.db, table: b.table, tables: b.tables, aliases: b.aliases}
+	fn(q)
+	if q.err != nil {
+		b.setError(q.err)
+		return b
+	}
+	if len(q.wheres) == 0 {
+		return b
+	}
+	sql, args := q.buildWheres()
+	return b.addRaw(boolean, "("+sql+")", args)
+}
+
+// WhereBetween adds a WHERE column BETWEEN from AND to clause.
+func (b *Builder) WhereBetween(column any, from, to any) *Builder {
+	return b.whereBetween("BETWEEN", column, from, to)
+}
+
+// WhereNotBetween adds a WHERE column NOT BETWEEN from AND to clause.
+func (b *Builder) WhereNotBetween(column any, from, to any) *Builder {
+	return b.whereBetween("NOT BETWEEN", column, from, to)
+}
+
+func (b *Builder) whereBetween(operator string, column any, from, to any) *Builder {
+	col, args := b.column(column, false)
+	return b.addRaw("AND", col+" "+operator+" ? AND ?", append(args, from, to))
+}
+
+// WhereLike adds a clause matching rows where column contains value.
+// The wildcards % and _ in value match themselves, so user input can
+// be passed as is.
+func (b *Builder) WhereLike(column any, value string) *Builder {
+	return b.whereLike("AND", column, value)
+}
+
+// OrWhereLike adds a WhereLike clause joined with OR.
+func (b *Builder) OrWhereLike(column any, value string) *Builder {
+	return b.whereLike("OR", column, value)
+}
+
+// likeEscaper escapes LIKE wildcards with "!", which, unlike a
+// backslash, needs no escaping in any dialect's string literals. "[" is
+// a wildcard in SQL Server.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_", "[", "![")
+
+func (b *Builder) whereLike(boolean string, column any, value string) *Builder {
+	col, args := b.column(column, false)
+	pattern := "%" + likeEscaper.Replace(value) + "%"
+	return b.addRaw(boolean, col+" LIKE ? ESCAPE '!'", append(args, pattern))
+}
+
+// WhereColumn adds a clause comparing two columns:
+//
+//	db.Table("orders").WhereColumn("shipped_at", ">", "due_at")
+func (b *Builder) WhereColumn(first any, operator string, second any) *Builder {
+	op, err := normalizeOperator(operator, comparisonOperators)
+	if err != nil {
+		b.setError(err)
+		return b
+	}
+	col1, args1 := b.column(first, false)
+	col2, args2 := b.column(second, false)
+	return b.addRaw("AND", col1+" "+op+" "+col2, append(args1, args2...))
+}
+
+// WhereExists adds a WHERE EXISTS clause with a subquery:
+//
+//	db.Table("users").WhereExists(
+//		db.Table("orders").Select(database.Raw("1")).WhereColumn("orders.user_id", "=", "users.id"),
+//	)
+func (b *Builder) WhereExists(sub *Builder) *Builder {
+	return b.whereSub("EXISTS", sub)
+}
+
+// WhereNotExists adds a WHERE NOT EXISTS clause with a subquery.
+func (b *Builder) WhereNotExists(sub *Builder) *Builder {
+	return b.whereSub("NOT EXISTS", sub)
+}
+
+func (b *Builder) whereSub(operator string, sub *Builder) *Builder {
+	sql, args := b.subquery(sub)
+	return b.addRaw("AND", operator+" ("+sql+")", args)
+}
+
+// subquery returns the SQL of sub for embedding in b.
+func (b *Builder) subquery(sub *Builder) (string, []any) {
+	if sub.err != nil {
+		b.setError(sub.err)
+		return "", nil
+	}
+	return sub.selectSQL()
+}
+
+// WhereDate adds a clause comparing the date part of column, given as
+// a time.Time or a "2006-01-02" string:
+//
+//	db.Table("orders").WhereDate("created_at", time.Now())
+//	db.Table("orders").WhereDate("created_at", ">=", "2024-01-01")
+func (b *Builder) WhereDate(column any, args ...any) *Builder {
+	operator, value := "=", any(nil)
+	switch len(args) {
+	case 1:
+		value = args[0]
+	case 2:
+		op, _ := args[0].(string)
+		var err error
+		if operator, err = normalizeOperator(op, comparisonOperators); err != nil {
+			b.setError(err)
+			return b
+		}
+		value = args[1]
+	default:
+		b.setError(fmt.Errorf("%w: WhereDate takes 2 or 3 arguments, got %d", ErrInvalidArgument, len(args)+1))
+		return b
+	}
+	if t, ok := value.(time.Time); ok {
+		value = t.Format("2006-01-02")
+	}
+
+	col, colArgs := b.column(column, false)
+	return b.addRaw("AND", b.db.dialect.Date(col)+" "+operator+" ?", append(colArgs, value))
+}
+
+// Union appends the rows of other, without duplicates. OrderBy, Limit
+// and Offset apply to the combined rows and must not be set on other.
+func (b *Builder) Union(other *Builder) *Builder {
+	return b.union(" UNION ", other)
+}
+
+// UnionAll appends all rows of other, see Union.
+func (b *Builder) UnionAll(other *Builder) *Builder {
+	return b.union(" UNION ALL ", other)
+}
+
+func (b *Builder) union(keyword string, other *Builder) *Builder {
+	sql, args := b.subquery(other)
+	b.unions = append(b.unions, unionClause{sql: keyword + sql, args: args})
+	return b
+}
+
+// WhereIn adds a WHERE IN clause. values is a slice or a *Builder
+// selecting a single column.
+func (b *Builder) WhereIn(column any, values any) *Builder {
+	col, colArgs := b.column(column, false)
+	if sub, ok := values.(*Builder); ok {
+		sql, args := b.subquery(sub)
+		return b.addRaw("AND", col+" IN ("+sql+")", append(colArgs, args...))
+	}
 	b.wheres = append(b.wheres, whereClause{
-		column:   column,
-		operator: "NOT IN",
-		value:    values,
-		boolean:  "AND",
+		column:     col,
+		columnArgs: colArgs,
+		operator:   "IN",
+		value:      values,
+		boolean:    "AND",
 	})
 	return b
 }
 
-// WhereNull adds a WHERE IS NULL clause.
-func (b *Builder) WhereNull(column string) *Builder {
+// WhereNotIn adds a WHERE NOT IN clause. values is a slice or a *Builder
+// selecting a single column.
+func (b *Builder) WhereNotIn(column any, values any) *Builder {
+	col, colArgs := b.column(column, false)
+	if sub, ok := values.(*Builder); ok {
+		sql, args := b.subquery(sub)
+		return b.addRaw("AND", col+" NOT IN ("+sql+")", append(colArgs, args...))
+	}
 	b.wheres = append(b.wheres, whereClause{
-		column:   column,
-		operator: "IS NULL",
-		boolean:  "AND",
+		column:     col,
+		columnArgs: colArgs,
+		operator:   "NOT IN",
+		value:      values,
+		boolean:    "AND",
 	})
 	return b
 }
 
-// WhereNotNull adds a WHERE IS NOT NULL clause.
-func (b *Builder) WhereNotNull(column string) *Builder {
+// WhereNull adds a WHERE IS NULL clause.
+func (b *Builder) WhereNull(column any) *Builder {
+	col, colArgs := b.column(column, false)
 	b.wheres = append(b.wheres, whereClause{
-		column:   column,
-		operator: "IS NOT NULL",
-		boolean:  "AND",
+		column:     col,
+		columnArgs: colArgs,
+		operator:   "IS NULL",
+		boolean:    "AND",
 	})
 	return b
 }
 
-// WhereRaw adds a raw WHERE clause.
-func (b *Builder) WhereRaw(sql string, args ...any) *Builder {
+// WhereNotNull adds a WHERE IS NOT NULL clause.
+func (b *Builder) WhereNotNull(column any) *Builder {
+	col, colArgs := b.column(column, false)
 	b.wheres = append(b.wheres, whereClause{
-		isRaw:   true,
-		rawSQL:  sql,
-		value:   args,
-		boolean: "AND",
+		column:     col,
+		columnArgs: colArgs,
+		operator:   "IS NOT NULL",
+		boolean:    "AND",
 	})
 	return b
 }
 
-// OrderBy adds an ORDER BY clause.
-func (b *Builder) OrderBy(column, direction string) *Builder {
+// WhereRaw adds a raw WHERE clause.
+func (b *Builder) WhereRaw(sql string, args ...any) *Builder {
+	return b.addRaw("AND", sql, args)
+}
+
+// OrderBy adds an ORDER BY clause. direction is "asc" or "desc" in any
+// case, or "" for ascending; anything else fails with
+// ErrInvalidDirection. The column may be a Raw expression.
+func (b *Builder) OrderBy(column any, direction string) *Builder {
+	dir := "ASC"
+	if direction != "" {
+		var err error
+		if dir, err = normalizeDirection(direction); err != nil {
+			b.setError(err)
+			return b
+		}
+	}
+	col, args := b.column(column, false)
 	b.orders = append(b.orders, orderClause{
-		column:    column,
-		direction: strings.ToUpper(direction),
+		column:    col,
+		direction: dir,
+		args:      args,
 	})
 	return b
 }
@@ -166,8 +497,14 @@ func (b *Builder) Offset(offset int) *Builder {
 }
 
 // GroupBy sets the GROUP BY clause.
-func (b *Builder) GroupBy(columns ...string) *Builder {
-	b.groupByVal = columns
+func (b *Builder) GroupBy(columns ...any) *Builder {
+	b.groupByVal = nil
+	b.groupByArgs = nil
+	for _, column := range columns {
+		col, args := b.column(column, false)
+		b.groupByVal = append(b.groupByVal, col)
+		b.groupByArgs = append(b.groupByArgs, args...)
+	}
 	return b
 }
 
@@ -180,52 +517,78 @@ func (b *Builder) Having(sql string, args ...any) *Builder {
 
 // Join adds an INNER JOIN clause.
 func (b *Builder) Join(table, col1, operator, col2 string) *Builder {
-	b.joins = append(b.joins, joinClause{
-		joinType: "INNER",
-		table:    table,
-		col1:     col1,
-		operator: operator,
-		col2:     col2,
-	})
-	return b
+	return b.join("INNER", table, col1, operator, col2)
 }
 
 // LeftJoin adds a LEFT JOIN clause.
 func (b *Builder) LeftJoin(table, col1, operator, col2 string) *Builder {
-	b.joins = append(b.joins, joinClause{
-		joinType: "LEFT",
-		table:    table,
-		col1:     col1,
-		operator: operator,
-		col2:     col2,
-	})
-	return b
+	return b.join("LEFT", table, col1, operator, col2)
 }
 
 // RightJoin adds a RIGHT JOIN clause.
 func (b *Builder) RightJoin(table, col1, operator, col2 string) *Builder {
+	return b.join("RIGHT", table, col1, operator, col2)
+}
+
+func (b *Builder) join(joinType, table, col1, operator, col2 string) *Builder {
+	from, _ := b.tableRef(table)
+	op, err := normalizeOperator(operator, comparisonOperators)
+	if err != nil {
+		b.setError(err)
+	}
+	c1, _ := b.column(col1, false)
+	c2, _ := b.column(col2, false)
 	b.joins = append(b.joins, joinClause{
-		joinType: "RIGHT",
-		table:    table,
-		col1:     col1,
-		operator: operator,
-		col2:     col2,
+		joinType: joinType,
+		table:    from,
+		col1:     c1,
+		operator: op,
+		col2:     c2,
 	})
 	return b
 }
 
 // buildSelect builds a SELECT query.
 func (b *Builder) buildSelect() (string, []any) {
-	var args []any
+	query, args := b.selectSQL()
+	return b.db.rebind(query), args
+}
+
+// selectSQL builds the SELECT query with "?" placeholders, as used in
+// subqueries.
+func (b *Builder) selectSQL() (string, []any) {
+	top, limit := b.db.dialect.Limit(b.limitVal, b.offsetVal, len(b.orders) > 0)
+	if len(b.unions) == 0 {
+		query, args := b.selectFrom(top)
+		return b.orderAndLimit(query, args, limit)
+	}
+
+	query, args := b.selectFrom("")
+	for _, u := range b.unions {
+		query += u.sql
+		args = append(args, u.args...)
+	}
+	if len(b.orders) == 0 && b.limitVal == 0 && b.offsetVal == 0 {
+		return query, args
+	}
+	// Order and limit the combined rows.
+	query = "SELECT " + top + "* FROM (" + query + ") AS " + b.db.dialect.Quote("u")
+	return b.orderAndLimit(query, args, limit)
+}
+
+// selectFrom builds the SELECT query up to HAVING.
+func (b *Builder) selectFrom(top string) (string, []any) {
+	args := append([]any(nil), b.columnArgs...)
 	var sql strings.Builder
 
 	// SELECT columns
 	sql.WriteString("SELECT ")
+	sql.WriteString(top)
 	sql.WriteString(strings.Join(b.columns, ", "))
 
 	// FROM table
 	sql.WriteString(" FROM ")
-	sql.WriteString(b.table)
+	sql.WriteString(b.from)
 
 	// JOINs
 	for _, j := range b.joins {
@@ -245,6 +608,7 @@ func (b *Builder) buildSelect() (string, []any) {
 	if len(b.groupByVal) > 0 {
 		sql.WriteString(" GROUP BY ")
 		sql.WriteString(strings.Join(b.groupByVal, ", "))
+		args = append(args, b.groupByArgs...)
 	}
 
 	// HAVING
@@ -254,25 +618,27 @@ func (b *Builder) buildSelect() (string, []any) {
 		args = append(args, b.havingArgs...)
 	}
 
+	return sql.String(), args
+}
+
+// orderAndLimit appends the ORDER BY clause and limit to query.
+func (b *Builder) orderAndLimit(query string, args []any, limit string) (string, []any) {
+	var sql strings.Builder
+	sql.WriteString(query)
+
 	// ORDER BY
 	if len(b.orders) > 0 {
 		sql.WriteString(" ORDER BY ")
 		var orderParts []string
 		for _, o := range b.orders {
 			orderParts = append(orderParts, fmt.Sprintf("%s %s", o.column, o.direction))
+			args = append(args, o.args...)
 		}
 		sql.WriteString(strings.Join(orderParts, ", "))
 	}
 
-	// LIMIT
-	if b.limitVal > 0 {
-		sql.WriteString(fmt.Sprintf(" LIMIT %d", b.limitVal))
-	}
-
-	// OFFSET
-	if b.offsetVal > 0 {
-		sql.WriteString(fmt.Sprintf(" OFFSET %d", b.offsetVal))
-	}
+	// LIMIT and OFFSET
+	sql.WriteString(limit)
 
 	return sql.String(), args
 }
@@ -291,12 +657,20 @@ func (b *Builder) buildWheres() (string, []any) {
 			}
 		} else if w.operator == "IS NULL" || w.operator == "IS NOT NULL" {
 			part = fmt.Sprintf("%s %s", w.column, w.operator)
+			args = append(args, w.columnArgs...)
 		} else if w.operator == "IN" || w.operator == "NOT IN" {
 			placeholders, inArgs := b.buildInClause(w.value)
-			part = fmt.Sprintf("%s %s (%s)", w.column, w.operator, placeholders)
-			args = append(args, inArgs...)
+			if len(inArgs) == 0 {
+				// IN () is invalid: nothing is in an empty list.
+				part = b.db.dialect.Bool(w.operator == "NOT IN")
+			} else {
+				part = fmt.Sprintf("%s %s (%s)", w.column, w.operator, placeholders)
+				args = append(args, w.columnArgs...)
+				args = append(args, inArgs...)
+			}
 		} else {
 			part = fmt.Sprintf("%s %s ?", w.column, w.operator)
+			args = append(args, w.columnArgs...)
 			args = append(args, w.value)
 		}
 
@@ -342,45 +716,55 @@ func (b *Builder) buildInClause(value any) (string, []any) {
 
 // Get executes the query and scans results into dest.
 func (b *Builder) Get(dest any) error {
+	if err := b.invalid(); err != nil {
+		return err
+	}
 	query, args := b.buildSelect()
-	rows, err := b.db.execer().Query(query, args...)
+	err := b.db.query(b.context(), b.table, query, args, func(rows *sql.Rows) error {
+		return scanRows(rows, dest)
+	})
 	if err != nil {
-		b.db.lastError = err
-		return err
+		b.db.setError(err)
 	}
-	defer rows.Close()
-
-	return scanRows(rows, dest)
+	return err
 }
 
 // GetMap executes the query and returns results as []map[string]any.
 func (b *Builder) GetMap() ([]map[string]any, error) {
+	if err := b.invalid(); err != nil {
+		return nil, err
+	}
 	query, args := b.buildSelect()
-	rows, err := b.db.execer().Query(query, args...)
+	var results []map[string]any
+	err := b.db.query(b.context(), b.table, query, args, func(rows *sql.Rows) (err error) {
+		results, err = scanRowsToMap(rows)
+		return err
+	})
 	if err != nil {
-		b.db.lastError = err
+		b.db.setError(err)
 		return nil, err
 	}
-	defer rows.Close()
-
-	return scanRowsToMap(rows)
+	return results, nil
 }
 
 // First gets the first result into a single struct.
 func (b *Builder) First(dest any) error {
-	query, args := b.buildSelect()
+	if err := b.invalid(); err != nil {
+		return err
+	}
 	// Add LIMIT 1 if not already set
 	if b.limitVal == 0 {
-		query += " LIMIT 1"
+		b.limitVal = 1
+		defer func() { b.limitVal = 0 }()
 	}
-	rows, err := b.db.execer().Query(query, args...)
+	query, args := b.buildSelect()
+	err := b.db.query(b.context(), b.table, query, args, func(rows *sql.Rows) error {
+		return scanRow(rows, dest)
+	})
 	if err != nil {
-		b.db.lastError = err
-		return err
+		b.db.setError(err)
 	}
-	defer rows.Close()
-
-	return scanRow(rows, dest)
+	return err
 }
 
 // FirstMap gets the first result as map.
@@ -396,149 +780,183 @@ func (b *Builder) FirstMap() (map[string]any, error) {
 	return results[0], nil
 }
 
-// Count returns the count of rows.
+// Count returns the count of rows, ignoring OrderBy, Limit and Offset.
+// Grouped and combined queries count their resulting rows.
 func (b *Builder) Count() (int64, error) {
-	// Save original columns
-	originalColumns := b.columns
-	b.columns = []string{"COUNT(*) as count"}
-	query, args := b.buildSelect()
-	// Restore columns
-	b.columns = originalColumns
+	if err := b.invalid(); err != nil {
+		return 0, err
+	}
+
+	var query string
+	var args []any
+	if len(b.groupByVal) > 0 || len(b.unions) > 0 {
+		query, args = b.unordered(func() (string, []any) {
+			sql, args := b.selectSQL()
+			return "SELECT COUNT(*) as count FROM (" + sql + ") AS " + b.db.dialect.Quote("t"), args
+		})
+	} else {
+		query, args = b.selectColumn("COUNT(*) as count", nil)
+	}
+	query = b.db.rebind(query)
 
 	var count int64
-	err := b.db.execer().QueryRow(query, args...).Scan(&count)
+	err := b.db.queryRow(b.context(), b.table, query, args, &count)
 	if err != nil {
-		b.db.lastError = err
+		b.db.setError(err)
 		return 0, err
 	}
 	return count, nil
 }
 
 // Sum returns the sum of a column.
-func (b *Builder) Sum(column string) (float64, error) {
-	originalColumns := b.columns
-	b.columns = []string{fmt.Sprintf("COALESCE(SUM(%s), 0) as sum", column)}
-	query, args := b.buildSelect()
-	b.columns = originalColumns
-
-	var sum float64
-	err := b.db.execer().QueryRow(query, args...).Scan(&sum)
-	if err != nil {
-		b.db.lastError = err
-		return 0, err
-	}
-	return sum, nil
+func (b *Builder) Sum(column any) (float64, error) {
+	return b.aggregate("COALESCE(SUM(%s), 0) as sum", column)
 }
 
 // Avg returns the average of a column.
-func (b *Builder) Avg(column string) (float64, error) {
-	originalColumns := b.columns
-	b.columns = []string{fmt.Sprintf("COALESCE(AVG(%s), 0) as avg", column)}
-	query, args := b.buildSelect()
-	b.columns = originalColumns
-
-	var avg float64
-	err := b.db.execer().QueryRow(query, args...).Scan(&avg)
-	if err != nil {
-		b.db.lastError = err
-		return 0, err
-	}
-	return avg, nil
+func (b *Builder) Avg(column any) (float64, error) {
+	return b.aggregate("COALESCE(AVG(%s), 0) as avg", column)
 }
 
 // Min returns the minimum value of a column.
-func (b *Builder) Min(column string) (float64, error) {
-	originalColumns := b.columns
-	b.columns = []string{fmt.Sprintf("MIN(%s) as min", column)}
-	query, args := b.buildSelect()
-	b.columns = originalColumns
+func (b *Builder) Min(column any) (float64, error) {
+	return b.aggregate("MIN(%s) as min", column)
+}
 
-	var min float64
-	err := b.db.execer().QueryRow(query, args...).Scan(&min)
-	if err != nil {
-		b.db.lastError = err
+// Max returns the maximum value of a column.
+func (b *Builder) Max(column any) (float64, error) {
+	return b.aggregate("MAX(%s) as max", column)
+}
+
+// aggregate selects format applied to column and returns the result.
+func (b *Builder) aggregate(format string, column any) (float64, error) {
+	col, colArgs := b.column(column, false)
+	if err := b.invalid(); err != nil {
 		return 0, err
 	}
-	return min, nil
-}
 
-// Max returns the maximum value of a column.
-func (b *Builder) Max(column string) (float64, error) {
-	originalColumns := b.columns
-	b.columns = []string{fmt.Sprintf("MAX(%s) as max", column)}
-	query, args := b.buildSelect()
-	b.columns = originalColumns
+	query, args := b.selectColumn(fmt.Sprintf(format, col), colArgs)
+	query = b.db.rebind(query)
 
-	var max float64
-	err := b.db.execer().QueryRow(query, args...).Scan(&max)
+	var result float64
+	err := b.db.queryRow(b.context(), b.table, query, args, &result)
 	if err != nil {
-		b.db.lastError = err
+		b.db.setError(err)
 		return 0, err
 	}
-	return max, nil
+	return result, nil
 }
 
-// Insert inserts a new row.
-func (b *Builder) Insert(data map[string]any) error {
-	var columns []string
-	var placeholders []string
-	var args []any
+// selectColumn builds the query selecting only column, without order
+// and limit.
+func (b *Builder) selectColumn(column string, args []any) (string, []any) {
+	return b.unordered(func() (string, []any) {
+		originalColumns, originalArgs := b.columns, b.columnArgs
+		b.columns, b.columnArgs = []string{column}, args
+		defer func() { b.columns, b.columnArgs = originalColumns, originalArgs }()
+		return b.selectSQL()
+	})
+}
 
-	for col, val := range data {
+// unordered calls build with OrderBy, Limit and Offset cleared.
+func (b *Builder) unordered(build func() (string, []any)) (string, []any) {
+	orders, limit, offset := b.orders, b.limitVal, b.offsetVal
+	b.orders, b.limitVal, b.offsetVal = nil, 0, 0
+	defer func() { b.orders, b.limitVal, b.offsetVal = orders, limit, offset }()
+	return build()
+}
+
+// sortedColumns returns the keys of data in order, so statements built
+// from maps are the same on every call.
+func sortedColumns(data map[string]any) []string {
+	columns := make([]string, 0, len(data))
+	for col := range data {
 		columns = append(columns, col)
-		placeholders = append(placeholders, "?")
-		args = append(args, val)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// buildInsert builds an INSERT query. output and returning come from
+// Dialect.InsertID.
+func (b *Builder) buildInsert(data map[string]any, output, returning string) (string, []any) {
+	columns := sortedColumns(data)
+	placeholders := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, col := range columns {
+		columns[i], _ = b.column(col, false)
+		placeholders[i] = "?"
+		args[i] = data[col]
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-		b.table,
+	query := fmt.Sprintf("INSERT INTO %s (%s)%s VALUES (%s)%s",
+		b.from,
 		strings.Join(columns, ", "),
-		strings.Join(placeholders, ", "))
+		output,
+		strings.Join(placeholders, ", "),
+		returning)
+	return b.db.rebind(query), args
+}
 
-	_, err := b.db.execer().Exec(query, args...)
+// Insert inserts a new row.
+func (b *Builder) Insert(data map[string]any) error {
+	query, args := b.buildInsert(data, "", "")
+	if err := b.invalid(); err != nil {
+		return err
+	}
+	_, err := b.db.exec(b.context(), b.table, query, args...)
 	if err != nil {
-		b.db.lastError = err
+		b.db.setError(err)
 	}
 	return err
 }
 
-// InsertGetId inserts a new row and returns the last insert ID.
+// InsertGetId inserts a new row and returns the last insert ID. On
+// databases without LastInsertId, such as PostgreSQL, the ID is read
+// back from the "id" column.
 func (b *Builder) InsertGetId(data map[string]any) (int64, error) {
-	var columns []string
-	var placeholders []string
-	var args []any
-
-	for col, val := range data {
-		columns = append(columns, col)
-		placeholders = append(placeholders, "?")
-		args = append(args, val)
+	output, returning := b.db.dialect.InsertID("id")
+	query, args := b.buildInsert(data, output, returning)
+	if err := b.invalid(); err != nil {
+		return 0, err
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-		b.table,
-		strings.Join(columns, ", "),
-		strings.Join(placeholders, ", "))
+	if output != "" || returning != "" {
+		var id int64
+		err := b.db.queryRow(b.context(), b.table, query, args, &id)
+		if err != nil {
+			b.db.setError(err)
+			return 0, err
+		}
+		return id, nil
+	}
 
-	result, err := b.db.execer().Exec(query, args...)
+	result, err := b.db.exec(b.context(), b.table, query, args...)
 	if err != nil {
-		b.db.lastError = err
+		b.db.setError(err)
 		return 0, err
 	}
 
 	return result.LastInsertId()
 }
 
-// Update updates rows.
-func (b *Builder) Update(data map[string]any) error {
+// buildUpdate builds an UPDATE query. Values may be Raw expressions.
+func (b *Builder) buildUpdate(data map[string]any) (string, []any) {
 	var setParts []string
 	var args []any
 
-	for col, val := range data {
-		setParts = append(setParts, fmt.Sprintf("%s = ?", col))
-		args = append(args, val)
+	for _, col := range sortedColumns(data) {
+		quoted, _ := b.column(col, false)
+		if e, ok := data[col].(Expr); ok {
+			setParts = append(setParts, fmt.Sprintf("%s = %s", quoted, e.SQL))
+			args = append(args, e.Args...)
+			continue
+		}
+		setParts = append(setParts, fmt.Sprintf("%s = ?", quoted))
+		args = append(args, data[col])
 	}
 
-	query := fmt.Sprintf("UPDATE %s SET %s", b.table, strings.Join(setParts, ", "))
+	query := fmt.Sprintf("UPDATE %s SET %s", b.from, strings.Join(setParts, ", "))
 
 	if len(b.wheres) > 0 {
 		whereSQL, whereArgs := b.buildWheres()
@@ -546,16 +964,29 @@ func (b *Builder) Update(data map[string]any) error {
 		args = append(args, whereArgs...)
 	}
 
-	_, err := b.db.execer().Exec(query, args...)
+	return b.db.rebind(query), args
+}
+
+// Update updates rows. Values may be Raw expressions:
+//
+//	db.Table("products").Where("id", id).Update(map[string]any{
+//		"stock": database.Raw("stock - ?", qty),
+//	})
+func (b *Builder) Update(data map[string]any) error {
+	query, args := b.buildUpdate(data)
+	if err := b.invalid(); err != nil {
+		return err
+	}
+	_, err := b.db.exec(b.context(), b.table, query, args...)
 	if err != nil {
-		b.db.lastError = err
+		b.db.setError(err)
 	}
 	return err
 }
 
-// Delete deletes rows.
-func (b *Builder) Delete() error {
-	query := fmt.Sprintf("DELETE FROM %s", b.table)
+// buildDelete builds a DELETE query.
+func (b *Builder) buildDelete() (string, []any) {
+	query := fmt.Sprintf("DELETE FROM %s", b.from)
 	var args []any
 
 	if len(b.wheres) > 0 {
@@ -564,15 +995,28 @@ func (b *Builder) Delete() error {
 		args = whereArgs
 	}
 
-	_, err := b.db.execer().Exec(query, args...)
+	return b.db.rebind(query), args
+}
+
+// Delete deletes rows.
+func (b *Builder) Delete() error {
+	query, args := b.buildDelete()
+	if err := b.invalid(); err != nil {
+		return err
+	}
+	_, err := b.db.exec(b.context(), b.table, query, args...)
 	if err != nil {
-		b.db.lastError = err
+		b.db.setError(err)
 	}
 	return err
 }
 
-// ToSQL returns the SQL query string (for debugging).
+// ToSQL returns the SQL query string (for debugging). It returns "" for
+// an invalid query; running it returns the error.
 func (b *Builder) ToSQL() string {
+	if b.err != nil {
+		return ""
+	}
 	query, _ := b.buildSelect()
 	return query
 }
@@ -2,19 +2,36 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/semutdev/goigniter/system/core"
 	"github.com/semutdev/goigniter/system/libraries/database/drivers"
+	"github.com/semutdev/goigniter/system/libraries/tracing"
 )
 
 // DB represents a database connection with query builder capabilities.
 type DB struct {
-	conn       *sql.DB
-	driver     drivers.Driver
-	lastError  error
-	tx         *sql.Tx
+	conn          *sql.DB
+	driver        drivers.Driver
+	dialect       drivers.Dialect
+	lastError     *errorState
+	columns       *columnWhitelist
+	tx            *sql.Tx
 	inTransaction bool
+	ctx           context.Context
+	hooks         []QueryHook
+}
+
+// errorState holds the last error, shared by a DB and its WithContext
+// copies.
+type errorState struct {
+	mu  sync.Mutex
+	err error
 }
 
 // global default instance
@@ -33,8 +50,11 @@ func Open(driverName, dsn string) (*DB, error) {
 	}
 
 	return &DB{
-		conn:   conn,
-		driver: driver,
+		conn:      conn,
+		driver:    driver,
+		dialect:   drivers.DialectOf(driver),
+		lastError: &errorState{},
+		columns:   &columnWhitelist{},
 	}, nil
 }
 
@@ -48,6 +68,33 @@ func Default() *DB {
 	return defaultDB
 }
 
+// WithContext returns a copy of db whose queries run with ctx, so they
+// are cancelled with it and traced as children of its span:
+//
+//	db.WithContext(c.Context()).Table("users").Get(&users)
+func (db *DB) WithContext(ctx context.Context) *DB {
+	clone := *db
+	clone.ctx = ctx
+	return &clone
+}
+
+// For returns a copy of db bound to the request's context, as WithContext
+// does, so the request's queries are cancelled with it, traced under its
+// span and seen by request-scoped hooks such as the query counter:
+//
+//	db.For(c).Table("users").Get(&users)
+func (db *DB) For(c *core.Context) *DB {
+	return db.WithContext(c.Context())
+}
+
+// For returns the default database bound to the request's context.
+func For(c *core.Context) *DB {
+	if defaultDB == nil {
+		panic("database: no default database set, call SetDefault() first")
+	}
+	return defaultDB.For(c)
+}
+
 // Table starts a new query builder for the given table.
 func (db *DB) Table(name string) *Builder {
 	return newBuilder(db, name)
@@ -80,10 +127,7 @@ func Query(query string, args ...any) *RawResult {
 
 // Exec executes a raw SQL statement (INSERT, UPDATE, DELETE).
 func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
-	if db.inTransaction && db.tx != nil {
-		return db.tx.Exec(query, args...)
-	}
-	return db.conn.Exec(query, args...)
+	return db.exec(db.context(), "", query, args...)
 }
 
 // Exec executes a raw SQL statement using the default database.
@@ -96,7 +140,7 @@ func Exec(query string, args ...any) (sql.Result, error) {
 
 // Begin starts a new transaction.
 func (db *DB) Begin() (*DB, error) {
-	tx, err := db.conn.Begin()
+	tx, err := db.conn.BeginTx(db.context(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("database: failed to begin transaction: %w", err)
 	}
@@ -104,8 +148,13 @@ func (db *DB) Begin() (*DB, error) {
 	return &DB{
 		conn:          db.conn,
 		driver:        db.driver,
+		dialect:       db.dialect,
+		lastError:     &errorState{},
+		columns:       db.columns,
 		tx:            tx,
 		inTransaction: true,
+		ctx:           db.ctx,
+		hooks:         db.hooks,
 	}, nil
 }
 
@@ -159,9 +208,19 @@ func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
-// Error returns the last error.
+// Error returns the last error. It is shared by every request using db,
+// so prefer the errors returned by each call; use hooks (see AddHook) to
+// observe failures.
 func (db *DB) Error() error {
-	return db.lastError
+	db.lastError.mu.Lock()
+	defer db.lastError.mu.Unlock()
+	return db.lastError.err
+}
+
+func (db *DB) setError(err error) {
+	db.lastError.mu.Lock()
+	db.lastError.err = err
+	db.lastError.mu.Unlock()
 }
 
 // Conn returns the underlying sql.DB connection.
@@ -174,14 +233,147 @@ func (db *DB) Driver() drivers.Driver {
 	return db.driver
 }
 
+// Dialect returns the SQL dialect the query builder generates.
+func (db *DB) Dialect() drivers.Dialect {
+	return db.dialect
+}
+
+// rebind replaces the "?" placeholders of a builder query with the
+// dialect's, skipping quoted strings and identifiers.
+func (db *DB) rebind(query string) string {
+	if db.dialect.Placeholder(1) == "?" || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var sb strings.Builder
+	index := 1
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '?':
+			sb.WriteString(db.dialect.Placeholder(index))
+			index++
+			continue
+		}
+		sb.WriteByte(ch)
+	}
+	return sb.String()
+}
+
 // execer returns the appropriate executor (tx or conn)
 func (db *DB) execer() interface {
-	Exec(query string, args ...any) (sql.Result, error)
-	Query(query string, args ...any) (*sql.Rows, error)
-	QueryRow(query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 } {
 	if db.inTransaction && db.tx != nil {
 		return db.tx
 	}
 	return db.conn
 }
+
+// context returns the context set with WithContext, or Background.
+func (db *DB) context() context.Context {
+	if db.ctx != nil {
+		return db.ctx
+	}
+	return context.Background()
+}
+
+// query, queryRow and exec run every statement, recording a client span
+// for it when ctx is part of a trace and reporting it to the hooks.
+//
+// query hands the rows to scan and closes them before the hooks run, so
+// the statement's duration includes reading the results.
+func (db *DB) query(ctx context.Context, table, query string, args []any, scan func(*sql.Rows) error) error {
+	ctx, e := db.before(ctx, table, query, args)
+	rows, err := db.execer().QueryContext(ctx, query, args...)
+	if err == nil {
+		err = scan(rows)
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+		}
+	}
+	db.after(ctx, e, nil, err)
+	return err
+}
+
+func (db *DB) queryRow(ctx context.Context, table, query string, args []any, dest ...any) error {
+	ctx, e := db.before(ctx, table, query, args)
+	err := db.execer().QueryRowContext(ctx, query, args...).Scan(dest...)
+	db.after(ctx, e, nil, err)
+	return err
+}
+
+func (db *DB) exec(ctx context.Context, table, query string, args ...any) (sql.Result, error) {
+	ctx, e := db.before(ctx, table, query, args)
+	result, err := db.execer().ExecContext(ctx, query, args...)
+	db.after(ctx, e, result, err)
+	return result, err
+}
+
+func (db *DB) before(ctx context.Context, table, query string, args []any) (context.Context, *QueryEvent) {
+	e := &QueryEvent{
+		Table:        table,
+		SQL:          query,
+		Args:         args,
+		Start:        time.Now(),
+		RowsAffected: -1,
+		db:           db,
+	}
+
+	// Name spans "SELECT users" rather than by the full statement.
+	op, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	name := strings.ToUpper(op)
+	if table != "" {
+		name += " " + table
+	}
+	// Statements outside a traced operation, e.g. of a DB not bound with
+	// For or WithContext, would each start a trace of their own.
+	if tracing.SpanContextFromContext(ctx).IsValid() {
+		ctx, e.span = tracing.Start(ctx, name, tracing.SpanKindClient)
+	}
+	if e.span != nil {
+		e.span.SetAttribute("db.system", db.driver.Name())
+		e.span.SetAttribute("db.statement", query)
+		if table != "" {
+			e.span.SetAttribute("db.sql.table", table)
+		}
+	}
+
+	for _, h := range db.hooks {
+		ctx = h.BeforeQuery(ctx, e)
+	}
+	return ctx, e
+}
+
+func (db *DB) after(ctx context.Context, e *QueryEvent, result sql.Result, err error) {
+	e.Duration = time.Since(e.Start)
+	e.Err = err
+	if result != nil && err == nil {
+		if n, rerr := result.RowsAffected(); rerr == nil {
+			e.RowsAffected = n
+		}
+	}
+
+	if e.failed() {
+		e.span.RecordError(err)
+	}
+	e.span.End()
+
+	for i := len(db.hooks) - 1; i >= 0; i-- {
+		db.hooks[i].AfterQuery(ctx, e)
+	}
+	if hooks := queryHooks.Load(); hooks != nil {
+		for _, hook := range *hooks {
+			hook(ctx, *e)
+		}
+	}
+}
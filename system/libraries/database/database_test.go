@@ -1,8 +1,21 @@
 package database
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/semutdev/goigniter/system/core"
+	"github.com/semutdev/goigniter/system/libraries/database/drivers"
 )
 
 type User struct {
@@ -404,8 +417,1145 @@ func TestToSQL(t *testing.T) {
 		Limit(10).
 		ToSQL()
 
-	expected := "SELECT id, name FROM users WHERE status = ? ORDER BY name ASC LIMIT 10"
+	expected := `SELECT "id", "name" FROM "users" WHERE "status" = ? ORDER BY "name" ASC LIMIT 10`
 	if sql != expected {
 		t.Errorf("Expected SQL:\n%s\nGot:\n%s", expected, sql)
 	}
 }
+
+var testDialects = []struct {
+	name    string
+	dialect drivers.Dialect
+}{
+	{"sqlite", drivers.SQLiteDialect{}},
+	{"mysql", drivers.MySQLDialect{}},
+	{"postgres", drivers.PostgresDialect{}},
+	{"sqlserver", drivers.SQLServerDialect{}},
+}
+
+// TestDialects compares the SQL generated for each dialect with golden
+// statements.
+func TestDialects(t *testing.T) {
+	cases := []struct {
+		name  string
+		build func(b *Builder) (string, []any)
+		want  map[string]string
+	}{
+		{
+			name: "select",
+			build: func(b *Builder) (string, []any) {
+				return b.Select("id", "name").Where("status", "active").WhereIn("id", []int{1, 2}).
+					OrderBy("name", "asc").Limit(10).Offset(20).buildSelect()
+			},
+			want: map[string]string{
+				"sqlite":    `SELECT "id", "name" FROM "users" WHERE "status" = ? AND "id" IN (?, ?) ORDER BY "name" ASC LIMIT 10 OFFSET 20`,
+				"mysql":     "SELECT `id`, `name` FROM `users` WHERE `status` = ? AND `id` IN (?, ?) ORDER BY `name` ASC LIMIT 10 OFFSET 20",
+				"postgres":  `SELECT "id", "name" FROM "users" WHERE "status" = $1 AND "id" IN ($2, $3) ORDER BY "name" ASC LIMIT 10 OFFSET 20`,
+				"sqlserver": "SELECT [id], [name] FROM [users] WHERE [status] = @p1 AND [id] IN (@p2, @p3) ORDER BY [name] ASC OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY",
+			},
+		},
+		{
+			name: "limit",
+			build: func(b *Builder) (string, []any) {
+				return b.Where("status", "active").Limit(5).buildSelect()
+			},
+			want: map[string]string{
+				"sqlite":    `SELECT * FROM "users" WHERE "status" = ? LIMIT 5`,
+				"mysql":     "SELECT * FROM `users` WHERE `status` = ? LIMIT 5",
+				"postgres":  `SELECT * FROM "users" WHERE "status" = $1 LIMIT 5`,
+				"sqlserver": "SELECT TOP (5) * FROM [users] WHERE [status] = @p1",
+			},
+		},
+		{
+			name: "offset",
+			build: func(b *Builder) (string, []any) {
+				return b.Offset(5).buildSelect()
+			},
+			want: map[string]string{
+				"sqlite":    `SELECT * FROM "users" LIMIT -1 OFFSET 5`,
+				"mysql":     "SELECT * FROM `users` LIMIT 18446744073709551615 OFFSET 5",
+				"postgres":  `SELECT * FROM "users" OFFSET 5`,
+				"sqlserver": "SELECT * FROM [users] ORDER BY (SELECT NULL) OFFSET 5 ROWS",
+			},
+		},
+		{
+			name: "empty in",
+			build: func(b *Builder) (string, []any) {
+				return b.WhereIn("id", []int{}).WhereNotIn("id", []string{}).buildSelect()
+			},
+			want: map[string]string{
+				"sqlite":    `SELECT * FROM "users" WHERE FALSE AND TRUE`,
+				"mysql":     "SELECT * FROM `users` WHERE FALSE AND TRUE",
+				"postgres":  `SELECT * FROM "users" WHERE FALSE AND TRUE`,
+				"sqlserver": "SELECT * FROM [users] WHERE 1 = 0 AND 1 = 1",
+			},
+		},
+		{
+			name: "raw",
+			build: func(b *Builder) (string, []any) {
+				return b.WhereRaw(`note <> '?' AND "a?" = ? AND score > ?`, 1, 2).buildSelect()
+			},
+			want: map[string]string{
+				"sqlite":    `SELECT * FROM "users" WHERE note <> '?' AND "a?" = ? AND score > ?`,
+				"mysql":     "SELECT * FROM `users` WHERE note <> '?' AND \"a?\" = ? AND score > ?",
+				"postgres":  `SELECT * FROM "users" WHERE note <> '?' AND "a?" = $1 AND score > $2`,
+				"sqlserver": `SELECT * FROM [users] WHERE note <> '?' AND "a?" = @p1 AND score > @p2`,
+			},
+		},
+		{
+			name: "insert",
+			build: func(b *Builder) (string, []any) {
+				output, returning := b.db.dialect.InsertID("id")
+				return b.buildInsert(map[string]any{"name": "John", "email": "john@test.com"}, output, returning)
+			},
+			want: map[string]string{
+				"sqlite":    `INSERT INTO "users" ("email", "name") VALUES (?, ?)`,
+				"mysql":     "INSERT INTO `users` (`email`, `name`) VALUES (?, ?)",
+				"postgres":  `INSERT INTO "users" ("email", "name") VALUES ($1, $2) RETURNING "id"`,
+				"sqlserver": "INSERT INTO [users] ([email], [name]) OUTPUT INSERTED.[id] VALUES (@p1, @p2)",
+			},
+		},
+		{
+			name: "update",
+			build: func(b *Builder) (string, []any) {
+				return b.Where("id", 1).buildUpdate(map[string]any{"name": "John", "email": "john@test.com"})
+			},
+			want: map[string]string{
+				"sqlite":    `UPDATE "users" SET "email" = ?, "name" = ? WHERE "id" = ?`,
+				"mysql":     "UPDATE `users` SET `email` = ?, `name` = ? WHERE `id` = ?",
+				"postgres":  `UPDATE "users" SET "email" = $1, "name" = $2 WHERE "id" = $3`,
+				"sqlserver": "UPDATE [users] SET [email] = @p1, [name] = @p2 WHERE [id] = @p3",
+			},
+		},
+		{
+			name: "delete",
+			build: func(b *Builder) (string, []any) {
+				return b.Where("id", 1).buildDelete()
+			},
+			want: map[string]string{
+				"sqlite":    `DELETE FROM "users" WHERE "id" = ?`,
+				"mysql":     "DELETE FROM `users` WHERE `id` = ?",
+				"postgres":  `DELETE FROM "users" WHERE "id" = $1`,
+				"sqlserver": "DELETE FROM [users] WHERE [id] = @p1",
+			},
+		},
+	}
+
+	for _, d := range testDialects {
+		db := &DB{dialect: d.dialect, lastError: &errorState{}}
+		for _, tc := range cases {
+			got, _ := tc.build(db.Table("users"))
+			if got != tc.want[d.name] {
+				t.Errorf("%s %s:\nwant %s\ngot  %s", d.name, tc.name, tc.want[d.name], got)
+			}
+		}
+	}
+}
+
+func TestDialectUpsert(t *testing.T) {
+	want := map[string][2]string{
+		"sqlite": {
+			`INSERT INTO "app"."users" ("id", "name", "email") VALUES (?, ?, ?), (?, ?, ?) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "email" = EXCLUDED."email"`,
+			`INSERT INTO "users" ("id", "name") VALUES (?, ?) ON CONFLICT ("id") DO NOTHING`,
+		},
+		"mysql": {
+			"INSERT INTO `app`.`users` (`id`, `name`, `email`) VALUES (?, ?, ?), (?, ?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `email` = VALUES(`email`)",
+			"INSERT INTO `users` (`id`, `name`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `id` = `id`",
+		},
+		"postgres": {
+			`INSERT INTO "app"."users" ("id", "name", "email") VALUES ($1, $2, $3), ($4, $5, $6) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "email" = EXCLUDED."email"`,
+			`INSERT INTO "users" ("id", "name") VALUES ($1, $2) ON CONFLICT ("id") DO NOTHING`,
+		},
+		"sqlserver": {
+			"MERGE INTO [app].[users] WITH (HOLDLOCK) AS target USING (VALUES (@p1, @p2, @p3), (@p4, @p5, @p6)) AS source ([id], [name], [email]) " +
+				"ON target.[id] = source.[id] WHEN MATCHED THEN UPDATE SET target.[name] = source.[name], target.[email] = source.[email] " +
+				"WHEN NOT MATCHED THEN INSERT ([id], [name], [email]) VALUES (source.[id], source.[name], source.[email]);",
+			"MERGE INTO [users] WITH (HOLDLOCK) AS target USING (VALUES (@p1, @p2)) AS source ([id], [name]) ON target.[id] = source.[id] " +
+				"WHEN NOT MATCHED THEN INSERT ([id], [name]) VALUES (source.[id], source.[name]);",
+		},
+	}
+
+	for _, d := range testDialects {
+		got := d.dialect.Upsert(d.dialect.Quote("app")+"."+d.dialect.Quote("users"), []string{"id", "name", "email"}, 2, []string{"id"}, []string{"name", "email"})
+		if got != want[d.name][0] {
+			t.Errorf("%s upsert:\nwant %s\ngot  %s", d.name, want[d.name][0], got)
+		}
+		got = d.dialect.Upsert(d.dialect.Quote("users"), []string{"id", "name"}, 1, []string{"id"}, nil)
+		if got != want[d.name][1] {
+			t.Errorf("%s upsert without update:\nwant %s\ngot  %s", d.name, want[d.name][1], got)
+		}
+	}
+
+	quoted := map[string]string{"sqlite": `"a""b"`, "mysql": "`a\"b`", "postgres": `"a""b"`, "sqlserver": `[a"b]`}
+	for _, d := range testDialects {
+		if got := d.dialect.Quote(`a"b`); got != quoted[d.name] {
+			t.Errorf("%s: expected %s, got %s", d.name, quoted[d.name], got)
+		}
+	}
+	if got := (drivers.MySQLDialect{}).Quote("a`b"); got != "`a``b`" {
+		t.Errorf("Expected escaped backtick, got %s", got)
+	}
+	if got := (drivers.SQLServerDialect{}).Quote("a]b"); got != "[a]]b]" {
+		t.Errorf("Expected escaped bracket, got %s", got)
+	}
+}
+
+type colonDriver struct{ drivers.Driver }
+
+func (colonDriver) Placeholder(index int) string { return fmt.Sprintf(":%d", index) }
+
+func TestDialectOf(t *testing.T) {
+	sqlite, _ := drivers.Get("sqlite")
+	if _, ok := drivers.DialectOf(sqlite).(drivers.SQLiteDialect); !ok {
+		t.Error("Expected the SQLite driver to provide its dialect")
+	}
+
+	// Drivers without a dialect keep their placeholders.
+	d := drivers.DialectOf(colonDriver{})
+	if d.Placeholder(2) != ":2" || d.Quote("id") != `"id"` {
+		t.Errorf("Unexpected fallback dialect %s %s", d.Placeholder(2), d.Quote("id"))
+	}
+
+	drivers.Register("pgtest", drivers.NewDriver("pgtest", "sqlite", drivers.PostgresDialect{}))
+	db, err := Open("pgtest", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.Driver().Name() != "pgtest" || db.Driver().Placeholder(1) != "$1" {
+		t.Errorf("Unexpected driver %s", db.Driver().Name())
+	}
+	db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)")
+	// SQLite understands $N and RETURNING too.
+	id, err := db.Table("users").InsertGetId(map[string]any{"name": "John"})
+	if err != nil || id != 1 {
+		t.Fatalf("Expected id 1 from RETURNING, got %d %v", id, err)
+	}
+	count, err := db.Table("users").Where("name", "John").Count()
+	if err != nil || count != 1 {
+		t.Errorf("Expected rebound query to run, got %d %v", count, err)
+	}
+}
+
+func TestOffsetAndEmptyIn(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.Table("users").Insert(map[string]any{"name": "John", "email": "john@test.com"})
+	db.Table("users").Insert(map[string]any{"name": "Jane", "email": "jane@test.com"})
+
+	rows, err := db.Table("users").OrderBy("id", "asc").Offset(1).GetMap()
+	if err != nil || len(rows) != 1 || rows[0]["name"] != "Jane" {
+		t.Errorf("Expected offset without limit to work, got %v %v", rows, err)
+	}
+	rows, err = db.Table("users").WhereIn("id", []int{}).GetMap()
+	if err != nil || len(rows) != 0 {
+		t.Errorf("Expected no rows for empty IN, got %v %v", rows, err)
+	}
+	count, err := db.Table("users").WhereNotIn("id", []int{}).Count()
+	if err != nil || count != 2 {
+		t.Errorf("Expected all rows for empty NOT IN, got %d %v", count, err)
+	}
+}
+
+func TestIdentifierQuoting(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	got := db.Table("users u").
+		Select("u.id", "u.name AS author", "o.*").
+		LeftJoin("orders AS o", "o.user_id", "=", "u.id").
+		Where("u.status", "like", "act%").
+		GroupBy("u.id").
+		OrderBy("author", "desc").
+		ToSQL()
+	want := `SELECT "u"."id", "u"."name" AS "author", "o".* FROM "users" AS "u" LEFT JOIN "orders" AS "o" ON "o"."user_id" = "u"."id" ` +
+		`WHERE "u"."status" LIKE ? GROUP BY "u"."id" ORDER BY "author" DESC`
+	if got != want {
+		t.Errorf("Expected SQL:\n%s\nGot:\n%s", want, got)
+	}
+
+	mysql := &DB{dialect: drivers.MySQLDialect{}, lastError: &errorState{}}
+	if got := mysql.Table("app.users").Select("users.id").ToSQL(); got != "SELECT `users`.`id` FROM `app`.`users`" {
+		t.Errorf("Unexpected MySQL quoting %s", got)
+	}
+}
+
+func TestIdentifierInjection(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.Table("users").Insert(map[string]any{"name": "John", "email": "john@test.com"})
+
+	var users []User
+	cases := []struct {
+		name string
+		run  func() error
+		want error
+	}{
+		{"order column", func() error { return db.Table("users").OrderBy("name; DROP TABLE users", "asc").Get(&users) }, ErrInvalidIdentifier},
+		{"order direction", func() error { return db.Table("users").OrderBy("name", "asc; DROP TABLE users").Get(&users) }, ErrInvalidDirection},
+		{"operator", func() error { return db.Table("users").Where("id", "= 1 OR 1 = 1 --", 2).Get(&users) }, ErrInvalidOperator},
+		{"operator type", func() error { return db.Table("users").Where("id", 1, 2).Get(&users) }, ErrInvalidOperator},
+		{"column type", func() error { return db.Table("users").Where(1, 2).Get(&users) }, ErrInvalidIdentifier},
+		{"select", func() error { return db.Table("users").Select("(SELECT 1) AS x").Get(&users) }, ErrInvalidIdentifier},
+		{"quoted", func() error { return db.Table("users").Select(`"name"`).Get(&users) }, ErrInvalidIdentifier},
+		{"where alias", func() error { return db.Table("users").Where("name x", 1).Get(&users) }, ErrInvalidIdentifier},
+		{"group", func() error { return db.Table("users").GroupBy("1 = 1").Get(&users) }, ErrInvalidIdentifier},
+		{"table", func() error { return db.Table("users; DROP TABLE users").Get(&users) }, ErrInvalidIdentifier},
+		{"join operator", func() error {
+			return db.Table("users").Join("orders", "orders.user_id", "= 1 OR", "users.id").Get(&users)
+		}, ErrInvalidOperator},
+		{"aggregate", func() error { _, err := db.Table("users").Sum("id) FROM users --"); return err }, ErrInvalidIdentifier},
+		{"count", func() error { _, err := db.Table("users").OrderBy("id", "sideways").Count(); return err }, ErrInvalidDirection},
+		{"insert", func() error { return db.Table("users").Insert(map[string]any{"name) VALUES ('x'); --": 1}) }, ErrInvalidIdentifier},
+		{"update", func() error { return db.Table("users").Update(map[string]any{"name = 'x', email": 1}) }, ErrInvalidIdentifier},
+		{"delete", func() error { return db.Table("users").WhereNull("id OR 1 = 1").Delete() }, ErrInvalidIdentifier},
+	}
+	for _, tc := range cases {
+		if err := tc.run(); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+	if !errors.Is(db.Error(), ErrInvalidIdentifier) {
+		t.Errorf("Expected last error to be recorded, got %v", db.Error())
+	}
+
+	count, err := db.Table("users").Count()
+	if err != nil || count != 1 {
+		t.Errorf("Expected table untouched, got %d %v", count, err)
+	}
+	if sql := db.Table("users").OrderBy("id", "up").ToSQL(); sql != "" {
+		t.Errorf("Expected no SQL for invalid query, got %s", sql)
+	}
+}
+
+func TestRaw(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.Table("users").Insert(map[string]any{"name": "John", "email": "john@test.com", "status": "active"})
+	db.Table("users").Insert(map[string]any{"name": "Jane", "email": "jane@test.com", "status": "active"})
+	db.Table("users").Insert(map[string]any{"name": "Bob", "email": "bob@test.com", "status": "inactive"})
+
+	rows, err := db.Table("users").
+		Select("status", Raw("COUNT(*) AS total")).
+		Where(Raw("LOWER(email)"), "like", "%@test.com").
+		GroupBy("status").
+		OrderBy(Raw("COUNT(*)"), "desc").
+		GetMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["status"] != "active" || rows[0]["total"] != int64(2) {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+
+	// Expression args are bound in clause order.
+	rows, err = db.Table("users").
+		Select("name", Raw("name = ? AS picked", "Bob")).
+		Where("status", "active").
+		OrderBy(Raw("CASE WHEN name = ? THEN 0 ELSE 1 END", "Jane"), "").
+		GetMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["name"] != "Jane" || rows[0]["picked"] != int64(0) {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+
+	max, err := db.Table("users").Max(Raw("LENGTH(name)"))
+	if err != nil || max != 4 {
+		t.Errorf("Expected max length 4, got %v %v", max, err)
+	}
+}
+
+func TestAllowColumns(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.AllowColumns("users", "id", "name", "status")
+	db.Table("users").Insert(map[string]any{"name": "John", "status": "active"})
+
+	var users []User
+	if err := db.Table("users").Select("id", "name AS n").Where("status", "active").OrderBy("n", "asc").Get(&users); err != nil {
+		t.Errorf("Expected allowed columns to pass, got %v", err)
+	}
+	if err := db.Table("users u").Select("u.*").OrderBy("u.name", "asc").Get(&users); err != nil {
+		t.Errorf("Expected qualified columns to pass, got %v", err)
+	}
+
+	for name, err := range map[string]error{
+		"order":     db.Table("users").OrderBy("email", "asc").Get(&users),
+		"qualified": db.Table("users u").Where("u.email", "x").Get(&users),
+		"insert":    db.Table("users").Insert(map[string]any{"name": "Jane", "email": "jane@test.com"}),
+		"tx": db.Transaction(func(tx *DB) error {
+			return tx.Table("users").Where("id", 1).Update(map[string]any{"email": "x"})
+		}),
+	} {
+		if !errors.Is(err, ErrColumnNotAllowed) {
+			t.Errorf("%s: expected ErrColumnNotAllowed, got %v", name, err)
+		}
+	}
+
+	// Other tables are unrestricted.
+	if sql := db.Table("orders").OrderBy("email", "asc").ToSQL(); sql == "" {
+		t.Error("Expected orders to be unrestricted")
+	}
+}
+
+func TestWhereGroup(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.Table("users").Insert(map[string]any{"name": "John", "email": "john@test.com"})
+	db.Table("users").Insert(map[string]any{"name": "Jane", "email": "jane@test.com", "status": "inactive"})
+	db.Table("users").Insert(map[string]any{"name": "Bob", "email": "bob@test.com"})
+
+	// status = active AND (name = John OR name = Jane)
+	query := db.Table("users").Where("status", "active").WhereGroup(func(q *Builder) {
+		q.Where("name", "John").OrWhere("name", "Jane")
+	})
+	want := `SELECT * FROM "users" WHERE "status" = ? AND ("name" = ? OR "name" = ?)`
+	if got := query.ToSQL(); got != want {
+		t.Errorf("Expected SQL:\n%s\nGot:\n%s", want, got)
+	}
+	var users []User
+	if err := query.Get(&users); err != nil || len(users) != 1 || users[0].Name != "John" {
+		t.Errorf("Expected John, got %v %v", users, err)
+	}
+
+	count, err := db.Table("users").Where("name", "Bob").OrWhereGroup(func(q *Builder) {
+		q.Where("status", "inactive").WhereGroup(func(q *Builder) {
+			q.WhereLike("email", "jane").OrWhereLike("email", "nobody")
+		})
+	}).Count()
+	if err != nil || count != 2 {
+		t.Errorf("Expected 2 users for nested groups, got %d %v", count, err)
+	}
+
+	// Empty groups add nothing.
+	if got := db.Table("users").WhereGroup(func(q *Builder) {}).ToSQL(); got != `SELECT * FROM "users"` {
+		t.Errorf("Unexpected SQL for empty group %s", got)
+	}
+
+	err = db.Table("users").WhereGroup(func(q *Builder) { q.Where("name") }).Get(&users)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected group errors to propagate, got %v", err)
+	}
+}
+
+func TestWherePredicates(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	for _, name := range []string{"100% pure", "1000 pure", "a_b", "axb"} {
+		db.Table("users").Insert(map[string]any{"name": name, "email": name})
+	}
+	db.Table("users").Insert(map[string]any{"name": "same", "email": "other"})
+
+	names := func(b *Builder) []string {
+		t.Helper()
+		rows, err := b.OrderBy("id", "asc").GetMap()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, row := range rows {
+			out = append(out, row["name"].(string))
+		}
+		return out
+	}
+	check := func(name string, got []string, want ...string) {
+		t.Helper()
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+
+	check("between", names(db.Table("users").WhereBetween("id", 2, 3)), "1000 pure", "a_b")
+	check("not between", names(db.Table("users").WhereNotBetween("id", 2, 4)), "100% pure", "same")
+	check("like percent", names(db.Table("users").WhereLike("name", "100%")), "100% pure")
+	check("like underscore", names(db.Table("users").WhereLike("name", "a_")), "a_b")
+	check("column", names(db.Table("users").WhereColumn("name", "<>", "email")), "same")
+
+	var users []User
+	if err := db.Table("users").WhereColumn("name", "= name OR 1 = 1 --", "email").Get(&users); !errors.Is(err, ErrInvalidOperator) {
+		t.Errorf("Expected ErrInvalidOperator, got %v", err)
+	}
+	for name, b := range map[string]*Builder{
+		"none":  db.Table("users").Where(),
+		"one":   db.Table("users").Where("name"),
+		"four":  db.Table("users").Where("name", "=", "a", "b"),
+		"or":    db.Table("users").OrWhere("name"),
+		"date":  db.Table("users").WhereDate("name"),
+		"date3": db.Table("users").WhereDate("name", "=", "2024-01-01", "x"),
+	} {
+		if err := b.Get(&users); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("%s: expected ErrInvalidArgument, got %v", name, err)
+		}
+	}
+}
+
+func TestSubqueries(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.Exec("CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER, total REAL, placed_at TEXT)")
+	db.Table("users").Insert(map[string]any{"name": "John", "email": "john@test.com"})
+	db.Table("users").Insert(map[string]any{"name": "Jane", "email": "jane@test.com"})
+	db.Table("users").Insert(map[string]any{"name": "Bob", "email": "bob@test.com", "status": "inactive"})
+	db.Table("orders").Insert(map[string]any{"user_id": 1, "total": 10, "placed_at": "2024-03-01 09:30:00"})
+	db.Table("orders").Insert(map[string]any{"user_id": 1, "total": 99, "placed_at": "2024-03-02 18:00:00"})
+	db.Table("orders").Insert(map[string]any{"user_id": 3, "total": 5, "placed_at": "2024-03-02 08:00:00"})
+
+	var users []User
+	err := db.Table("users").
+		WhereExists(db.Table("orders").Select(Raw("1")).WhereColumn("orders.user_id", "=", "users.id").Where("total", ">", 50)).
+		Get(&users)
+	if err != nil || len(users) != 1 || users[0].Name != "John" {
+		t.Errorf("Expected John for EXISTS, got %v %v", users, err)
+	}
+
+	count, err := db.Table("users").WhereNotExists(db.Table("orders").Select(Raw("1")).WhereColumn("orders.user_id", "=", "users.id")).Count()
+	if err != nil || count != 1 {
+		t.Errorf("Expected 1 user without orders, got %d %v", count, err)
+	}
+
+	count, err = db.Table("users").
+		Where("status", "active").
+		WhereIn("id", db.Table("orders").Select("user_id").WhereDate("placed_at", "2024-03-01")).
+		Count()
+	if err != nil || count != 1 {
+		t.Errorf("Expected 1 user ordering on March 1st, got %d %v", count, err)
+	}
+	count, err = db.Table("orders").WhereDate("placed_at", ">=", time.Date(2024, 3, 2, 23, 0, 0, 0, time.UTC)).Count()
+	if err != nil || count != 2 {
+		t.Errorf("Expected 2 orders from March 2nd, got %d %v", count, err)
+	}
+	count, err = db.Table("users").WhereNotIn("id", db.Table("orders").Select("user_id")).Count()
+	if err != nil || count != 1 {
+		t.Errorf("Expected 1 user for NOT IN subquery, got %d %v", count, err)
+	}
+
+	if err := db.Table("users").WhereIn("id", db.Table("orders").Select("user_id; --")).Get(&users); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Expected subquery errors to propagate, got %v", err)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.Table("users").Insert(map[string]any{"name": "John", "email": "john@test.com"})
+	db.Table("users").Insert(map[string]any{"name": "Jane", "email": "jane@test.com", "status": "inactive"})
+	db.Table("users").Insert(map[string]any{"name": "Bob", "email": "bob@test.com", "status": "inactive"})
+
+	active := db.Table("users").Select("name").Where("status", "active")
+	rows, err := db.Table("users").Select("name").Where("status", "inactive").
+		Union(active).
+		UnionAll(db.Table("users").Select("name").Where("name", "John")).
+		OrderBy("name", "desc").
+		Limit(3).
+		GetMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range rows {
+		got = append(got, row["name"].(string))
+	}
+	if strings.Join(got, ",") != "John,John,Jane" {
+		t.Errorf("Unexpected union rows %v", got)
+	}
+
+	count, err := db.Table("users").Select("name").Union(db.Table("users").Select("name")).Count()
+	if err != nil || count != 3 {
+		t.Errorf("Expected UNION to count distinct rows, got %d %v", count, err)
+	}
+	count, err = db.Table("users").Select("status").GroupBy("status").Count()
+	if err != nil || count != 2 {
+		t.Errorf("Expected 2 groups, got %d %v", count, err)
+	}
+	count, err = db.Table("users").OrderBy("name", "asc").Limit(1).Offset(1).Count()
+	if err != nil || count != 3 {
+		t.Errorf("Expected Count to ignore limit and offset, got %d %v", count, err)
+	}
+}
+
+func TestSubqueryPlaceholders(t *testing.T) {
+	db := &DB{dialect: drivers.PostgresDialect{}, lastError: &errorState{}}
+	query, args := db.Table("users").
+		Where("status", "active").
+		WhereIn("id", db.Table("orders").Select("user_id").Where("total", ">", 50)).
+		WhereDate("created_at", "2024-01-01").
+		Union(db.Table("admins").Select("*").Where("level", 2)).
+		OrderBy("name", "asc").
+		Limit(10).
+		buildSelect()
+	want := `SELECT * FROM (SELECT * FROM "users" WHERE "status" = $1 AND "id" IN (SELECT "user_id" FROM "orders" WHERE "total" > $2) ` +
+		`AND CAST("created_at" AS DATE) = $3 UNION SELECT * FROM "admins" WHERE "level" = $4) AS "u" ORDER BY "name" ASC LIMIT 10`
+	if query != want {
+		t.Errorf("Expected SQL:\n%s\nGot:\n%s", want, query)
+	}
+	if fmt.Sprint(args) != "[active 50 2024-01-01 2]" {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	sqlserver := &DB{dialect: drivers.SQLServerDialect{}, lastError: &errorState{}}
+	query, _ = sqlserver.Table("users").WhereLike("name", "50%_[x]!").Select("id").Union(sqlserver.Table("admins").Select("id")).Limit(5).buildSelect()
+	want = "SELECT TOP (5) * FROM (SELECT [id] FROM [users] WHERE [name] LIKE @p1 ESCAPE '!' UNION SELECT [id] FROM [admins]) AS [u]"
+	if query != want {
+		t.Errorf("Expected SQL:\n%s\nGot:\n%s", want, query)
+	}
+	_, args = sqlserver.Table("users").WhereLike("name", "50%_[x]!").buildSelect()
+	if args[0] != "%50!%!_![x]!!%" {
+		t.Errorf("Unexpected escaped pattern %v", args[0])
+	}
+}
+
+func seedUsers(t *testing.T, db *DB, n int) {
+	for i := 1; i <= n; i++ {
+		status := "active"
+		if i%2 == 0 {
+			status = "inactive"
+		}
+		err := db.Table("users").Insert(map[string]any{
+			"name":   fmt.Sprintf("User %02d", i),
+			"email":  fmt.Sprintf("user%d@example.com", i),
+			"status": status,
+		})
+		if err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+}
+
+func userIDs(users []User) []int64 {
+	ids := make([]int64, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func TestPaginate(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	seedUsers(t, db, 23)
+
+	var users []User
+	p, err := db.Table("users").Select("id", "name").OrderBy("id", "desc").Paginate(2, 10, &users)
+	if err != nil {
+		t.Fatalf("Paginate failed: %v", err)
+	}
+	if p.Total != 23 || p.LastPage != 3 || p.CurrentPage != 2 || p.From != 11 || p.To != 20 || !p.HasMore {
+		t.Errorf("Unexpected pagination %+v", p)
+	}
+	if len(users) != 10 || users[0].ID != 13 || users[9].ID != 4 {
+		t.Errorf("Unexpected page %v", userIDs(users))
+	}
+	if items, ok := p.Items.([]User); !ok || len(items) != 10 {
+		t.Errorf("Unexpected items %T", p.Items)
+	}
+	if p.PrevURL() != "?page=1" || p.NextURL() != "?page=3" {
+		t.Errorf("Unexpected links %q %q", p.PrevURL(), p.NextURL())
+	}
+
+	p, err = db.Table("users").Where("status", "active").Paginate(3, 5, &users)
+	if err != nil {
+		t.Fatalf("Paginate failed: %v", err)
+	}
+	if p.Total != 12 || p.LastPage != 3 || p.From != 11 || p.To != 12 || p.HasMore || len(users) != 2 {
+		t.Errorf("Unexpected last page %+v, %v", p, userIDs(users))
+	}
+	if p.NextURL() != "" {
+		t.Errorf("Expected no next page, got %q", p.NextURL())
+	}
+
+	p, err = db.Table("users").Paginate(9, 10, &users)
+	if err != nil {
+		t.Fatalf("Paginate failed: %v", err)
+	}
+	if p.From != 0 || p.To != 0 || len(users) != 0 {
+		t.Errorf("Expected an empty page past the end, got %+v", p)
+	}
+
+	p, _ = db.Table("users").Paginate(0, 0, &users)
+	if p.CurrentPage != 1 || p.PerPage != 10 || len(users) != 10 {
+		t.Errorf("Expected the first page of 10, got %+v", p)
+	}
+
+	if _, err := db.Table("users").Paginate(1, 10, users); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument for a non-pointer dest, got %v", err)
+	}
+}
+
+func TestSimplePaginate(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	seedUsers(t, db, 12)
+
+	db.AddHook(NewQueryCounterHook())
+	ctx, stats := WithQueryStats(context.Background())
+
+	var users []User
+	p, err := db.Table("users").WithContext(ctx).OrderBy("id", "asc").SimplePaginate(1, 5, &users)
+	if err != nil {
+		t.Fatalf("SimplePaginate failed: %v", err)
+	}
+	if !p.HasMore || p.From != 1 || p.To != 5 || p.Total != 0 || p.LastPage != 0 || len(users) != 5 {
+		t.Errorf("Unexpected pagination %+v", p)
+	}
+	if queries := stats.Repeated(1); len(queries) != 1 || strings.Contains(queries[0].SQL, "COUNT") {
+		t.Errorf("Expected a single query without COUNT, got %v", queries)
+	}
+
+	p, _ = db.Table("users").OrderBy("id", "asc").SimplePaginate(3, 5, &users)
+	if p.HasMore || p.From != 11 || p.To != 12 || len(users) != 2 || users[0].ID != 11 {
+		t.Errorf("Unexpected last page %+v, %v", p, userIDs(users))
+	}
+	if p.PrevURL() != "?page=2" || p.NextURL() != "" {
+		t.Errorf("Unexpected links %q %q", p.PrevURL(), p.NextURL())
+	}
+}
+
+func TestCursorPaginate(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	seedUsers(t, db, 12)
+
+	page := func(direction, cursor string) ([]int64, *Pagination) {
+		t.Helper()
+		var users []User
+		p, err := db.Table("users").Where("status", "active").OrWhere("status", "inactive").
+			CursorPaginate("id", direction, cursor, 5, &users)
+		if err != nil {
+			t.Fatalf("CursorPaginate failed: %v", err)
+		}
+		return userIDs(users), p
+	}
+
+	ids, first := page("desc", "")
+	if fmt.Sprint(ids) != "[12 11 10 9 8]" || first.PrevCursor != "" || first.NextCursor == "" || !first.HasMore {
+		t.Fatalf("Unexpected first page %v %+v", ids, first)
+	}
+	ids, second := page("desc", first.NextCursor)
+	if fmt.Sprint(ids) != "[7 6 5 4 3]" || second.PrevCursor == "" || second.NextCursor == "" {
+		t.Fatalf("Unexpected second page %v %+v", ids, second)
+	}
+	ids, last := page("desc", second.NextCursor)
+	if fmt.Sprint(ids) != "[2 1]" || last.NextCursor != "" || last.HasMore || last.PrevCursor == "" {
+		t.Fatalf("Unexpected last page %v %+v", ids, last)
+	}
+	ids, back := page("desc", last.PrevCursor)
+	if fmt.Sprint(ids) != "[7 6 5 4 3]" || back.PrevCursor == "" || back.NextCursor == "" {
+		t.Fatalf("Unexpected page before the last %v %+v", ids, back)
+	}
+	ids, back = page("desc", back.PrevCursor)
+	if fmt.Sprint(ids) != "[12 11 10 9 8]" || back.PrevCursor != "" || back.NextCursor == "" {
+		t.Fatalf("Unexpected first page going back %v %+v", ids, back)
+	}
+
+	ids, _ = page("asc", "")
+	if fmt.Sprint(ids) != "[1 2 3 4 5]" {
+		t.Errorf("Unexpected ascending page %v", ids)
+	}
+	if want := "?cursor=" + first.NextCursor; first.NextURL() != want {
+		t.Errorf("Expected next URL %q, got %q", want, first.NextURL())
+	}
+
+	var users []User
+	if _, err := db.Table("users").CursorPaginate("id", "desc", "not a cursor", 5, &users); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+	if _, err := db.Table("users").CursorPaginate("id; DROP TABLE users", "", "", 5, &users); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Expected ErrInvalidIdentifier, got %v", err)
+	}
+}
+
+func TestPaginationLinks(t *testing.T) {
+	u, _ := url.Parse("/admin/users?sort=name&page=4")
+	p := NewPagination(95, 5, 10).WithURL(u)
+	if p.URL(2) != "/admin/users?page=2&sort=name" {
+		t.Errorf("Unexpected URL %q", p.URL(2))
+	}
+
+	links := string(p.Links())
+	for _, want := range []string{
+		`<a href="/admin/users?page=4&amp;sort=name" class="btn btn-secondary" rel="prev">Previous</a>`,
+		`<a href="/admin/users?page=1&amp;sort=name" class="btn btn-sm btn-secondary">1</a><span class="page-info">&hellip;</span><a href="/admin/users?page=3&amp;sort=name"`,
+		`<span class="btn btn-sm btn-primary" aria-current="page">5</span>`,
+		`>7</a><span class="page-info">&hellip;</span><a href="/admin/users?page=10&amp;sort=name" class="btn btn-sm btn-secondary">10</a>`,
+		`<a href="/admin/users?page=6&amp;sort=name" class="btn btn-secondary" rel="next">Next</a>`,
+	} {
+		if !strings.Contains(links, want) {
+			t.Errorf("Expected links to contain:\n%s\nGot:\n%s", want, links)
+		}
+	}
+
+	if links := NewPagination(8, 1, 10).Links(); links != "" {
+		t.Errorf("Expected no links for a single page, got %q", links)
+	}
+	var none *Pagination
+	if none.Links() != "" {
+		t.Error("Expected no links for a nil pagination")
+	}
+
+	simple := &Pagination{CurrentPage: 2, PerPage: 10, HasMore: true, param: "page"}
+	want := `<div class="pagination"><a href="?page=1" class="btn btn-secondary" rel="prev">Previous</a><span class="page-info">Page 2</span><a href="?page=3" class="btn btn-secondary" rel="next">Next</a></div>`
+	if links := string(simple.Links()); links != want {
+		t.Errorf("Expected simple links:\n%s\nGot:\n%s", want, links)
+	}
+}
+
+func TestInsertBatch(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.AddHook(NewQueryCounterHook())
+	ctx, stats := WithQueryStats(context.Background())
+
+	rows := make([]map[string]any, 250)
+	for i := range rows {
+		rows[i] = map[string]any{"name": fmt.Sprintf("User %d", i), "email": fmt.Sprintf("user%d@example.com", i)}
+	}
+	if err := db.Table("users").WithContext(ctx).InsertBatch(rows, 100); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+	if count, _ := db.Table("users").Count(); count != 250 {
+		t.Errorf("Expected 250 rows, got %d", count)
+	}
+	if stats.Count() != 3 {
+		t.Errorf("Expected 3 statements, got %d", stats.Count())
+	}
+	for _, q := range stats.Repeated(1) {
+		if !strings.HasPrefix(q.SQL, `INSERT INTO "users" ("email", "name") VALUES (?, ?), (?, ?), `) {
+			t.Errorf("Unexpected statement %s", q.SQL)
+		}
+	}
+
+	users := []*User{{ID: 1000, Name: "Jane", Email: "jane@example.com", Status: "active"}, {ID: 1001, Name: "Joe", Email: "joe@example.com", Status: "banned"}}
+	if err := db.Table("users").InsertBatch(users, 0); err != nil {
+		t.Fatalf("InsertBatch of structs failed: %v", err)
+	}
+	var joe User
+	if err := db.Table("users").Where("id", 1001).First(&joe); err != nil || joe.Status != "banned" {
+		t.Errorf("Expected inserted struct, got %+v (%v)", joe, err)
+	}
+
+	err := db.Table("users").InsertBatch([]map[string]any{{"name": "A", "email": "a@example.com"}, {"name": "B"}}, 0)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument for rows with different columns, got %v", err)
+	}
+	err = db.Table("users").InsertBatch([]map[string]any{{"name": "A", `email") VALUES ('x', 'y'); --`: "a"}}, 0)
+	if !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Expected ErrInvalidIdentifier, got %v", err)
+	}
+	if err := db.Table("users").InsertBatch([]User{}, 0); err != nil {
+		t.Errorf("Expected no error for no rows, got %v", err)
+	}
+
+	// A failing chunk rolls back the earlier ones.
+	rows = append(rows[:150:150], map[string]any{"name": nil, "email": "null@example.com"})
+	if err := db.Table("users").InsertBatch(rows, 100); err == nil {
+		t.Fatal("Expected the NOT NULL constraint to fail")
+	}
+	if count, _ := db.Table("users").Count(); count != 252 {
+		t.Errorf("Expected the failed batch to roll back, got %d rows", count)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE stock (sku TEXT PRIMARY KEY, name TEXT NOT NULL, qty INTEGER NOT NULL)`); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	rows := []map[string]any{
+		{"sku": "KB-1", "name": "Keyboard", "qty": 10},
+		{"sku": "MS-1", "name": "Mouse", "qty": 40},
+	}
+	if err := db.Table("stock").Upsert(rows, []string{"sku"}, []string{"qty"}); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	rows = []map[string]any{
+		{"sku": "MS-1", "name": "Renamed", "qty": 35},
+		{"sku": "PD-1", "name": "Pad", "qty": 5},
+	}
+	if err := db.Table("stock").Upsert(rows, []string{"sku"}, []string{"qty"}); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	mouse, _ := db.Table("stock").Where("sku", "MS-1").FirstMap()
+	if mouse["qty"] != int64(35) || mouse["name"] != "Mouse" {
+		t.Errorf("Expected qty updated and name kept, got %v", mouse)
+	}
+	if count, _ := db.Table("stock").Count(); count != 3 {
+		t.Errorf("Expected 3 rows, got %d", count)
+	}
+
+	rows[0]["qty"] = 1
+	if err := db.Table("stock").Upsert(rows[:1], []string{"sku"}, nil); err != nil {
+		t.Fatalf("Upsert without update failed: %v", err)
+	}
+	if qty, _ := db.Table("stock").Where("sku", "MS-1").Max("qty"); qty != 35 {
+		t.Errorf("Expected the conflicting row unchanged, got qty %v", qty)
+	}
+
+	if err := db.Table("stock").Upsert(rows, nil, []string{"qty"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument without conflict columns, got %v", err)
+	}
+	if err := db.Table("stock").Upsert(rows, []string{"sku"}, []string{"price"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument for an update column not inserted, got %v", err)
+	}
+	if err := db.Table("stock").Upsert(rows, []string{"sku"}, []string{`qty" = 0; --`}); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Expected ErrInvalidIdentifier, got %v", err)
+	}
+	if err := db.Table("stock s").Upsert(rows, []string{"sku"}, []string{"qty"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument for an aliased table, got %v", err)
+	}
+	db.AllowColumns("stock", "sku", "qty")
+	if err := db.Table("stock").Upsert(rows, []string{"sku"}, []string{"qty"}); !errors.Is(err, ErrColumnNotAllowed) {
+		t.Errorf("Expected ErrColumnNotAllowed, got %v", err)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	if _, err := db.Exec(`ALTER TABLE users ADD COLUMN visits INTEGER NOT NULL DEFAULT 0`); err != nil {
+		t.Fatalf("Failed to alter table: %v", err)
+	}
+	seedUsers(t, db, 3)
+
+	if err := db.Table("users").Where("id", 2).Increment("visits", 5); err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+	if err := db.Table("users").Where("id", 2).Decrement("visits", 2); err != nil {
+		t.Fatalf("Decrement failed: %v", err)
+	}
+	if err := db.Table("users").Increment("visits", 1); err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+	if sum, _ := db.Table("users").Sum("visits"); sum != 6 {
+		t.Errorf("Expected 6 visits in total, got %v", sum)
+	}
+	if visits, _ := db.Table("users").Where("id", 2).Max("visits"); visits != 4 {
+		t.Errorf("Expected 4 visits, got %v", visits)
+	}
+	if err := db.Table("users").Increment("visits = 0, name", 1); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Expected ErrInvalidIdentifier, got %v", err)
+	}
+}
+
+func TestUpdateBatch(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	seedUsers(t, db, 4)
+	db.AddHook(NewQueryCounterHook())
+	ctx, stats := WithQueryStats(context.Background())
+
+	rows := []map[string]any{
+		{"id": 1, "name": "Ann", "status": "banned"},
+		{"id": 2, "name": "Bob", "status": "banned"},
+		{"id": 3, "name": "Cid", "status": "banned"},
+	}
+	if err := db.Table("users").WithContext(ctx).Where("status", "active").UpdateBatch(rows, "id"); err != nil {
+		t.Fatalf("UpdateBatch failed: %v", err)
+	}
+	want := `UPDATE "users" SET "name" = CASE "id" WHEN ? THEN ? WHEN ? THEN ? WHEN ? THEN ? ELSE "name" END, ` +
+		`"status" = CASE "id" WHEN ? THEN ? WHEN ? THEN ? WHEN ? THEN ? ELSE "status" END ` +
+		`WHERE "id" IN (?, ?, ?) AND ("status" = ?)`
+	if queries := stats.Repeated(1); len(queries) != 1 || queries[0].SQL != want {
+		t.Errorf("Expected SQL:\n%s\nGot:\n%v", want, queries)
+	}
+
+	var users []User
+	db.Table("users").OrderBy("id", "asc").Get(&users)
+	got := make([]string, len(users))
+	for i, u := range users {
+		got[i] = u.Name + ":" + u.Status
+	}
+	// User 2 is inactive, so the where clause leaves it out.
+	if fmt.Sprint(got) != "[Ann:banned User 02:inactive Cid:banned User 04:inactive]" {
+		t.Errorf("Unexpected rows %v", got)
+	}
+
+	if err := db.Table("users").UpdateBatch([]map[string]any{{"name": "X"}}, "id"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument without key column, got %v", err)
+	}
+	if err := db.Table("users").UpdateBatch([]map[string]any{{"id": 1}}, "id"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument without columns to update, got %v", err)
+	}
+}
+
+type recordingHook struct {
+	name   string
+	calls  *[]string
+	events []QueryEvent
+}
+
+type hookKey struct{}
+
+func (h *recordingHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+	*h.calls = append(*h.calls, "before "+h.name)
+	return context.WithValue(ctx, hookKey{}, h.name)
+}
+
+func (h *recordingHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+	*h.calls = append(*h.calls, "after "+h.name+" "+ctx.Value(hookKey{}).(string))
+	h.events = append(h.events, *e)
+}
+
+func TestQueryHooks(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var calls []string
+	outer := &recordingHook{name: "outer", calls: &calls}
+	inner := &recordingHook{name: "inner", calls: &calls}
+	db.AddHook(outer, inner)
+
+	db.Table("users").Insert(map[string]any{"name": "John", "email": "john@test.com"})
+	want := []string{"before outer", "before inner", "after inner inner", "after outer inner"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected hook order %v, got %v", want, calls)
+	}
+
+	var users []User
+	db.Table("users").Where("name", "John").Get(&users)
+	db.Query("SELECT * FROM users").GetMap()
+	db.Exec("UPDATE users SET status = ?", "inactive")
+	db.Transaction(func(tx *DB) error {
+		return tx.Table("users").Where("id", 1).Delete()
+	})
+	db.Query("SELECT * FROM missing").GetMap()
+
+	events := outer.events
+	if len(events) != 6 {
+		t.Fatalf("Expected 6 statements, got %d", len(events))
+	}
+	if events[0].Table != "users" || events[0].RowsAffected != 1 || !strings.HasPrefix(events[0].SQL, `INSERT INTO "users"`) {
+		t.Errorf("Unexpected insert event %+v", events[0])
+	}
+	if events[1].SQL != `SELECT * FROM "users" WHERE "name" = ?` || events[1].Args[0] != "John" || events[1].RowsAffected != -1 {
+		t.Errorf("Unexpected select event %+v", events[1])
+	}
+	if events[2].Table != "" || events[2].SQL != "SELECT * FROM users" {
+		t.Errorf("Unexpected raw event %+v", events[2])
+	}
+	if events[3].RowsAffected != 1 || events[4].RowsAffected != 1 {
+		t.Errorf("Expected Exec and transaction statements with rows affected, got %+v %+v", events[3], events[4])
+	}
+	if events[5].Err == nil || db.Error() == nil {
+		t.Errorf("Expected failed statement to be reported, got %+v", events[5])
+	}
+}
+
+func TestLogHook(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	db.AddHook(NewLogHook(LogHookConfig{Logger: logger, Args: true}))
+
+	ctx := core.WithRequestID(context.Background(), "req-1")
+	db.WithContext(ctx).Table("users").Insert(map[string]any{"name": "John", "email": "john@test.com"})
+	db.Query("SELECT nope FROM users").GetMap()
+
+	out := buf.String()
+	for _, want := range []string{
+		`level=DEBUG msg=query sql="INSERT INTO \"users\"`,
+		"rows_affected=1",
+		"request_id=req-1",
+		"args=",
+		`level=ERROR msg="query failed" sql="SELECT nope FROM users"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in log:\n%s", want, out)
+		}
+	}
+}
+
+func TestSlowQueryHook(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var slow []string
+	var plans []string
+	db.AddHook(NewSlowQueryHook(SlowQueryConfig{
+		Threshold: time.Nanosecond,
+		Explain:   true,
+		OnSlow: func(ctx context.Context, e *QueryEvent, plan string) {
+			slow = append(slow, e.SQL)
+			plans = append(plans, plan)
+		},
+	}))
+
+	db.Table("users").Insert(map[string]any{"name": "John", "email": "john@test.com"})
+	db.Table("users").Where("name", "John").GetMap()
+
+	if len(slow) != 2 {
+		t.Fatalf("Expected 2 slow statements, got %v", slow)
+	}
+	if plans[0] != "" {
+		t.Errorf("Expected no plan for INSERT, got %q", plans[0])
+	}
+	if !strings.Contains(plans[1], "SCAN users") {
+		t.Errorf("Expected query plan for SELECT, got %q", plans[1])
+	}
+
+	var logged bytes.Buffer
+	quiet := setupTestDB(t)
+	defer quiet.Close()
+	quiet.AddHook(NewSlowQueryHook(SlowQueryConfig{
+		Threshold: time.Hour,
+		Logger:    slog.New(slog.NewTextHandler(&logged, nil)),
+	}))
+	quiet.Table("users").Count()
+	if logged.Len() != 0 {
+		t.Errorf("Expected fast query not to be logged, got %s", logged.String())
+	}
+}
+
+func TestQueryCounterHook(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.AddHook(NewQueryCounterHook())
+
+	ctx, stats := WithQueryStats(context.Background())
+	tx := db.WithContext(ctx)
+	for i := 0; i < 3; i++ {
+		tx.Table("users").Where("id", i).FirstMap()
+	}
+	tx.Table("users").Count()
+	db.Table("users").Count() // other context: not counted
+
+	if stats.Count() != 4 {
+		t.Errorf("Expected 4 statements, got %d", stats.Count())
+	}
+	repeated := stats.Repeated(2)
+	if len(repeated) != 1 || repeated[0].Count != 3 || !strings.Contains(repeated[0].SQL, `WHERE "id" = ?`) {
+		t.Errorf("Unexpected repeated statements %+v", repeated)
+	}
+	if QueryStatsFromContext(ctx) != stats || QueryStatsFromContext(context.Background()) != nil {
+		t.Error("Expected stats to be carried by the context only")
+	}
+}
+
+func TestErrorConcurrent(t *testing.T) {
+	db, err := Open("sqlite", filepath.Join(t.TempDir(), "errors.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db.Table("missing").Count()
+			db.Error()
+		}()
+	}
+	wg.Wait()
+
+	if db.Error() == nil || !errors.Is(db.WithContext(context.Background()).Error(), db.Error()) {
+		t.Error("Expected last error to be shared with WithContext copies")
+	}
+}
@@ -4,6 +4,12 @@ package drivers
 import "database/sql"
 
 // Driver defines the interface that all database drivers must implement.
+// A driver may also have a method
+//
+//	Dialect() Dialect
+//
+// returning the SQL dialect the query builder generates; drivers without
+// it get standard SQL, see DialectOf.
 type Driver interface {
 	// Open creates a new database connection.
 	Open(dsn string) (*sql.DB, error)
@@ -39,3 +39,8 @@ func (d *MySQLDriver) Placeholder(index int) string {
 func (d *MySQLDriver) Name() string {
 	return "mysql"
 }
+
+// Dialect returns the MySQL dialect.
+func (d *MySQLDriver) Dialect() Dialect {
+	return MySQLDialect{}
+}
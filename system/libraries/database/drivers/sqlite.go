@@ -38,3 +38,8 @@ func (d *SQLiteDriver) Placeholder(index int) string {
 func (d *SQLiteDriver) Name() string {
 	return "sqlite"
 }
+
+// Dialect returns the SQLite dialect.
+func (d *SQLiteDriver) Dialect() Dialect {
+	return SQLiteDialect{}
+}
@@ -0,0 +1,351 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/semutdev/goigniter/system/core"
+	"github.com/semutdev/goigniter/system/libraries/tracing"
+)
+
+// QueryEvent describes a statement. Duration, RowsAffected and Err are
+// set once it has finished.
+type QueryEvent struct {
+	Table        string // "" for raw queries
+	SQL          string
+	Args         []any
+	Start        time.Time
+	Duration     time.Duration
+	RowsAffected int64 // -1 unless the statement ran through Exec
+	Err          error
+
+	db   *DB
+	span *tracing.Span
+}
+
+// QueryHook observes every statement run by a DB: Builder and RawResult
+// queries, Exec and statements inside transactions.
+type QueryHook interface {
+	// BeforeQuery is called before the statement runs. The returned
+	// context is used for the statement and passed to AfterQuery.
+	BeforeQuery(ctx context.Context, e *QueryEvent) context.Context
+
+	// AfterQuery is called when the statement has finished, including
+	// reading any rows it returned.
+	AfterQuery(ctx context.Context, e *QueryEvent)
+}
+
+// AddHook registers hooks on db. Hooks run in order before a statement
+// and in reverse order after it. Transactions started afterwards inherit
+// them. Add hooks during setup, before db is used concurrently.
+//
+//	db.AddHook(
+//		database.NewLogHook(database.LogHookConfig{}),
+//		database.NewSlowQueryHook(database.SlowQueryConfig{Threshold: 200 * time.Millisecond, Explain: true}),
+//	)
+func (db *DB) AddHook(hooks ...QueryHook) {
+	db.hooks = append(db.hooks, hooks...)
+}
+
+var (
+	queryHooksMu sync.Mutex
+	queryHooks   atomic.Pointer[[]func(ctx context.Context, e QueryEvent)]
+)
+
+// OnQuery registers fn to be called after every statement run by any DB,
+// with the context it ran with (see WithContext). It is meant for
+// development tools such as the profiler and runs inline, so it must be
+// fast.
+func OnQuery(fn func(ctx context.Context, e QueryEvent)) {
+	queryHooksMu.Lock()
+	defer queryHooksMu.Unlock()
+	var hooks []func(ctx context.Context, e QueryEvent)
+	if old := queryHooks.Load(); old != nil {
+		hooks = append(hooks, *old...)
+	}
+	hooks = append(hooks, fn)
+	queryHooks.Store(&hooks)
+}
+
+// failed reports whether e ended with an error worth reporting.
+// sql.ErrNoRows only means an empty result.
+func (e *QueryEvent) failed() bool {
+	return e.Err != nil && !errors.Is(e.Err, sql.ErrNoRows)
+}
+
+// LogHookConfig holds configuration for NewLogHook.
+type LogHookConfig struct {
+	// Logger receives the records (default: slog.Default()).
+	Logger *slog.Logger
+
+	// Level is used for successful statements (default: slog.LevelDebug).
+	// Failed statements are logged at slog.LevelError.
+	Level slog.Leveler
+
+	// Args includes the statement arguments. They may contain personal
+	// data or credentials, so they are left out by default.
+	Args bool
+}
+
+// NewLogHook returns a hook logging every statement through slog with
+// its duration, rows affected, error and the request ID from the context.
+func NewLogHook(config LogHookConfig) QueryHook {
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	if config.Level == nil {
+		config.Level = slog.LevelDebug
+	}
+	return &logHook{config: config}
+}
+
+type logHook struct {
+	config LogHookConfig
+}
+
+func (h *logHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *logHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+	level, msg := h.config.Level.Level(), "query"
+	if e.failed() {
+		level, msg = slog.LevelError, "query failed"
+	}
+	logger := h.config.Logger
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("sql", e.SQL),
+		slog.Duration("duration", e.Duration),
+	}
+	if h.config.Args && len(e.Args) > 0 {
+		attrs = append(attrs, slog.Any("args", e.Args))
+	}
+	if e.RowsAffected >= 0 {
+		attrs = append(attrs, slog.Int64("rows_affected", e.RowsAffected))
+	}
+	if e.failed() {
+		attrs = append(attrs, slog.String("error", e.Err.Error()))
+	}
+	if id := core.RequestIDFromContext(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// SlowQueryConfig holds configuration for NewSlowQueryHook.
+type SlowQueryConfig struct {
+	// Threshold is the duration from which a statement is slow
+	// (default: 200ms).
+	Threshold time.Duration
+
+	// Explain runs EXPLAIN for slow SELECT statements and reports the
+	// plan. It costs an extra round trip per slow query.
+	Explain bool
+
+	// Logger receives a warning per slow statement (default:
+	// slog.Default()). Ignored when OnSlow is set.
+	Logger *slog.Logger
+
+	// OnSlow replaces logging, e.g. to feed metrics. plan is "" unless
+	// Explain is set and the plan could be read.
+	OnSlow func(ctx context.Context, e *QueryEvent, plan string)
+}
+
+// NewSlowQueryHook returns a hook reporting statements slower than the
+// threshold, optionally with their query plan.
+func NewSlowQueryHook(config SlowQueryConfig) QueryHook {
+	if config.Threshold == 0 {
+		config.Threshold = 200 * time.Millisecond
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	return &slowQueryHook{config: config}
+}
+
+type slowQueryHook struct {
+	config SlowQueryConfig
+}
+
+func (h *slowQueryHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *slowQueryHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+	if e.Duration < h.config.Threshold {
+		return
+	}
+
+	plan := ""
+	if h.config.Explain && isSelect(e.SQL) {
+		var err error
+		if plan, err = explain(ctx, e); err != nil {
+			plan = "EXPLAIN failed: " + err.Error()
+		}
+	}
+
+	if h.config.OnSlow != nil {
+		h.config.OnSlow(ctx, e, plan)
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("sql", e.SQL),
+		slog.Duration("duration", e.Duration),
+		slog.Duration("threshold", h.config.Threshold),
+	}
+	if plan != "" {
+		attrs = append(attrs, slog.String("plan", plan))
+	}
+	if id := core.RequestIDFromContext(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	h.config.Logger.LogAttrs(ctx, slog.LevelWarn, "slow query", attrs...)
+}
+
+func isSelect(query string) bool {
+	q := strings.ToUpper(strings.TrimSpace(query))
+	return strings.HasPrefix(q, "SELECT") || strings.HasPrefix(q, "WITH")
+}
+
+// explain returns the query plan of e, one row per line. It bypasses the
+// hooks so the EXPLAIN itself isn't reported.
+func explain(ctx context.Context, e *QueryEvent) (string, error) {
+	prefix := "EXPLAIN "
+	if e.db.driver.Name() == "sqlite" {
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+
+	rows, err := e.db.execer().QueryContext(ctx, prefix+e.SQL, e.Args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	var lines []string
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return "", err
+		}
+		fields := make([]string, len(columns))
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			fields[i] = fmt.Sprintf("%s=%v", columns[i], v)
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
+
+// QueryStats counts the statements run with a context, see WithQueryStats.
+type QueryStats struct {
+	mu       sync.Mutex
+	count    int
+	duration time.Duration
+	bySQL    map[string]int
+}
+
+// RepeatedQuery is a statement run several times.
+type RepeatedQuery struct {
+	SQL   string
+	Count int
+}
+
+type statsKey struct{}
+
+// WithQueryStats returns ctx carrying new QueryStats, which the hook from
+// NewQueryCounterHook fills for statements run with ctx (see WithContext).
+func WithQueryStats(ctx context.Context) (context.Context, *QueryStats) {
+	stats := &QueryStats{bySQL: make(map[string]int)}
+	return context.WithValue(ctx, statsKey{}, stats), stats
+}
+
+// QueryStatsFromContext returns the QueryStats carried by ctx, or nil.
+func QueryStatsFromContext(ctx context.Context) *QueryStats {
+	stats, _ := ctx.Value(statsKey{}).(*QueryStats)
+	return stats
+}
+
+// Count returns the number of statements.
+func (s *QueryStats) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Duration returns the time spent running them.
+func (s *QueryStats) Duration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.duration
+}
+
+// Repeated returns the statements run at least min times, most frequent
+// first. The same SELECT run once per row of a previous result is the
+// typical N+1 pattern.
+func (s *QueryStats) Repeated(min int) []RepeatedQuery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []RepeatedQuery
+	for query, n := range s.bySQL {
+		if n >= min {
+			out = append(out, RepeatedQuery{SQL: query, Count: n})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].SQL < out[j].SQL
+	})
+	return out
+}
+
+// NewQueryCounterHook returns a hook counting statements in the
+// QueryStats of their context. See middleware.QueryCounter for a
+// per-request setup.
+func NewQueryCounterHook() QueryHook {
+	return queryCounterHook{}
+}
+
+type queryCounterHook struct{}
+
+func (queryCounterHook) BeforeQuery(ctx context.Context, e *QueryEvent) context.Context {
+	return ctx
+}
+
+func (queryCounterHook) AfterQuery(ctx context.Context, e *QueryEvent) {
+	stats := QueryStatsFromContext(ctx)
+	if stats == nil {
+		return
+	}
+	stats.mu.Lock()
+	stats.count++
+	stats.duration += e.Duration
+	stats.bySQL[e.SQL]++
+	stats.mu.Unlock()
+}
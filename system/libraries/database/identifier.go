@@ -0,0 +1,198 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Errors returned by invalid builder queries.
+var (
+	ErrInvalidArgument   = errors.New("database: invalid argument")
+	ErrInvalidIdentifier = errors.New("database: invalid identifier")
+	ErrInvalidOperator   = errors.New("database: invalid operator")
+	ErrInvalidDirection  = errors.New("database: invalid order direction")
+	ErrColumnNotAllowed  = errors.New("database: column not allowed")
+)
+
+// Expr is a raw SQL expression, see Raw.
+type Expr struct {
+	SQL  string
+	Args []any
+}
+
+// Raw returns an expression the builder uses as written, where it would
+// otherwise quote a column name:
+//
+//	db.Table("orders").Select("status", database.Raw("COUNT(*) AS total")).GroupBy("status")
+//	db.Table("users").Where(database.Raw("LOWER(email)"), email)
+//	db.Table("tasks").OrderBy(database.Raw("FIELD(priority, ?, ?)", "high", "low"), "asc")
+//
+// Never build the SQL of a Raw expression from user input; pass values
+// as args instead.
+func Raw(sql string, args ...any) Expr {
+	return Expr{SQL: sql, Args: args}
+}
+
+// columnWhitelist holds the columns allowed per table, shared by a DB
+// and its copies.
+type columnWhitelist struct {
+	mu     sync.RWMutex
+	tables map[string]map[string]bool
+}
+
+// AllowColumns restricts the columns builder queries on table may use
+// to columns. Queries referencing any other column of the table fail
+// with ErrColumnNotAllowed before reaching the database, which guards
+// columns chosen from request data such as a sort parameter:
+//
+//	db.AllowColumns("products", "id", "name", "price", "stock", "created_at")
+//
+//	db.Table("products").OrderBy(c.Query("sort"), c.Query("dir")).Get(&products)
+//
+// Unqualified columns are checked against the builder's table, qualified
+// ones against the table they name. Call it again to add columns.
+func (db *DB) AllowColumns(table string, columns ...string) {
+	db.columns.mu.Lock()
+	defer db.columns.mu.Unlock()
+	if db.columns.tables == nil {
+		db.columns.tables = make(map[string]map[string]bool)
+	}
+	allowed := db.columns.tables[table]
+	if allowed == nil {
+		allowed = make(map[string]bool)
+		db.columns.tables[table] = allowed
+	}
+	for _, col := range columns {
+		allowed[strings.ToLower(col)] = true
+	}
+}
+
+// allowed reports whether column may be used on table.
+func (w *columnWhitelist) allowed(table, column string) bool {
+	if w == nil {
+		return true
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	cols, ok := w.tables[table]
+	return !ok || cols[strings.ToLower(column)]
+}
+
+// identifier is a parsed name such as "users.email AS contact".
+type identifier struct {
+	parts []string // qualifiers and name, the name may be "*"
+	alias string
+}
+
+// name returns the last part, without qualifiers.
+func (id identifier) name() string {
+	return id.parts[len(id.parts)-1]
+}
+
+// qualifier returns the part before the name, usually a table or alias.
+func (id identifier) qualifier() string {
+	if len(id.parts) < 2 {
+		return ""
+	}
+	return id.parts[len(id.parts)-2]
+}
+
+// parseIdentifier parses a name made of up to three dotted parts of
+// letters, digits and underscores, optionally followed by an alias with
+// or without AS. Anything else, including quotes, is rejected.
+func parseIdentifier(s string, withAlias bool) (identifier, error) {
+	var id identifier
+	fields := strings.Fields(s)
+	switch {
+	case len(fields) == 1:
+	case withAlias && len(fields) == 2:
+		id.alias = fields[1]
+	case withAlias && len(fields) == 3 && strings.EqualFold(fields[1], "AS"):
+		id.alias = fields[2]
+	default:
+		return id, fmt.Errorf("%w: %q", ErrInvalidIdentifier, s)
+	}
+	if id.alias != "" && !isIdentifier(id.alias) {
+		return id, fmt.Errorf("%w: %q", ErrInvalidIdentifier, s)
+	}
+
+	id.parts = strings.Split(fields[0], ".")
+	if len(id.parts) > 3 {
+		return id, fmt.Errorf("%w: %q", ErrInvalidIdentifier, s)
+	}
+	for i, part := range id.parts {
+		if part == "*" && i == len(id.parts)-1 && id.alias == "" {
+			continue
+		}
+		if !isIdentifier(part) {
+			return id, fmt.Errorf("%w: %q", ErrInvalidIdentifier, s)
+		}
+	}
+	return id, nil
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// quoteIdentifier returns id quoted for db's dialect.
+func (db *DB) quoteIdentifier(id identifier) string {
+	parts := make([]string, len(id.parts))
+	for i, part := range id.parts {
+		if part == "*" {
+			parts[i] = part
+		} else {
+			parts[i] = db.dialect.Quote(part)
+		}
+	}
+	quoted := strings.Join(parts, ".")
+	if id.alias != "" {
+		quoted += " AS " + db.dialect.Quote(id.alias)
+	}
+	return quoted
+}
+
+// whereOperators are the comparison operators Where accepts.
+var whereOperators = map[string]bool{
+	"=": true, "!=": true, "<>": true, "<": true, ">": true, "<=": true, ">=": true,
+	"LIKE": true, "NOT LIKE": true, "ILIKE": true, "NOT ILIKE": true,
+}
+
+// comparisonOperators are the operators Join, WhereColumn and WhereDate
+// accept.
+var comparisonOperators = map[string]bool{
+	"=": true, "!=": true, "<>": true, "<": true, ">": true, "<=": true, ">=": true,
+}
+
+// normalizeOperator returns op in upper case with single spaces, or an
+// error when operators doesn't contain it.
+func normalizeOperator(op string, operators map[string]bool) (string, error) {
+	normalized := strings.ToUpper(strings.Join(strings.Fields(op), " "))
+	if !operators[normalized] {
+		return "", fmt.Errorf("%w: %q", ErrInvalidOperator, op)
+	}
+	return normalized, nil
+}
+
+// normalizeDirection returns "ASC" or "DESC" for direction, case and
+// surrounding spaces ignored.
+func normalizeDirection(direction string) (string, error) {
+	switch d := strings.ToUpper(strings.TrimSpace(direction)); d {
+	case "ASC", "DESC":
+		return d, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidDirection, direction)
+}
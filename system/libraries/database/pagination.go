@@ -0,0 +1,440 @@
+package database
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned by CursorPaginate for a cursor it didn't
+// create.
+var ErrInvalidCursor = errors.New("database: invalid cursor")
+
+// Pagination describes one page of results, see Builder.Paginate.
+type Pagination struct {
+	Items       any   // the slice the page was scanned into
+	Total       int64 // total rows, 0 when not counted
+	PerPage     int
+	CurrentPage int // 0 for cursor pagination
+	LastPage    int // 0 when not counted
+	From        int // position of the first item on the page, 0 when empty
+	To          int // position of the last item on the page, 0 when empty
+	HasMore     bool
+
+	// NextCursor and PrevCursor are set by CursorPaginate when there is a
+	// next or previous page.
+	NextCursor string
+	PrevCursor string
+
+	url   *url.URL
+	param string // query parameter of the links, "page" or "cursor"
+}
+
+// NewPagination returns the pagination of total rows split in pages of
+// perPage, for counts from somewhere other than Paginate:
+//
+//	total, _ := db.Table("products").Where("name", "LIKE", search).Count()
+//	p := database.NewPagination(total, page, 20)
+func NewPagination(total int64, page, perPage int) *Pagination {
+	page, perPage = pageBounds(page, perPage)
+	p := &Pagination{
+		Total:       total,
+		PerPage:     perPage,
+		CurrentPage: page,
+		LastPage:    int((total + int64(perPage) - 1) / int64(perPage)),
+		param:       "page",
+	}
+	if p.LastPage == 0 {
+		p.LastPage = 1
+	}
+	if offset := (page - 1) * perPage; int64(offset) < total {
+		p.From = offset + 1
+		p.To = int(min(int64(offset+perPage), total))
+	}
+	p.HasMore = page < p.LastPage
+	return p
+}
+
+// pageBounds returns page and perPage, defaulting to the first page of
+// 10 items.
+func pageBounds(page, perPage int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 10
+	}
+	return page, perPage
+}
+
+// WithURL makes the page links point to u, keeping its other query
+// parameters, and returns p. Without it links are relative such as
+// "?page=2":
+//
+//	p, err := db.Table("users").Paginate(page, 20, &users)
+//	p.WithURL(c.Request.URL)
+func (p *Pagination) WithURL(u *url.URL) *Pagination {
+	p.url = u
+	return p
+}
+
+// URL returns the link to page.
+func (p *Pagination) URL(page int) string {
+	return p.link(strconv.Itoa(page))
+}
+
+// NextURL returns the link to the next page, or "" on the last page.
+func (p *Pagination) NextURL() string {
+	switch {
+	case p.param == "cursor":
+		if p.NextCursor == "" {
+			return ""
+		}
+		return p.link(p.NextCursor)
+	case p.HasMore:
+		return p.URL(p.CurrentPage + 1)
+	}
+	return ""
+}
+
+// PrevURL returns the link to the previous page, or "" on the first
+// page.
+func (p *Pagination) PrevURL() string {
+	switch {
+	case p.param == "cursor":
+		if p.PrevCursor == "" {
+			return ""
+		}
+		return p.link(p.PrevCursor)
+	case p.CurrentPage > 1:
+		return p.URL(p.CurrentPage - 1)
+	}
+	return ""
+}
+
+// link returns the URL with p's query parameter set to value.
+func (p *Pagination) link(value string) string {
+	if p.url == nil {
+		return "?" + url.Values{p.param: {value}}.Encode()
+	}
+	u := *p.url
+	q := u.Query()
+	q.Set(p.param, value)
+	u.RawQuery = q.Encode()
+	u.Fragment = ""
+	return u.String()
+}
+
+// pageLink is a page number in the rendered links, 0 for a gap.
+type pageLink struct {
+	Page    int
+	URL     string
+	Current bool
+}
+
+// pages returns the page numbers around the current page, with the first
+// and last page and gaps between.
+func (p *Pagination) pages() []pageLink {
+	const window = 2
+	var links []pageLink
+	for page := 1; page <= p.LastPage; page++ {
+		if page != 1 && page != p.LastPage && (page < p.CurrentPage-window || page > p.CurrentPage+window) {
+			if links[len(links)-1].Page != 0 {
+				links = append(links, pageLink{})
+			}
+			continue
+		}
+		links = append(links, pageLink{Page: page, URL: p.URL(page), Current: page == p.CurrentPage})
+	}
+	return links
+}
+
+var linksTemplate = template.Must(template.New("pagination").Parse(`<div class="pagination">
+{{- with .Prev}}<a href="{{.}}" class="btn btn-secondary" rel="prev">Previous</a>{{end}}
+{{- range .Pages}}
+	{{- if .Current}}<span class="btn btn-sm btn-primary" aria-current="page">{{.Page}}</span>
+	{{- else if .Page}}<a href="{{.URL}}" class="btn btn-sm btn-secondary">{{.Page}}</a>
+	{{- else}}<span class="page-info">&hellip;</span>{{end}}
+{{- else}}{{with .Current}}<span class="page-info">Page {{.}}</span>{{end}}
+{{- end}}
+{{- with .Next}}<a href="{{.}}" class="btn btn-secondary" rel="next">Next</a>{{end -}}
+</div>`))
+
+// Links renders the links to the previous and next pages, and to the
+// pages around the current one when the rows were counted. It renders
+// nothing when everything fits on one page. Templates call it through
+// the pagination helper:
+//
+//	{{pagination .Pagination}}
+func (p *Pagination) Links() template.HTML {
+	if p == nil {
+		return ""
+	}
+	prev, next := p.PrevURL(), p.NextURL()
+	if prev == "" && next == "" {
+		return ""
+	}
+	data := struct {
+		Prev, Next string
+		Current    int
+		Pages      []pageLink
+	}{Prev: prev, Next: next, Current: p.CurrentPage}
+	if p.param == "page" && p.Total > 0 {
+		data.Pages = p.pages()
+	}
+
+	var buf bytes.Buffer
+	if err := linksTemplate.Execute(&buf, data); err != nil {
+		return ""
+	}
+	return template.HTML(buf.String())
+}
+
+// Paginate counts the rows of the query and scans page into dest, a
+// pointer to a slice, with perPage rows per page. page is 1-based; pages
+// below 1 return the first page and a perPage below 1 means 10. The count
+// ignores OrderBy, Limit, Offset and the selected columns:
+//
+//	page, _ := strconv.Atoi(c.Query("page"))
+//	var users []User
+//	p, err := db.Table("users").OrderBy("name", "asc").Paginate(page, 20, &users)
+func (b *Builder) Paginate(page, perPage int, dest any) (*Pagination, error) {
+	items, err := sliceDest(dest)
+	if err != nil {
+		b.setError(err)
+	}
+	total, err := b.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewPagination(total, page, perPage)
+	if p.From > 0 {
+		if err := b.getPage(p.PerPage, p.From-1, dest); err != nil {
+			return nil, err
+		}
+	}
+	p.Items = items.Interface()
+	return p, nil
+}
+
+// SimplePaginate scans page into dest like Paginate without counting the
+// rows, fetching one row more to know whether there is a next page. Use
+// it for large tables, where only previous and next links are needed.
+// Total and LastPage are left zero.
+func (b *Builder) SimplePaginate(page, perPage int, dest any) (*Pagination, error) {
+	items, err := sliceDest(dest)
+	if err != nil {
+		b.setError(err)
+	}
+	page, perPage = pageBounds(page, perPage)
+	offset := (page - 1) * perPage
+	if err := b.getPage(perPage+1, offset, dest); err != nil {
+		return nil, err
+	}
+
+	p := &Pagination{PerPage: perPage, CurrentPage: page, param: "page"}
+	if items.Len() > perPage {
+		items.SetLen(perPage)
+		p.HasMore = true
+	}
+	if n := items.Len(); n > 0 {
+		p.From, p.To = offset+1, offset+n
+	}
+	p.Items = items.Interface()
+	return p, nil
+}
+
+// CursorPaginate scans the page after or before cursor into dest, ordered
+// by column in direction ("asc", "desc" or "" for ascending). column must
+// be unique, such as an id, and selected into dest. An empty cursor
+// returns the first page; NextCursor and PrevCursor hold the cursors of
+// the neighbouring pages and the links use the "cursor" parameter:
+//
+//	var posts []Post
+//	p, err := db.Table("posts").CursorPaginate("id", "desc", c.Query("cursor"), 20, &posts)
+//
+// Unlike offsets, cursors stay fast on deep pages and don't skip or repeat
+// rows inserted meanwhile. Existing OrderBy clauses are replaced; cursors
+// not made by CursorPaginate fail with ErrInvalidCursor.
+func (b *Builder) CursorPaginate(column string, direction, cursor string, perPage int, dest any) (*Pagination, error) {
+	items, err := sliceDest(dest)
+	if err != nil {
+		b.setError(err)
+	}
+	id, err := parseIdentifier(column, false)
+	if err != nil {
+		b.setError(err)
+	}
+	dir := "ASC"
+	if direction != "" {
+		if dir, err = normalizeDirection(direction); err != nil {
+			b.setError(err)
+		}
+	}
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		b.setError(err)
+	}
+	col, colArgs := b.column(column, false)
+	if err := b.invalid(); err != nil {
+		return nil, err
+	}
+	_, perPage = pageBounds(1, perPage)
+
+	// Rows before the cursor are read backwards from it and reversed.
+	backwards := (dir == "DESC") != c.Before
+	order, operator := "ASC", ">"
+	if backwards {
+		order, operator = "DESC", "<"
+	}
+
+	orders, wheres := b.orders, b.wheres
+	b.orders = []orderClause{{column: col, direction: order, args: colArgs}}
+	if cursor != "" {
+		b.wheres = nil
+		if len(wheres) > 0 {
+			sql, args := (&Builder{db: b.db, wheres: wheres}).buildWheres()
+			b.addRaw("AND", "("+sql+")", args)
+		}
+		b.addRaw("AND", col+" "+operator+" ?", append(append([]any{}, colArgs...), c.Value))
+	}
+	err = b.getPage(perPage+1, 0, dest)
+	b.orders, b.wheres = orders, wheres
+	if err != nil {
+		return nil, err
+	}
+
+	more := items.Len() > perPage
+	if more {
+		items.SetLen(perPage)
+	}
+	if c.Before {
+		reverse(items)
+	}
+
+	p := &Pagination{PerPage: perPage, param: "cursor"}
+	if n := items.Len(); n > 0 {
+		p.From, p.To = 1, n
+		first, err := cursorValue(items.Index(0), id.name())
+		if err != nil {
+			return nil, err
+		}
+		last, err := cursorValue(items.Index(n-1), id.name())
+		if err != nil {
+			return nil, err
+		}
+		if more || c.Before {
+			p.NextCursor = encodeCursor(pageCursor{Value: last})
+		}
+		if cursor != "" && (more || !c.Before) {
+			p.PrevCursor = encodeCursor(pageCursor{Value: first, Before: true})
+		}
+	}
+	p.HasMore = p.NextCursor != ""
+	p.Items = items.Interface()
+	return p, nil
+}
+
+// getPage scans limit rows from offset into dest, keeping the builder's
+// own Limit and Offset.
+func (b *Builder) getPage(limit, offset int, dest any) error {
+	originalLimit, originalOffset := b.limitVal, b.offsetVal
+	b.limitVal, b.offsetVal = limit, offset
+	defer func() { b.limitVal, b.offsetVal = originalLimit, originalOffset }()
+	return b.Get(dest)
+}
+
+// sliceDest returns the slice dest points to, emptied so the page
+// replaces earlier results.
+func sliceDest(dest any) (reflect.Value, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return reflect.Value{}, fmt.Errorf("%w: dest must be a pointer to a slice", ErrInvalidArgument)
+	}
+	v.Elem().SetLen(0)
+	return v.Elem(), nil
+}
+
+func reverse(items reflect.Value) {
+	swap := reflect.Swapper(items.Interface())
+	for i, j := 0, items.Len()-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
+
+// pageCursor is the position a cursor points to.
+type pageCursor struct {
+	Value  any  `json:"v"`
+	Before bool `json:"b,omitempty"`
+}
+
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (pageCursor, error) {
+	var c pageCursor
+	if cursor == "" {
+		return c, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	switch v := c.Value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			c.Value = i
+		} else if f, err := v.Float64(); err == nil {
+			c.Value = f
+		} else {
+			return c, ErrInvalidCursor
+		}
+	case string:
+	default:
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// cursorValue returns the value of column in item, a struct, a pointer to
+// a struct or a map.
+func cursorValue(item reflect.Value, column string) (any, error) {
+	for item.Kind() == reflect.Ptr || item.Kind() == reflect.Interface {
+		item = item.Elem()
+	}
+
+	var value reflect.Value
+	switch item.Kind() {
+	case reflect.Struct:
+		if index, ok := makeFieldMap(item.Type())[strings.ToLower(column)]; ok {
+			value = item.FieldByIndex(index)
+		}
+	case reflect.Map:
+		value = item.MapIndex(reflect.ValueOf(column))
+	}
+	if !value.IsValid() {
+		return nil, fmt.Errorf("%w: cursor column %q not found in dest", ErrInvalidArgument, column)
+	}
+
+	v := value.Interface()
+	if valuer, ok := v.(driver.Valuer); ok {
+		return valuer.Value()
+	}
+	return v, nil
+}
@@ -16,38 +16,38 @@ type RawResult struct {
 
 // Get executes the raw query and scans results into dest.
 func (r *RawResult) Get(dest any) error {
-	rows, err := r.db.execer().Query(r.query, r.args...)
+	err := r.db.query(r.db.context(), "", r.query, r.args, func(rows *sql.Rows) error {
+		return scanRows(rows, dest)
+	})
 	if err != nil {
-		r.db.lastError = err
-		return err
+		r.db.setError(err)
 	}
-	defer rows.Close()
-
-	return scanRows(rows, dest)
+	return err
 }
 
 // GetMap executes the raw query and returns results as []map[string]any.
 func (r *RawResult) GetMap() ([]map[string]any, error) {
-	rows, err := r.db.execer().Query(r.query, r.args...)
+	var results []map[string]any
+	err := r.db.query(r.db.context(), "", r.query, r.args, func(rows *sql.Rows) (err error) {
+		results, err = scanRowsToMap(rows)
+		return err
+	})
 	if err != nil {
-		r.db.lastError = err
+		r.db.setError(err)
 		return nil, err
 	}
-	defer rows.Close()
-
-	return scanRowsToMap(rows)
+	return results, nil
 }
 
 // First gets the first result.
 func (r *RawResult) First(dest any) error {
-	rows, err := r.db.execer().Query(r.query, r.args...)
+	err := r.db.query(r.db.context(), "", r.query, r.args, func(rows *sql.Rows) error {
+		return scanRow(rows, dest)
+	})
 	if err != nil {
-		r.db.lastError = err
-		return err
+		r.db.setError(err)
 	}
-	defer rows.Close()
-
-	return scanRow(rows, dest)
+	return err
 }
 
 // FirstMap gets the first result as map.
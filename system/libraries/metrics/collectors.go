@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"database/sql"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// RegisterRuntime adds Go runtime and process metrics to r.
+func RegisterRuntime(r *Registry) {
+	var (
+		mu      sync.Mutex
+		stats   runtime.MemStats
+		readAt  time.Time
+		started = float64(time.Now().Unix())
+	)
+	// One scrape reads several fields; ReadMemStats stops the world,
+	// so share a single read between them.
+	mem := func(field func(*runtime.MemStats) float64) func() float64 {
+		return func() float64 {
+			mu.Lock()
+			defer mu.Unlock()
+			if time.Since(readAt) > time.Second {
+				runtime.ReadMemStats(&stats)
+				readAt = time.Now()
+			}
+			return field(&stats)
+		}
+	}
+
+	r.GaugeFunc("go_goroutines", "Number of goroutines that currently exist.", nil,
+		func() float64 { return float64(runtime.NumGoroutine()) })
+	r.GaugeFunc("go_info", "Information about the Go environment.",
+		map[string]string{"version": runtime.Version()}, func() float64 { return 1 })
+	r.GaugeFunc("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", nil,
+		mem(func(m *runtime.MemStats) float64 { return float64(m.Alloc) }))
+	r.GaugeFunc("go_memstats_sys_bytes", "Number of bytes obtained from the system.", nil,
+		mem(func(m *runtime.MemStats) float64 { return float64(m.Sys) }))
+	r.GaugeFunc("go_memstats_heap_objects", "Number of allocated objects.", nil,
+		mem(func(m *runtime.MemStats) float64 { return float64(m.HeapObjects) }))
+	r.CounterFunc("go_gc_cycles_total", "Number of completed GC cycles.", nil,
+		mem(func(m *runtime.MemStats) float64 { return float64(m.NumGC) }))
+	r.CounterFunc("go_gc_pause_seconds_total", "Total time spent in GC stop-the-world pauses.", nil,
+		mem(func(m *runtime.MemStats) float64 { return float64(m.PauseTotalNs) / 1e9 }))
+	r.GaugeFunc("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", nil,
+		func() float64 { return started })
+}
+
+// RegisterDB adds connection pool metrics for db to r, labelled db=name.
+// Use it with database.DB.Conn():
+//
+//	metrics.RegisterDB(metrics.Default, "main", db.Conn())
+func RegisterDB(r *Registry, name string, db *sql.DB) {
+	labels := map[string]string{"db": name}
+	stat := func(field func(sql.DBStats) float64) func() float64 {
+		return func() float64 { return field(db.Stats()) }
+	}
+
+	r.GaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	r.GaugeFunc("db_open_connections", "Number of established connections, in use and idle.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	r.GaugeFunc("db_in_use_connections", "Number of connections currently in use.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	r.GaugeFunc("db_idle_connections", "Number of idle connections.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	r.CounterFunc("db_wait_count_total", "Total number of connections waited for.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	r.CounterFunc("db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", labels,
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	r.CounterFunc("db_max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	r.CounterFunc("db_max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
@@ -0,0 +1,340 @@
+// Package metrics provides counters, gauges and histograms exposed in the
+// Prometheus text format, without external dependencies.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry used when none is given. It includes the Go
+// runtime metrics.
+var Default = NewRegistry()
+
+func init() {
+	RegisterRuntime(Default)
+}
+
+// Registry holds metric families and renders them.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+type family struct {
+	name, help, typ string
+	collectors      []collector
+}
+
+// collector emits samples; suffix is appended to the family name
+// (e.g. "_bucket") and labels are name/value pairs.
+type collector interface {
+	collect(emit func(suffix string, labels []string, value float64))
+}
+
+// register adds c to the family name, creating it if needed. If the
+// family exists with a vec of the same type and label names, that vec is
+// returned so metrics can be declared from several places.
+func (r *Registry) register(name, help, typ string, c collector) collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, typ: typ}
+		r.families[name] = f
+	} else if f.typ != typ {
+		panic("metrics: " + name + " already registered as " + f.typ)
+	}
+
+	if v, ok := c.(labeled); ok {
+		for _, existing := range f.collectors {
+			if e, ok := existing.(labeled); ok {
+				if !slices.Equal(e.labelNames(), v.labelNames()) {
+					panic("metrics: " + name + " already registered with labels [" +
+						strings.Join(e.labelNames(), ", ") + "]")
+				}
+				return existing
+			}
+		}
+	}
+	f.collectors = append(f.collectors, c)
+	return c
+}
+
+// Counter returns the counter vec called name, creating it if needed.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec(labels)}
+	return r.register(name, help, "counter", c).(*Counter)
+}
+
+// Gauge returns the gauge vec called name, creating it if needed.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: newVec(labels)}
+	return r.register(name, help, "gauge", g).(*Gauge)
+}
+
+// Histogram returns the histogram vec called name, creating it if needed.
+// buckets may be nil to use DefBuckets.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{vec: newVec(labels), buckets: buckets}
+	return r.register(name, help, "histogram", h).(*Histogram)
+}
+
+// GaugeFunc registers a gauge whose value is read from fn on every scrape.
+// labels are constant label pairs, e.g. map[string]string{"db": "main"}.
+func (r *Registry) GaugeFunc(name, help string, labels map[string]string, fn func() float64) {
+	r.register(name, help, "gauge", newFuncCollector(labels, fn))
+}
+
+// CounterFunc registers a counter whose value is read from fn on every scrape.
+func (r *Registry) CounterFunc(name, help string, labels map[string]string, fn func() float64) {
+	r.register(name, help, "counter", newFuncCollector(labels, fn))
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		bw.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+		bw.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+		for _, c := range f.collectors {
+			c.collect(func(suffix string, labels []string, value float64) {
+				bw.WriteString(f.name + suffix)
+				writeLabels(bw, labels)
+				bw.WriteByte(' ')
+				bw.WriteString(formatValue(value))
+				bw.WriteByte('\n')
+			})
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler returns an http.Handler serving the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+func writeLabels(w *bufio.Writer, labels []string) {
+	if len(labels) == 0 {
+		return
+	}
+	w.WriteByte('{')
+	for i := 0; i < len(labels); i += 2 {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+	}
+	w.WriteByte('}')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// labeled is implemented by the vecs, as opposed to func collectors.
+type labeled interface {
+	labelNames() []string
+}
+
+// vec tracks series by label values.
+type vec struct {
+	labels []string
+	mu     sync.Mutex
+	series map[string]*series
+	keys   []string // insertion order, for stable output
+}
+
+type series struct {
+	labels []string // name/value pairs
+	value  float64
+	counts []uint64 // histogram buckets
+	sum    float64
+	count  uint64
+}
+
+func newVec(labels []string) vec {
+	return vec{labels: labels, series: make(map[string]*series)}
+}
+
+func (v *vec) labelNames() []string { return v.labels }
+
+// get returns the series for values; the caller must hold v.mu.
+func (v *vec) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic("metrics: expected " + strconv.Itoa(len(v.labels)) + " label values, got " + strconv.Itoa(len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: make([]string, 0, 2*len(values))}
+		for i, name := range v.labels {
+			s.labels = append(s.labels, name, values[i])
+		}
+		v.series[key] = s
+		v.keys = append(v.keys, key)
+	}
+	return s
+}
+
+func (v *vec) collectValues(emit func(string, []string, float64)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range v.keys {
+		s := v.series[key]
+		emit("", s.labels, s.value)
+	}
+}
+
+// Counter is a monotonically increasing value per label set.
+type Counter struct{ vec }
+
+// Inc adds one to the series for the label values.
+func (c *Counter) Inc(values ...string) { c.Add(1, values...) }
+
+// Add adds delta, which must not be negative.
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.mu.Lock()
+	c.get(values).value += delta
+	c.mu.Unlock()
+}
+
+func (c *Counter) collect(emit func(string, []string, float64)) { c.collectValues(emit) }
+
+// Gauge is a value that can go up and down per label set.
+type Gauge struct{ vec }
+
+// Set sets the series for the label values to v.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.mu.Lock()
+	g.get(values).value = v
+	g.mu.Unlock()
+}
+
+// Add adds delta to the series.
+func (g *Gauge) Add(delta float64, values ...string) {
+	g.mu.Lock()
+	g.get(values).value += delta
+	g.mu.Unlock()
+}
+
+// Inc adds one to the series.
+func (g *Gauge) Inc(values ...string) { g.Add(1, values...) }
+
+// Dec subtracts one from the series.
+func (g *Gauge) Dec(values ...string) { g.Add(-1, values...) }
+
+func (g *Gauge) collect(emit func(string, []string, float64)) { g.collectValues(emit) }
+
+// Histogram counts observations in cumulative buckets per label set.
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+// Observe records v in the series for the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	s := h.get(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+	h.mu.Unlock()
+}
+
+func (h *Histogram) collect(emit func(string, []string, float64)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range h.keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			emit("_bucket", append(s.labels[:len(s.labels):len(s.labels)], "le", formatValue(upper)), float64(cumulative))
+		}
+		emit("_bucket", append(s.labels[:len(s.labels):len(s.labels)], "le", "+Inf"), float64(s.count))
+		emit("_sum", s.labels, s.sum)
+		emit("_count", s.labels, float64(s.count))
+	}
+}
+
+// funcCollector reads its value on every scrape.
+type funcCollector struct {
+	labels []string
+	fn     func() float64
+}
+
+func newFuncCollector(labels map[string]string, fn func() float64) *funcCollector {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c := &funcCollector{fn: fn}
+	for _, name := range names {
+		c.labels = append(c.labels, name, labels[name])
+	}
+	return c
+}
+
+func (c *funcCollector) collect(emit func(string, []string, float64)) {
+	emit("", c.labels, c.fn())
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("jobs_total", "Jobs processed.", "queue")
+	c.Inc("mail")
+	c.Add(2, "mail")
+	c.Inc(`we"ird`)
+
+	g := r.Gauge("temperature", "Current temperature.")
+	g.Set(21.5)
+	g.Dec()
+
+	h := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(3, "/a")
+
+	r.GaugeFunc("answer", "The answer.", map[string]string{"kind": "const"}, func() float64 { return 42 })
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP answer The answer.
+# TYPE answer gauge
+answer{kind="const"} 42
+# HELP jobs_total Jobs processed.
+# TYPE jobs_total counter
+jobs_total{queue="mail"} 3
+jobs_total{queue="we\"ird"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 3.55
+latency_seconds_count{route="/a"} 3
+# HELP temperature Current temperature.
+# TYPE temperature gauge
+temperature 20.5
+`
+	if b.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestRegistry_Reuse(t *testing.T) {
+	r := NewRegistry()
+	a := r.Counter("hits_total", "Hits.")
+	b := r.Counter("hits_total", "Hits.")
+	if a != b {
+		t.Error("Expected the same counter for the same name")
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic when reusing a name with other labels")
+			}
+		}()
+		r.Counter("hits_total", "Hits.", "path")
+	}()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic when reusing a name with another type")
+		}
+	}()
+	r.Gauge("hits_total", "Hits.")
+}
+
+func TestRegisterRuntimeAndDB(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r := NewRegistry()
+	RegisterRuntime(r)
+	RegisterDB(r, "main", db)
+
+	var b strings.Builder
+	r.WriteText(&b)
+	for _, want := range []string{"go_goroutines ", "go_memstats_alloc_bytes ", `db_open_connections{db="main"} `} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Expected %q in output", want)
+		}
+	}
+}
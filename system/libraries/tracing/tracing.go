@@ -0,0 +1,460 @@
+// Package tracing provides distributed tracing with W3C Trace Context
+// propagation and pluggable span exporters.
+//
+// Spans are created with Start, which continues the span found in the
+// context. Without a configured tracer Start returns a nil *Span, whose
+// methods are no-ops, so instrumented code costs almost nothing.
+//
+//	tracer := tracing.NewTracer(tracing.Config{
+//		ServiceName: "shop",
+//		Exporter:    tracing.NewOTLPExporter(tracing.OTLPConfig{Endpoint: "http://collector:4318"}),
+//	})
+//	defer tracer.Shutdown(context.Background())
+//	tracing.SetTracer(tracer)
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the ID as 32 lowercase hex characters.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether id is not all zeros.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the ID as 16 lowercase hex characters.
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether id is not all zeros.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// SpanContext is the part of a span that is propagated across processes.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+	Remote     bool
+}
+
+// IsValid reports whether both IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// SpanKind describes the role of a span, numbered as in OTLP.
+type SpanKind int
+
+// Span kinds.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// String returns the kind's name.
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// StatusCode is the outcome of a span, numbered as in OTLP.
+type StatusCode int
+
+// Status codes.
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Span is an operation within a trace. A nil *Span is valid and ignores
+// all calls.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	kind   SpanKind
+	start  time.Time
+
+	mu        sync.Mutex
+	name      string
+	attrs     map[string]any
+	status    StatusCode
+	statusMsg string
+	ended     bool
+}
+
+// SpanContext returns the span's propagation context.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetName renames the span.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute sets an attribute. Values should be strings, bools,
+// integers or floats; others are exported as their fmt representation.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		// The exporter owns the attributes now.
+		return
+	}
+	if s.attrs == nil {
+		s.attrs = make(map[string]any)
+	}
+	s.attrs[key] = value
+}
+
+// SetStatus sets the span's status.
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status, s.statusMsg = code, message
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed with err. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End finishes the span and hands it to the exporter if sampled.
+// Calls after the first are ignored.
+func (s *Span) End() {
+	s.EndAt(time.Now())
+}
+
+// EndAt is like End but records end as the span's end time, for
+// operations reported after they finished (see StartAt).
+func (s *Span) EndAt(end time.Time) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		Service:       s.tracer.service,
+		Name:          s.name,
+		Kind:          s.kind,
+		TraceID:       s.sc.TraceID,
+		SpanID:        s.sc.SpanID,
+		ParentSpanID:  s.parent,
+		Start:         s.start,
+		End:           end,
+		Attributes:    s.attrs,
+		Status:        s.status,
+		StatusMessage: s.statusMsg,
+	}
+	s.mu.Unlock()
+
+	if s.sc.Sampled {
+		s.tracer.enqueue(data)
+	}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan returns ctx carrying span as the current span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteSpanContext returns ctx carrying a parent received
+// from another process.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context of the current span,
+// or of the remote parent if there is no local span.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultTracer *Tracer
+)
+
+// SetTracer sets the tracer used by Start when the context holds no span.
+func SetTracer(t *Tracer) {
+	defaultMu.Lock()
+	defaultTracer = t
+	defaultMu.Unlock()
+}
+
+// Default returns the tracer set with SetTracer, or nil.
+func Default() *Tracer {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultTracer
+}
+
+// Start starts a span as a child of the span in ctx, using that span's
+// tracer or the default one. It returns a nil span when there is no
+// tracer.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	return StartAt(ctx, name, kind, time.Now())
+}
+
+// StartAt is like Start but records start as the span's start time.
+func StartAt(ctx context.Context, name string, kind SpanKind, start time.Time) (context.Context, *Span) {
+	t := Default()
+	if parent := SpanFromContext(ctx); parent != nil {
+		t = parent.tracer
+	}
+	if t == nil {
+		return ctx, nil
+	}
+	return t.StartAt(ctx, name, kind, start)
+}
+
+// Config holds configuration for a Tracer.
+type Config struct {
+	// ServiceName identifies the application in exported spans.
+	ServiceName string
+
+	// Exporter receives finished spans.
+	Exporter Exporter
+
+	// SampleRate is the fraction of new traces that are recorded
+	// (default: 1). Traces continued from a parent follow its decision.
+	SampleRate float64
+
+	// BatchSize is how many spans are exported at once (default: 128).
+	BatchSize int
+
+	// FlushInterval bounds how long spans wait for a batch (default: 5s).
+	FlushInterval time.Duration
+
+	// QueueSize is how many spans may wait for export; more are dropped
+	// (default: 2048).
+	QueueSize int
+}
+
+// Tracer creates spans and exports them in batches from a background
+// goroutine, which Shutdown stops.
+type Tracer struct {
+	service    string
+	exporter   Exporter
+	sampleRate float64
+	batchSize  int
+	interval   time.Duration
+
+	queue    chan SpanData
+	flush    chan chan error
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewTracer creates a tracer and starts its export loop.
+func NewTracer(config Config) *Tracer {
+	if config.SampleRate == 0 {
+		config.SampleRate = 1
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = 128
+	}
+	if config.FlushInterval == 0 {
+		config.FlushInterval = 5 * time.Second
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = 2048
+	}
+
+	t := &Tracer{
+		service:    config.ServiceName,
+		exporter:   config.Exporter,
+		sampleRate: config.SampleRate,
+		batchSize:  config.BatchSize,
+		interval:   config.FlushInterval,
+		queue:      make(chan SpanData, config.QueueSize),
+		flush:      make(chan chan error),
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+// Start starts a span as a child of the span (or remote parent) in ctx
+// and returns a context carrying it.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	return t.StartAt(ctx, name, kind, time.Now())
+}
+
+// StartAt is like Start but records start as the span's start time.
+func (t *Tracer) StartAt(ctx context.Context, name string, kind SpanKind, start time.Time) (context.Context, *Span) {
+	span := &Span{
+		tracer: t,
+		kind:   kind,
+		name:   name,
+		start:  start,
+	}
+
+	if parent := SpanContextFromContext(ctx); parent.IsValid() {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Sampled = parent.Sampled
+		span.sc.TraceState = parent.TraceState
+		span.parent = parent.SpanID
+	} else {
+		putRandom(span.sc.TraceID[:])
+		span.sc.Sampled = t.sampleRate >= 1 || rand.Float64() < t.sampleRate
+	}
+	putRandom(span.sc.SpanID[:])
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// Flush exports all queued spans.
+func (t *Tracer) Flush(ctx context.Context) error {
+	done := make(chan error, 1)
+	select {
+	case t.flush <- done:
+	case <-t.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports queued spans and stops the export loop.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	err := t.Flush(ctx)
+	t.stopOnce.Do(func() { close(t.stop) })
+	select {
+	case <-t.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return err
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	select {
+	case t.queue <- data:
+	default:
+		// Queue full: drop rather than slow down requests.
+	}
+}
+
+func (t *Tracer) loop() {
+	defer close(t.stopped)
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, t.batchSize)
+	export := func() error {
+		if len(batch) == 0 || t.exporter == nil {
+			batch = batch[:0]
+			return nil
+		}
+		err := t.exporter.Export(context.Background(), batch)
+		batch = make([]SpanData, 0, t.batchSize)
+		return err
+	}
+	drain := func() {
+		for {
+			select {
+			case data := <-t.queue:
+				batch = append(batch, data)
+				if len(batch) >= t.batchSize {
+					export()
+				}
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case data := <-t.queue:
+			batch = append(batch, data)
+			if len(batch) >= t.batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case done := <-t.flush:
+			drain()
+			done <- export()
+		case <-t.stop:
+			drain()
+			export()
+			return
+		}
+	}
+}
+
+func putRandom(b []byte) {
+	for i := 0; i < len(b); i += 8 {
+		v := rand.Uint64()
+		for j := i; j < len(b) && j < i+8; j++ {
+			b[j] = byte(v)
+			v >>= 8
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recordingExporter) Export(_ context.Context, spans []SpanData) error {
+	r.mu.Lock()
+	r.spans = append(r.spans, spans...)
+	r.mu.Unlock()
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(valid)
+	if !ok || !sc.Sampled {
+		t.Fatalf("Expected valid sampled context, got %+v", sc)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("Unexpected IDs %s %s", sc.TraceID, sc.SpanID)
+	}
+	if sc.Traceparent() != valid {
+		t.Errorf("Expected round trip, got %q", sc.Traceparent())
+	}
+
+	// Future versions may append fields.
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Error("Expected future version to parse")
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	// Without a tracer spans are nil and safe to use.
+	ctx, span := Start(context.Background(), "noop", SpanKindInternal)
+	span.SetAttribute("k", "v")
+	span.End()
+	if SpanFromContext(ctx) != nil {
+		t.Error("Expected no span without a tracer")
+	}
+
+	rec := &recordingExporter{}
+	tracer := NewTracer(Config{ServiceName: "svc", Exporter: rec})
+
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(TracestateHeader, "a=1")
+	ctx, parent := tracer.Start(Extract(context.Background(), h), "parent", SpanKindServer)
+	_, child := Start(ctx, "child", SpanKindInternal)
+	child.RecordError(io.EOF)
+	child.End()
+	parent.End()
+	parent.SetAttribute("late", true)
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if out.Get(TraceparentHeader) != parent.SpanContext().Traceparent() || out.Get(TracestateHeader) != "a=1" {
+		t.Errorf("Unexpected injected headers %v", out)
+	}
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(rec.spans))
+	}
+	c, p := rec.spans[0], rec.spans[1]
+	if p.ParentSpanID.String() != "00f067aa0ba902b7" || p.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected parent to continue remote trace, got %+v", p)
+	}
+	if c.ParentSpanID != p.SpanID || c.TraceID != p.TraceID {
+		t.Errorf("Expected child of parent, got %+v", c)
+	}
+	if c.Status != StatusError || c.StatusMessage != "EOF" {
+		t.Errorf("Expected error status, got %v %q", c.Status, c.StatusMessage)
+	}
+	if _, ok := p.Attributes["late"]; ok {
+		t.Error("Expected attributes set after End to be ignored")
+	}
+}
+
+func TestSampling(t *testing.T) {
+	rec := &recordingExporter{}
+	tracer := NewTracer(Config{Exporter: rec, SampleRate: 0.0000001})
+
+	ctx, span := tracer.Start(context.Background(), "dropped", SpanKindInternal)
+	_, child := Start(ctx, "child", SpanKindInternal)
+	child.End()
+	span.End()
+
+	tracer.Shutdown(context.Background())
+	if len(rec.spans) != 0 {
+		t.Errorf("Expected unsampled trace to be dropped, got %d spans", len(rec.spans))
+	}
+	if span.SpanContext().Traceparent()[53:] != "00" {
+		t.Errorf("Expected unsampled flag, got %s", span.SpanContext().Traceparent())
+	}
+}
+
+func TestJSONExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(Config{ServiceName: "svc", Exporter: NewJSONExporter(&buf)})
+	_, span := tracer.Start(context.Background(), "work", SpanKindClient)
+	span.SetAttribute("rows", 3)
+	span.End()
+	tracer.Shutdown(context.Background())
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Invalid JSON line %q: %v", buf.String(), err)
+	}
+	if got["name"] != "work" || got["kind"] != "client" || got["service"] != "svc" ||
+		got["trace_id"] != span.SpanContext().TraceID.String() {
+		t.Errorf("Unexpected span %v", got)
+	}
+	if attrs, _ := got["attributes"].(map[string]any); attrs["rows"] != float64(3) {
+		t.Errorf("Unexpected attributes %v", got["attributes"])
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		path    string
+		auth    string
+		payload otlpTraces
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer collector.Close()
+
+	tracer := NewTracer(Config{
+		ServiceName: "shop",
+		Exporter: NewOTLPExporter(OTLPConfig{
+			Endpoint: collector.URL,
+			Headers:  map[string]string{"Authorization": "Bearer token"},
+		}),
+	})
+	_, span := tracer.Start(context.Background(), "GET /", SpanKindServer)
+	span.SetAttribute("http.response.status_code", 200)
+	span.SetAttribute("ok", true)
+	span.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if path != "/v1/traces" || auth != "Bearer token" {
+		t.Errorf("Unexpected request to %q with auth %q", path, auth)
+	}
+	if len(payload.ResourceSpans) != 1 || len(payload.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("Unexpected payload %+v", payload)
+	}
+	res := payload.ResourceSpans[0]
+	if v := res.Resource.Attributes[0]; v.Key != "service.name" || *v.Value.StringValue != "shop" {
+		t.Errorf("Unexpected resource %+v", res.Resource)
+	}
+	got := res.ScopeSpans[0].Spans[0]
+	if got.Name != "GET /" || got.Kind != int(SpanKindServer) || got.TraceID != span.SpanContext().TraceID.String() {
+		t.Errorf("Unexpected span %+v", got)
+	}
+	attrs := map[string]otlpValue{}
+	for _, kv := range got.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if v := attrs["http.response.status_code"].IntValue; v == nil || *v != "200" {
+		t.Errorf("Expected int attribute encoded as string, got %+v", attrs)
+	}
+	if v := attrs["ok"].BoolValue; v == nil || !*v {
+		t.Errorf("Expected bool attribute, got %+v", attrs)
+	}
+}
+
+func TestOTLPExporter_Error(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	err := NewOTLPExporter(OTLPConfig{Endpoint: collector.URL}).Export(context.Background(), []SpanData{{Name: "x"}})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected export error, got %v", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(TraceparentHeader)
+	}))
+	defer server.Close()
+
+	rec := &recordingExporter{}
+	tracer := NewTracer(Config{Exporter: rec})
+	ctx, parent := tracer.Start(context.Background(), "handler", SpanKindServer)
+
+	client := &http.Client{Transport: &Transport{}}
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/items", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.End()
+	tracer.Shutdown(context.Background())
+
+	if req.Header.Get(TraceparentHeader) != "" {
+		t.Error("Expected the caller's request to be left unchanged")
+	}
+	if len(rec.spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(rec.spans))
+	}
+	client0 := rec.spans[0]
+	if client0.Name != "HTTP GET" || client0.Kind != SpanKindClient || client0.ParentSpanID != parent.SpanContext().SpanID {
+		t.Errorf("Unexpected client span %+v", client0)
+	}
+	sc, ok := ParseTraceparent(received)
+	if !ok || sc.SpanID != client0.SpanID || sc.TraceID != client0.TraceID {
+		t.Errorf("Expected server to receive the client span, got %q", received)
+	}
+}
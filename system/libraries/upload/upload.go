@@ -77,6 +77,10 @@ var (
 	ErrInvalidDim     = errors.New("the image dimensions are invalid")
 )
 
+// multipartOverhead is the room left for non-file fields and multipart
+// framing when limiting the request body to Config.MaxSize.
+const multipartOverhead = 1 << 20
+
 // New creates a new Upload instance with default configuration
 func New(config Config) *Upload {
 	return &Upload{
@@ -93,7 +97,21 @@ func (u *Upload) Do(field string, r *http.Request) (*Result, error) {
 
 	// Parse multipart form if needed
 	if r.MultipartForm == nil {
-		if err := r.ParseMultipartForm(32 << 20); err != nil {
+		maxMemory := int64(32 << 20)
+		if u.config.MaxSize > 0 {
+			// Stop reading the body once it can no longer hold a valid file,
+			// leaving some room for the other form fields and boundaries.
+			limit := u.config.MaxSize*1024 + multipartOverhead
+			r.Body = http.MaxBytesReader(nil, r.Body, limit)
+			if limit < maxMemory {
+				maxMemory = limit
+			}
+		}
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, ErrFileTooBig
+			}
 			return nil, ErrNoFile
 		}
 	}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/semutdev/goigniter/system/core"
+)
+
+// BodyLimitConfig holds configuration for the body limit middleware.
+type BodyLimitConfig struct {
+	// Limit is the maximum request body size, e.g. "512KB", "2MB", "1GB".
+	Limit string
+
+	// Decompress transparently inflates gzip and deflate encoded bodies.
+	Decompress bool
+
+	// MaxDecompressedSize caps the inflated body (default: Limit),
+	// protecting against decompression bombs.
+	MaxDecompressedSize string
+}
+
+// BodyLimit returns a middleware that rejects request bodies larger than
+// limit (e.g. "2MB") with 413 Request Entity Too Large.
+func BodyLimit(limit string) core.Middleware {
+	return BodyLimitWithConfig(BodyLimitConfig{Limit: limit})
+}
+
+// BodyLimitWithConfig returns a BodyLimit middleware with custom config.
+// It panics if a size can't be parsed.
+//
+// Bodies announcing a larger Content-Length are refused up front; others
+// are cut off while being read, in which case c.Body(), c.Bind() and
+// form parsing return a 413 error for the ErrorHandler.
+func BodyLimitWithConfig(config BodyLimitConfig) core.Middleware {
+	limit, err := ParseByteSize(config.Limit)
+	if err != nil {
+		panic("middleware: invalid BodyLimit: " + err.Error())
+	}
+	maxDecompressed := limit
+	if config.MaxDecompressedSize != "" {
+		if maxDecompressed, err = ParseByteSize(config.MaxDecompressedSize); err != nil {
+			panic("middleware: invalid MaxDecompressedSize: " + err.Error())
+		}
+	}
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			req := c.Request
+			if req.Body == nil || req.Body == http.NoBody {
+				return next(c)
+			}
+			if req.ContentLength > limit {
+				return core.NewHTTPError(http.StatusRequestEntityTooLarge)
+			}
+
+			req.Body = http.MaxBytesReader(c.Response, req.Body, limit)
+
+			if config.Decompress {
+				encoding := strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding")))
+				var zr io.ReadCloser
+				switch encoding {
+				case "gzip", "x-gzip":
+					gz, err := gzip.NewReader(req.Body)
+					if err != nil {
+						return core.NewHTTPError(http.StatusBadRequest, "Invalid gzip body").WithInternal(err)
+					}
+					zr = gz
+				case "deflate":
+					// HTTP deflate is a zlib stream (RFC 9110 section 8.4.1.2).
+					z, err := zlib.NewReader(req.Body)
+					if err != nil {
+						return core.NewHTTPError(http.StatusBadRequest, "Invalid deflate body").WithInternal(err)
+					}
+					zr = z
+				}
+				if zr != nil {
+					req.Body = &decompressedBody{
+						Reader: http.MaxBytesReader(c.Response, zr, maxDecompressed),
+						zr:     zr,
+						src:    req.Body,
+					}
+					req.Header.Del("Content-Encoding")
+					req.Header.Del("Content-Length")
+					req.ContentLength = -1
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// decompressedBody closes both the decompressor and the raw body.
+type decompressedBody struct {
+	io.Reader
+	zr  io.Closer
+	src io.Closer
+}
+
+func (b *decompressedBody) Close() error {
+	b.zr.Close()
+	return b.src.Close()
+}
+
+// ParseByteSize parses sizes like "100", "512B", "64KB", "2MB" or "1GB"
+// (powers of 1024, case-insensitive, optional "iB" suffix).
+func ParseByteSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	if v == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "IB"), "B")
+
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(v, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(v, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(v, "G"):
+		mult = 1 << 30
+	case strings.HasSuffix(v, "T"):
+		mult = 1 << 40
+	}
+	if mult > 1 {
+		v = v[:len(v)-1]
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
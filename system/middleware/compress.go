@@ -0,0 +1,326 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/semutdev/goigniter/system/core"
+)
+
+// CompressConfig holds configuration for the compression middleware.
+type CompressConfig struct {
+	// Level is the compression level, from gzip.BestSpeed to
+	// gzip.BestCompression (default: gzip.DefaultCompression). Use
+	// NoCompression for no compression, as 0 means the default.
+	Level int
+
+	// MinLength is the smallest body worth compressing (default: 1024).
+	// Responses flushed before reaching it (e.g. SSE) are compressed anyway.
+	MinLength int
+
+	// ContentTypes lists compressible media types. Entries ending in "/"
+	// match a whole family, e.g. "text/". Types with a +json or +xml
+	// suffix are always compressible.
+	ContentTypes []string
+
+	// Skip bypasses compression for matching requests.
+	Skip func(c *core.Context) bool
+}
+
+// NoCompression is the CompressConfig.Level that stores the response
+// uncompressed in the gzip or deflate format.
+const NoCompression = -3
+
+// DefaultCompressConfig returns a default compression configuration.
+func DefaultCompressConfig() CompressConfig {
+	return CompressConfig{
+		Level:     gzip.DefaultCompression,
+		MinLength: 1024,
+		ContentTypes: []string{
+			"text/",
+			"application/json",
+			"application/javascript",
+			"application/x-javascript",
+			"application/xml",
+			"application/xhtml+xml",
+			"application/wasm",
+			"image/svg+xml",
+			"image/x-icon",
+			"font/ttf",
+			"font/otf",
+		},
+	}
+}
+
+// Compress returns a middleware that gzip/deflate-compresses responses
+// for clients that accept it.
+func Compress() core.Middleware {
+	return CompressWithConfig(DefaultCompressConfig())
+}
+
+// CompressWithConfig returns a Compress middleware with custom config.
+//
+// The decision is made once MinLength bytes are buffered, on the first
+// Flush, or when the handler returns. Already-encoded responses, partial
+// content and types outside ContentTypes are passed through unchanged.
+func CompressWithConfig(config CompressConfig) core.Middleware {
+	defaults := DefaultCompressConfig()
+	switch config.Level {
+	case 0:
+		config.Level = defaults.Level
+	case NoCompression:
+		config.Level = gzip.NoCompression
+	}
+	if config.MinLength == 0 {
+		config.MinLength = defaults.MinLength
+	}
+	if len(config.ContentTypes) == 0 {
+		config.ContentTypes = defaults.ContentTypes
+	}
+
+	var gzipPool, zlibPool sync.Pool
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			if c.Method() == http.MethodHead || (config.Skip != nil && config.Skip(c)) {
+				return next(c)
+			}
+
+			c.Response.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(c.Header("Accept-Encoding"))
+			if encoding == "" {
+				return next(c)
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: c.Response,
+				config:         &config,
+				encoding:       encoding,
+			}
+			if encoding == "gzip" {
+				cw.pool = &gzipPool
+			} else {
+				cw.pool = &zlibPool
+			}
+
+			c.Response = cw
+			defer func() {
+				cw.Close()
+				c.Response = cw.ResponseWriter
+			}()
+
+			return next(c)
+		}
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if p := strings.TrimSpace(params); strings.HasPrefix(p, "q=") {
+			if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+				q = v
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		switch name {
+		case "gzip", "x-gzip", "*":
+			name = "gzip"
+		case "deflate":
+		default:
+			continue
+		}
+		// Prefer gzip on ties: it has the widest support.
+		if q > bestQ || (q == bestQ && name == "gzip") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the start of the response until it can decide
+// whether to compress, then streams through a gzip or zlib writer. HTTP
+// deflate is a zlib stream (RFC 9110 section 8.4.1.2), not raw DEFLATE.
+type compressWriter struct {
+	http.ResponseWriter
+	config   *CompressConfig
+	encoding string
+	pool     *sync.Pool
+
+	buf         []byte
+	code        int
+	decided     bool
+	compressing bool
+	zw          io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided || w.code != 0 {
+		return
+	}
+	w.code = code
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if w.decided {
+		return w.write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.config.MinLength {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush decides immediately so streamed responses aren't held back.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+	if w.compressing {
+		if f, ok := w.zw.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close flushes buffered data and finishes the compressed stream.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.code == 0 {
+			// Nothing written: leave the response to the error handler.
+			return nil
+		}
+		if err := w.decide(len(w.buf) >= w.config.MinLength); err != nil {
+			return err
+		}
+	}
+	if w.compressing {
+		err := w.zw.Close()
+		w.pool.Put(w.zw)
+		w.zw = nil
+		w.compressing = false
+		return err
+	}
+	return nil
+}
+
+func (w *compressWriter) write(p []byte) (int, error) {
+	if w.compressing {
+		return w.zw.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide sends the headers and buffered data, compressing when allowed.
+func (w *compressWriter) decide(bigEnough bool) error {
+	w.decided = true
+	h := w.ResponseWriter.Header()
+
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	if bigEnough && w.compressible(h) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			// The representation changed, so a strong validator no longer holds.
+			h.Set("ETag", "W/"+etag)
+		}
+		w.compressing = true
+		w.zw = w.acquire()
+	}
+
+	w.ResponseWriter.WriteHeader(w.code)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.write(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *compressWriter) compressible(h http.Header) bool {
+	switch {
+	case w.code < 200, w.code == http.StatusNoContent, w.code == http.StatusNotModified,
+		w.code == http.StatusPartialContent:
+		return false
+	case h.Get("Content-Encoding") != "", h.Get("Content-Range") != "":
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	if strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	for _, t := range w.config.ContentTypes {
+		if t == mediaType || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *compressWriter) acquire() io.WriteCloser {
+	if zw, ok := w.pool.Get().(io.WriteCloser); ok {
+		switch z := zw.(type) {
+		case *gzip.Writer:
+			z.Reset(w.ResponseWriter)
+		case *zlib.Writer:
+			z.Reset(w.ResponseWriter)
+		}
+		return zw
+	}
+	if w.encoding == "gzip" {
+		zw, err := gzip.NewWriterLevel(w.ResponseWriter, w.config.Level)
+		if err != nil {
+			zw = gzip.NewWriter(w.ResponseWriter)
+		}
+		return zw
+	}
+	zw, err := zlib.NewWriterLevel(w.ResponseWriter, w.config.Level)
+	if err != nil {
+		zw = zlib.NewWriter(w.ResponseWriter)
+	}
+	return zw
+}
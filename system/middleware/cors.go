@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -10,12 +11,35 @@ import (
 
 // CORSConfig holds configuration for the CORS middleware.
 type CORSConfig struct {
-	AllowOrigins     []string
-	AllowMethods     []string
-	AllowHeaders     []string
-	ExposeHeaders    []string
+	// AllowOrigins lists allowed origins. "*" allows any origin, and a
+	// "*" inside an entry matches subdomains, e.g. "https://*.example.com".
+	AllowOrigins []string
+
+	// AllowOriginPatterns lists regular expressions matched against the
+	// whole origin, e.g. `^https://pr-\d+\.preview\.example\.com$`.
+	AllowOriginPatterns []string
+
+	// AllowOriginFunc decides for origins not matched above.
+	AllowOriginFunc func(origin string) bool
+
+	AllowMethods []string
+
+	// AllowHeaders lists headers allowed in requests. When empty, the
+	// preflight's Access-Control-Request-Headers are reflected.
+	AllowHeaders []string
+
+	ExposeHeaders []string
+
+	// AllowCredentials allows cookies and auth headers. The allowed origins
+	// must then be listed, matched by a pattern or AllowOriginFunc rather
+	// than "*", since any website could read credentialed responses.
 	AllowCredentials bool
-	MaxAge           int
+
+	// AllowPrivateNetwork answers Private Network Access preflights.
+	AllowPrivateNetwork bool
+
+	// MaxAge is how long, in seconds, preflight results may be cached.
+	MaxAge int
 }
 
 // DefaultCORSConfig returns a default CORS configuration.
@@ -34,46 +58,131 @@ func CORS() core.Middleware {
 }
 
 // CORSWithConfig returns a CORS middleware with custom config.
+// It panics if an origin pattern doesn't compile, or if AllowOrigins
+// contains "*" while AllowCredentials is set.
+//
+// Preflight requests (OPTIONS with Access-Control-Request-Method) from
+// allowed origins are answered with 204. Routes without an OPTIONS
+// handler still pass OPTIONS requests through their middleware, so the
+// middleware works globally or per group:
+//
+//	api := app.Group("/api", middleware.CORSWithConfig(middleware.CORSConfig{
+//		AllowOrigins:     []string{"https://*.example.com"},
+//		AllowCredentials: true,
+//	}))
 func CORSWithConfig(config CORSConfig) core.Middleware {
 	allowMethods := strings.Join(config.AllowMethods, ", ")
 	allowHeaders := strings.Join(config.AllowHeaders, ", ")
 	exposeHeaders := strings.Join(config.ExposeHeaders, ", ")
 	maxAge := strconv.Itoa(config.MaxAge)
 
+	allowAll := false
+	var exact []string
+	var wildcards [][2]string
+	for _, o := range config.AllowOrigins {
+		switch prefix, suffix, ok := strings.Cut(o, "*"); {
+		case o == "*":
+			allowAll = true
+		case ok:
+			wildcards = append(wildcards, [2]string{strings.ToLower(prefix), strings.ToLower(suffix)})
+		default:
+			exact = append(exact, o)
+		}
+	}
+	if allowAll && config.AllowCredentials {
+		panic(`middleware: CORS AllowOrigins "*" can't be combined with AllowCredentials`)
+	}
+	patterns := make([]*regexp.Regexp, len(config.AllowOriginPatterns))
+	for i, p := range config.AllowOriginPatterns {
+		patterns[i] = regexp.MustCompile(p)
+	}
+
+	allowed := func(origin string) bool {
+		if allowAll {
+			return true
+		}
+		for _, o := range exact {
+			if strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		lower := strings.ToLower(origin)
+		for _, w := range wildcards {
+			if matchOriginWildcard(lower, w[0], w[1]) {
+				return true
+			}
+		}
+		for _, re := range patterns {
+			if re.MatchString(origin) {
+				return true
+			}
+		}
+		return config.AllowOriginFunc != nil && config.AllowOriginFunc(origin)
+	}
+
+	// The response differs per origin unless it is a plain "*".
+	varyOrigin := !allowAll
+
 	return func(next core.HandlerFunc) core.HandlerFunc {
 		return func(c *core.Context) error {
-			origin := c.Header("Origin")
+			h := c.Response.Header()
+			if varyOrigin {
+				h.Add("Vary", "Origin")
+			}
 
-			allowOrigin := ""
-			for _, o := range config.AllowOrigins {
-				if o == "*" || o == origin {
-					allowOrigin = o
-					break
-				}
+			origin := c.Header("Origin")
+			preflight := c.Method() == http.MethodOptions && c.Header("Access-Control-Request-Method") != ""
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
 			}
 
-			if allowOrigin == "" {
+			if origin == "" || !allowed(origin) {
 				return next(c)
 			}
 
-			c.SetHeader("Access-Control-Allow-Origin", allowOrigin)
-
+			if allowAll {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
 			if config.AllowCredentials {
-				c.SetHeader("Access-Control-Allow-Credentials", "true")
+				h.Set("Access-Control-Allow-Credentials", "true")
 			}
 
-			if exposeHeaders != "" {
-				c.SetHeader("Access-Control-Expose-Headers", exposeHeaders)
+			if !preflight {
+				if exposeHeaders != "" {
+					h.Set("Access-Control-Expose-Headers", exposeHeaders)
+				}
+				return next(c)
 			}
 
-			if c.Method() == http.MethodOptions {
-				c.SetHeader("Access-Control-Allow-Methods", allowMethods)
-				c.SetHeader("Access-Control-Allow-Headers", allowHeaders)
-				c.SetHeader("Access-Control-Max-Age", maxAge)
-				return c.NoContent(http.StatusNoContent)
+			if allowMethods != "" {
+				h.Set("Access-Control-Allow-Methods", allowMethods)
 			}
-
-			return next(c)
+			if allowHeaders != "" {
+				h.Set("Access-Control-Allow-Headers", allowHeaders)
+			} else if requested := c.Header("Access-Control-Request-Headers"); requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+			if config.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			if config.AllowPrivateNetwork && c.Header("Access-Control-Request-Private-Network") == "true" {
+				h.Set("Access-Control-Allow-Private-Network", "true")
+			}
+			return c.NoContent(http.StatusNoContent)
 		}
 	}
 }
+
+// matchOriginWildcard reports whether origin is prefix + one or more
+// subdomain labels + suffix, e.g. "https://" + "a.b" + ".example.com".
+func matchOriginWildcard(origin, prefix, suffix string) bool {
+	if len(origin) <= len(prefix)+len(suffix) ||
+		!strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	middle := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(middle, "/:@")
+}
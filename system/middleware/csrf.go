@@ -0,0 +1,300 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/semutdev/goigniter/system/core"
+	"github.com/semutdev/goigniter/system/libraries/session"
+)
+
+// CSRF token storage modes for CSRFConfig.Mode.
+const (
+	// CSRFModeSession keeps the token in the session (synchronizer token).
+	CSRFModeSession = "session"
+	// CSRFModeCookie keeps a signed token in its own cookie (double submit).
+	CSRFModeCookie = "cookie"
+)
+
+// Keys under which the token is exposed in the request store and to
+// templates, as the functions {{csrf_token}} and {{csrf_field}} (a hidden
+// input) and the view data {{.csrf_token}} and {{.csrf_field}}. The
+// functions also work in templates rendered with other data; the engine
+// must be loaded with helpers.AllTemplateFuncs, which defines them.
+const (
+	CSRFTokenKey = "csrf_token"
+	CSRFFieldKey = "csrf_field"
+)
+
+const csrfTokenLength = 32
+
+// CSRFConfig holds configuration for the CSRF middleware.
+type CSRFConfig struct {
+	// Mode is CSRFModeSession (default, requires session.Init) or CSRFModeCookie.
+	Mode string
+
+	// Secret signs the cookie in CSRFModeCookie (required there).
+	Secret string
+
+	// FieldName is the form field carrying the token (default: "_csrf").
+	FieldName string
+
+	// HeaderName is the request header carrying the token (default: "X-CSRF-Token").
+	HeaderName string
+
+	// SessionKey is the session key holding the token (default: "_csrf_token").
+	SessionKey string
+
+	// Cookie settings for CSRFModeCookie.
+	CookieName   string // default: "_csrf"
+	CookiePath   string // default: "/"
+	CookieDomain string
+	CookieSecure bool
+	CookieMaxAge int // default: 86400
+
+	// TrustedOrigins lists extra origins (scheme://host[:port]) allowed to
+	// submit requests, besides the request's own host.
+	TrustedOrigins []string
+
+	// Exempt lists route patterns that skip verification, e.g.
+	// "/api/*" or "/webhook/:provider". Patterns are matched against
+	// the request path and the matched route pattern.
+	Exempt []string
+}
+
+// CSRF returns a session-backed CSRF protection middleware.
+func CSRF() core.Middleware {
+	return CSRFWithConfig(CSRFConfig{})
+}
+
+// CSRFWithConfig returns a CSRF middleware with custom config.
+//
+// Safe methods (GET, HEAD, OPTIONS, TRACE) only receive a token. Other
+// methods must present it in the form field or header, and their Origin
+// (or Referer, if Origin is missing) must match the host or a trusted
+// origin. Failures return a 403 error for the ErrorHandler.
+func CSRFWithConfig(config CSRFConfig) core.Middleware {
+	if config.Mode == "" {
+		config.Mode = CSRFModeSession
+	}
+	if config.Mode == CSRFModeCookie && config.Secret == "" {
+		panic("middleware: CSRF cookie mode requires a Secret")
+	}
+	if config.FieldName == "" {
+		config.FieldName = "_csrf"
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = "X-CSRF-Token"
+	}
+	if config.SessionKey == "" {
+		config.SessionKey = "_csrf_token"
+	}
+	if config.CookieName == "" {
+		config.CookieName = "_csrf"
+	}
+	if config.CookiePath == "" {
+		config.CookiePath = "/"
+	}
+	if config.CookieMaxAge == 0 {
+		config.CookieMaxAge = 86400
+	}
+
+	trusted := make(map[string]bool, len(config.TrustedOrigins))
+	for _, o := range config.TrustedOrigins {
+		trusted[strings.ToLower(strings.TrimRight(o, "/"))] = true
+	}
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			if matchAnyRoute(config.Exempt, c) {
+				return next(c)
+			}
+
+			token := csrfLoadToken(c, &config)
+			if token == nil {
+				token = make([]byte, csrfTokenLength)
+				rand.Read(token)
+				if err := csrfSaveToken(c, &config, token); err != nil {
+					return err
+				}
+			}
+
+			masked := maskCSRFToken(token)
+			field := template.HTML(`<input type="hidden" name="` +
+				template.HTMLEscapeString(config.FieldName) + `" value="` + masked + `">`)
+			c.Set(CSRFTokenKey, masked)
+			c.SetViewData(CSRFTokenKey, masked)
+			c.SetViewData(CSRFFieldKey, field)
+			c.SetViewFunc(CSRFTokenKey, func() string { return masked })
+			c.SetViewFunc(CSRFFieldKey, func() template.HTML { return field })
+
+			switch c.Method() {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				return next(c)
+			}
+
+			if !csrfOriginAllowed(c, trusted) {
+				return core.NewHTTPError(http.StatusForbidden, "Forbidden - origin not allowed")
+			}
+
+			sent := c.Header(config.HeaderName)
+			if sent == "" {
+				sent = c.Form(config.FieldName)
+			}
+			if !csrfTokenValid(sent, token) {
+				return core.NewHTTPError(http.StatusForbidden, "Forbidden - invalid CSRF token")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// CSRFToken returns the masked CSRF token for the current request.
+func CSRFToken(c *core.Context) string {
+	return c.GetString(CSRFTokenKey)
+}
+
+func csrfLoadToken(c *core.Context, config *CSRFConfig) []byte {
+	var raw string
+	if config.Mode == CSRFModeCookie {
+		cookie, err := c.Cookie(config.CookieName)
+		if err != nil {
+			return nil
+		}
+		value, sig, ok := strings.Cut(cookie.Value, ".")
+		if !ok || !hmac.Equal([]byte(sig), []byte(csrfSign(config.Secret, value))) {
+			return nil
+		}
+		raw = value
+	} else {
+		raw = session.Get(c).GetString(config.SessionKey)
+	}
+
+	token, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil || len(token) != csrfTokenLength {
+		return nil
+	}
+	return token
+}
+
+func csrfSaveToken(c *core.Context, config *CSRFConfig, token []byte) error {
+	value := base64.RawURLEncoding.EncodeToString(token)
+	if config.Mode == CSRFModeCookie {
+		c.SetCookie(&http.Cookie{
+			Name:     config.CookieName,
+			Value:    value + "." + csrfSign(config.Secret, value),
+			Path:     config.CookiePath,
+			Domain:   config.CookieDomain,
+			MaxAge:   config.CookieMaxAge,
+			Secure:   config.CookieSecure,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return nil
+	}
+
+	s := session.Get(c)
+	s.Set(config.SessionKey, value)
+	return s.Save(c)
+}
+
+func csrfSign(secret, value string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte("csrf:" + value))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// maskCSRFToken XORs the token with a one-time pad so the value sent to
+// the page differs on every request (mitigates BREACH).
+func maskCSRFToken(token []byte) string {
+	out := make([]byte, 2*len(token))
+	pad := out[:len(token)]
+	rand.Read(pad)
+	for i, b := range token {
+		out[len(token)+i] = b ^ pad[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(out)
+}
+
+func csrfTokenValid(sent string, token []byte) bool {
+	if sent == "" {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(sent)
+	if err != nil || len(data) != 2*len(token) {
+		return false
+	}
+	pad, masked := data[:len(token)], data[len(token):]
+	unmasked := make([]byte, len(token))
+	for i := range unmasked {
+		unmasked[i] = masked[i] ^ pad[i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, token) == 1
+}
+
+// csrfOriginAllowed checks Origin, falling back to Referer. Requests
+// with neither are allowed, since the token check still applies.
+func csrfOriginAllowed(c *core.Context, trusted map[string]bool) bool {
+	source := c.Header("Origin")
+	if source == "" {
+		source = c.Header("Referer")
+		if source == "" {
+			return true
+		}
+	}
+	if source == "null" {
+		return false
+	}
+
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, c.Request.Host) {
+		return true
+	}
+	return trusted[strings.ToLower(u.Scheme+"://"+u.Host)]
+}
+
+// matchAnyRoute reports whether the request path or matched route
+// pattern matches any of patterns.
+func matchAnyRoute(patterns []string, c *core.Context) bool {
+	for _, p := range patterns {
+		if p == c.Route() || matchRoutePattern(p, c.Path()) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRoutePattern matches a path against a route-style pattern where
+// ":name" matches one segment and a trailing "*" (or "*name") matches
+// the rest of the path.
+func matchRoutePattern(pattern, path string) bool {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, p := range ps {
+		if strings.HasPrefix(p, "*") {
+			return true
+		}
+		if i >= len(segs) {
+			return false
+		}
+		if strings.HasPrefix(p, ":") {
+			continue
+		}
+		if p != segs[i] {
+			return false
+		}
+	}
+	return len(ps) == len(segs)
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/semutdev/goigniter/system/core"
+)
+
+// ETagConfig holds configuration for the ETag middleware.
+type ETagConfig struct {
+	// Weak generates weak validators (W/"...").
+	Weak bool
+
+	// MaxSize is the largest body that is buffered and hashed (default: 1MB).
+	// Larger or flushed responses are streamed without an ETag.
+	MaxSize int
+
+	// Skip bypasses the middleware for matching requests.
+	Skip func(c *core.Context) bool
+}
+
+// ETag returns a middleware that adds strong ETags to GET and HEAD
+// responses and answers If-None-Match/If-Modified-Since with 304.
+func ETag() core.Middleware {
+	return ETagWithConfig(ETagConfig{})
+}
+
+// ETagWithConfig returns an ETag middleware with custom config.
+//
+// Successful responses are buffered and hashed unless the handler set
+// its own ETag (see c.ETag and c.LastModified), which is then only
+// validated. The body is still produced on every request; handlers that
+// can tell freshness cheaply should use c.ETag to skip rendering.
+func ETagWithConfig(config ETagConfig) core.Middleware {
+	if config.MaxSize == 0 {
+		config.MaxSize = 1 << 20
+	}
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			method := c.Method()
+			if (method != http.MethodGet && method != http.MethodHead) ||
+				(config.Skip != nil && config.Skip(c)) {
+				return next(c)
+			}
+
+			ew := &etagWriter{ResponseWriter: c.Response, maxSize: config.MaxSize}
+			c.Response = ew
+			err := next(c)
+			c.Response = ew.ResponseWriter
+
+			if ew.passthrough || (err != nil && ew.code == 0) {
+				return err
+			}
+			if ew.code == 0 {
+				ew.code = http.StatusOK
+			}
+
+			h := c.Response.Header()
+			if ew.code == http.StatusOK {
+				if h.Get("ETag") == "" {
+					h.Set("ETag", hashETag(ew.buf, config.Weak))
+				}
+				if notModified(c, h) {
+					h.Del("Content-Type")
+					h.Del("Content-Length")
+					c.Response.WriteHeader(http.StatusNotModified)
+					return err
+				}
+			}
+
+			c.Response.WriteHeader(ew.code)
+			if method != http.MethodHead && len(ew.buf) > 0 {
+				if _, werr := c.Response.Write(ew.buf); werr != nil && err == nil {
+					err = werr
+				}
+			}
+			return err
+		}
+	}
+}
+
+// notModified evaluates the request's conditional headers against the
+// response validators.
+func notModified(c *core.Context, h http.Header) bool {
+	if inm := c.Header("If-None-Match"); inm != "" {
+		return core.ETagMatch(inm, h.Get("ETag"))
+	}
+	if lm := h.Get("Last-Modified"); lm != "" {
+		modtime, err := http.ParseTime(lm)
+		return err == nil && core.NotModifiedSince(c.Header("If-Modified-Since"), modtime)
+	}
+	return false
+}
+
+// hashETag derives a validator from the body's SHA-256.
+func hashETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	tag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// etagWriter buffers the response until it exceeds maxSize or is flushed.
+type etagWriter struct {
+	http.ResponseWriter
+	maxSize     int
+	buf         []byte
+	code        int
+	passthrough bool
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *etagWriter) Write(p []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if len(w.buf)+len(p) > w.maxSize {
+		if err := w.startPassthrough(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+// Flush gives up on buffering: streamed responses don't get an ETag.
+func (w *etagWriter) Flush() {
+	if !w.passthrough {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		if err := w.startPassthrough(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter.
+func (w *etagWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *etagWriter) startPassthrough() error {
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.code)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
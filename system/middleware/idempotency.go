@@ -0,0 +1,376 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/semutdev/goigniter/system/core"
+	"github.com/semutdev/goigniter/system/libraries/database"
+)
+
+// IdempotencyRecord is the stored state of one idempotency key.
+type IdempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Done        bool        `json:"done"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// IdempotencyStore persists idempotency keys.
+type IdempotencyStore interface {
+	// Begin reserves key for a request with fingerprint, for at most
+	// lockTTL. If the key is already known, its record is returned and
+	// nothing is reserved.
+	Begin(key, fingerprint string, lockTTL time.Duration) (*IdempotencyRecord, error)
+
+	// Complete stores the finished response for key for ttl.
+	Complete(key string, record *IdempotencyRecord, ttl time.Duration) error
+
+	// Release drops a reservation so the request can be retried.
+	Release(key string) error
+}
+
+// IdempotencyConfig holds configuration for the idempotency middleware.
+type IdempotencyConfig struct {
+	// Store keeps keys and responses (default: a process-local memory store).
+	Store IdempotencyStore
+
+	// Header carries the client's key (default: "Idempotency-Key").
+	Header string
+
+	// Scope namespaces keys, e.g. by user ID, so clients can't replay
+	// each other's responses. Default: no scope.
+	Scope func(c *core.Context) string
+
+	// TTL is how long responses are kept (default: 24h).
+	TTL time.Duration
+
+	// LockTTL bounds how long an unfinished request holds its key, in
+	// case the process dies mid-request (default: 1 minute).
+	LockTTL time.Duration
+
+	// MaxSize is the largest response that is stored (default: 1MB, at
+	// most 8MB, which a DBIdempotencyStore record holds on every
+	// database). Larger responses are not replayable and release their key.
+	MaxSize int
+
+	// MaxRequestSize is the largest request body read to fingerprint the
+	// request (default: 10MB). Larger requests with a key get 413.
+	MaxRequestSize int
+}
+
+// maxIdempotencySize caps IdempotencyConfig.MaxSize: base64 encoded in
+// JSON, 8MB still fits the 16MB MEDIUMTEXT column of MySQL.
+const maxIdempotencySize = 8 << 20
+
+// Idempotency returns a middleware that makes POST, PUT, PATCH and DELETE
+// requests carrying an Idempotency-Key header safe to retry.
+func Idempotency(store IdempotencyStore) core.Middleware {
+	return IdempotencyWithConfig(IdempotencyConfig{Store: store})
+}
+
+// IdempotencyWithConfig returns an Idempotency middleware with custom config.
+//
+// The first request with a key runs normally and its response is stored.
+// Retries with the same key and body get the stored response back with an
+// Idempotent-Replayed header. A retry while the first request is still
+// running gets 409, and reusing a key for a different request gets 422.
+// Errors and 5xx responses are not stored, so those requests can be retried.
+func IdempotencyWithConfig(config IdempotencyConfig) core.Middleware {
+	if config.Store == nil {
+		config.Store = NewIdempotencyMemoryStore()
+	}
+	if config.Header == "" {
+		config.Header = "Idempotency-Key"
+	}
+	if config.TTL == 0 {
+		config.TTL = 24 * time.Hour
+	}
+	if config.LockTTL == 0 {
+		config.LockTTL = time.Minute
+	}
+	if config.MaxSize == 0 {
+		config.MaxSize = 1 << 20
+	}
+	config.MaxSize = min(config.MaxSize, maxIdempotencySize)
+	if config.MaxRequestSize == 0 {
+		config.MaxRequestSize = 10 << 20
+	}
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			switch c.Method() {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				return next(c)
+			}
+
+			key := c.Header(config.Header)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > 255 {
+				return core.NewHTTPError(http.StatusBadRequest, "Idempotency key too long")
+			}
+			if config.Scope != nil {
+				key = config.Scope(c) + ":" + key
+			}
+
+			fingerprint, err := requestFingerprint(c, config.MaxRequestSize)
+			if err != nil {
+				return err
+			}
+
+			record, err := config.Store.Begin(key, fingerprint, config.LockTTL)
+			if err != nil {
+				return err
+			}
+			if record != nil {
+				switch {
+				case record.Fingerprint != fingerprint:
+					return core.NewHTTPError(http.StatusUnprocessableEntity,
+						"Idempotency key reused with a different request")
+				case !record.Done:
+					return core.NewHTTPError(http.StatusConflict,
+						"A request with this idempotency key is in progress")
+				}
+				h := c.Response.Header()
+				for k, v := range record.Header {
+					h[k] = v
+				}
+				h.Set("Idempotent-Replayed", "true")
+				return c.Blob(record.Status, h.Get("Content-Type"), record.Body)
+			}
+
+			pw := &pageCacheWriter{ResponseWriter: c.Response, maxSize: config.MaxSize}
+			c.Response = pw
+			err = next(c)
+			c.Response = pw.ResponseWriter
+
+			if err != nil || pw.code == 0 || pw.code >= 500 || pw.overflow {
+				// The response is already sent, so a failure only means
+				// retries get 409 until LockTTL passes.
+				if rerr := config.Store.Release(key); rerr != nil {
+					slog.Default().Error("idempotency: release key", "error", rerr)
+				}
+				return err
+			}
+
+			header := make(http.Header)
+			for _, h := range idempotencyHeaders {
+				if v := c.Response.Header().Values(h); len(v) > 0 {
+					header[http.CanonicalHeaderKey(h)] = v
+				}
+			}
+			if err := config.Store.Complete(key, &IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Done:        true,
+				Status:      pw.code,
+				Header:      header,
+				Body:        pw.buf.Bytes(),
+			}, config.TTL); err != nil {
+				// A reserved key without a response would answer retries
+				// with 409 until LockTTL and then run them again anyway.
+				slog.Default().Error("idempotency: store response", "error", err)
+				if rerr := config.Store.Release(key); rerr != nil {
+					slog.Default().Error("idempotency: release key", "error", rerr)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// idempotencyHeaders are the response headers replayed with a stored
+// response. Headers describing the request that created it, like cookies
+// or rate limit counters, are not.
+var idempotencyHeaders = []string{
+	"Content-Type",
+	"Content-Language",
+	"Location",
+	"ETag",
+	"Last-Modified",
+}
+
+// requestFingerprint hashes the method, path and body, restoring the
+// body for the handler. Bodies larger than maxSize are a 413 HTTPError.
+func requestFingerprint(c *core.Context, maxSize int) (string, error) {
+	h := sha256.New()
+	io.WriteString(h, c.Method()+" "+c.Request.URL.RequestURI()+"\n")
+
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		c.Request.Body = http.MaxBytesReader(c.Response, c.Request.Body, int64(maxSize))
+		body, err := c.Body()
+		if err != nil {
+			return "", err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewIdempotencyMemoryStore returns a process-local IdempotencyStore.
+// Expired keys are swept lazily; it starts no goroutines.
+func NewIdempotencyMemoryStore() IdempotencyStore {
+	return &memoryIdempotencyStore{entries: make(map[string]memoryIdempotencyEntry)}
+}
+
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryIdempotencyEntry
+	writes  int
+}
+
+type memoryIdempotencyEntry struct {
+	record   IdempotencyRecord
+	expireAt time.Time
+}
+
+func (s *memoryIdempotencyStore) Begin(key, fingerprint string, lockTTL time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := s.entries[key]; ok && now.Before(e.expireAt) {
+		record := e.record
+		return &record, nil
+	}
+	s.set(key, IdempotencyRecord{Fingerprint: fingerprint}, now.Add(lockTTL))
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.set(key, *record, time.Now().Add(ttl))
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *memoryIdempotencyStore) set(key string, record IdempotencyRecord, expireAt time.Time) {
+	s.entries[key] = memoryIdempotencyEntry{record: record, expireAt: expireAt}
+
+	s.writes++
+	if s.writes%1000 == 0 {
+		now := time.Now()
+		for k, e := range s.entries {
+			if !now.Before(e.expireAt) {
+				delete(s.entries, k)
+			}
+		}
+	}
+}
+
+// DBIdempotencyStore keeps idempotency keys in a database table, so
+// retries hitting another instance are still recognized. The key's
+// primary key constraint decides which concurrent request wins.
+type DBIdempotencyStore struct {
+	db    *database.DB
+	table string
+}
+
+// NewIdempotencyDBStore returns a store using table (default: "idempotency_keys").
+// Call CreateTable once, or create the table with a migration.
+func NewIdempotencyDBStore(db *database.DB, table string) *DBIdempotencyStore {
+	if table == "" {
+		table = "idempotency_keys"
+	}
+	return &DBIdempotencyStore{db: db, table: table}
+}
+
+// CreateTable creates the keys table if it doesn't exist.
+func (s *DBIdempotencyStore) CreateTable() error {
+	// Records carry whole responses; MySQL's TEXT holds only 64KB.
+	recordType := "TEXT"
+	switch s.db.Driver().Name() {
+	case "mysql":
+		recordType = "MEDIUMTEXT"
+	case "sqlserver":
+		recordType = "NVARCHAR(MAX)"
+	}
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS ` + s.table + ` (
+		idem_key VARCHAR(255) NOT NULL PRIMARY KEY,
+		record ` + recordType + ` NOT NULL,
+		expires_at BIGINT NOT NULL
+	)`)
+	return err
+}
+
+// Begin implements IdempotencyStore.
+func (s *DBIdempotencyStore) Begin(key, fingerprint string, lockTTL time.Duration) (*IdempotencyRecord, error) {
+	now := time.Now()
+	if err := s.db.Table(s.table).Where("idem_key", key).Where("expires_at", "<=", now.UnixNano()).Delete(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(IdempotencyRecord{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+	insertErr := s.db.Table(s.table).Insert(map[string]any{
+		"idem_key":   key,
+		"record":     string(data),
+		"expires_at": now.Add(lockTTL).UnixNano(),
+	})
+	if insertErr == nil {
+		return nil, nil
+	}
+
+	// The key exists: another request got there first.
+	var row struct {
+		Record string `db:"record"`
+	}
+	if err := s.db.Table(s.table).Select("record").Where("idem_key", key).First(&row); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, insertErr
+		}
+		return nil, err
+	}
+	var record IdempotencyRecord
+	if err := json.Unmarshal([]byte(row.Record), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Complete implements IdempotencyStore.
+func (s *DBIdempotencyStore) Complete(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Table(s.table).Where("idem_key", key).Update(map[string]any{
+		"record":     string(data),
+		"expires_at": time.Now().Add(ttl).UnixNano(),
+	})
+}
+
+// Release implements IdempotencyStore.
+func (s *DBIdempotencyStore) Release(key string) error {
+	return s.db.Table(s.table).Where("idem_key", key).Delete()
+}
+
+// Cleanup deletes expired keys. Run it periodically, e.g. from a
+// scheduled job; Begin only clears the expired key it is about to reuse.
+func (s *DBIdempotencyStore) Cleanup() error {
+	return s.db.Table(s.table).Where("expires_at", "<=", time.Now().UnixNano()).Delete()
+}
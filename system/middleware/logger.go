@@ -2,34 +2,61 @@ package middleware
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/semutdev/goigniter/system/core"
 )
 
-// Logger returns a middleware that logs HTTP requests.
+// Access log formats for LoggerConfig.Format.
+const (
+	// LogFormatText logs through slog as key=value pairs (default).
+	LogFormatText = "text"
+	// LogFormatJSON logs through slog as one JSON object per line.
+	LogFormatJSON = "json"
+	// LogFormatCommon writes NCSA Common Log Format lines.
+	LogFormatCommon = "common"
+	// LogFormatCombined writes NCSA Combined Log Format lines (Common + referer and user agent).
+	LogFormatCombined = "combined"
+)
+
+// Logger returns a middleware that logs HTTP requests through slog.Default().
 func Logger() core.Middleware {
-	return func(next core.HandlerFunc) core.HandlerFunc {
-		return func(c *core.Context) error {
-			start := time.Now()
-			err := next(c)
-			latency := time.Since(start)
-			log.Printf("[%s] %s %s %v",
-				c.Method(),
-				c.Path(),
-				latency,
-				err,
-			)
-			return err
-		}
-	}
+	return LoggerWithConfig(LoggerConfig{})
 }
 
 // LoggerConfig holds configuration for the logger middleware.
 type LoggerConfig struct {
-	Format    string
+	// Format is one of the LogFormat* constants. Any other non-empty value
+	// is treated as a legacy printf format receiving method, path and latency.
+	Format string
+
+	// Logger receives text/JSON records. Defaults to slog.Default() when
+	// Output is nil, otherwise to a handler writing to Output.
+	Logger *slog.Logger
+
+	// Output is where Common/Combined lines (and text/JSON records when
+	// Logger is nil) are written. Defaults to os.Stdout for CLF formats.
+	Output io.Writer
+
+	// SkipPaths lists exact paths that are never logged.
 	SkipPaths []string
+
+	// Skip is evaluated after the handler; returning true drops the entry.
+	// The response status is already available through c.Status().
+	Skip func(c *core.Context) bool
+
+	// SampleRate logs only this fraction (0 < rate < 1) of successful
+	// requests. Errors and responses with status >= 400 are always logged.
+	SampleRate float64
 }
 
 // LoggerWithConfig returns a Logger middleware with custom config.
@@ -39,31 +66,147 @@ func LoggerWithConfig(config LoggerConfig) core.Middleware {
 		skipMap[path] = true
 	}
 
+	write := newAccessLogWriter(config)
+
 	return func(next core.HandlerFunc) core.HandlerFunc {
 		return func(c *core.Context) error {
 			if skipMap[c.Path()] {
 				return next(c)
 			}
 
+			c.CaptureResponse()
+
 			start := time.Now()
 			err := next(c)
 			latency := time.Since(start)
 
-			if config.Format != "" {
-				log.Printf(config.Format, c.Method(), c.Path(), latency)
-			} else {
-				log.Printf("[%s] %s %s",
-					c.Method(),
-					c.Path(),
-					latency,
-				)
+			if config.Skip != nil && config.Skip(c) {
+				return err
+			}
+
+			status := c.ResultStatus(err)
+			if config.SampleRate > 0 && config.SampleRate < 1 && err == nil && status < 400 &&
+				rand.Float64() >= config.SampleRate {
+				return err
 			}
 
+			write(c, start, latency, status, err)
 			return err
 		}
 	}
 }
 
+// SkipPathPrefix returns a LoggerConfig.Skip predicate that drops requests
+// whose path starts with any of the given prefixes.
+func SkipPathPrefix(prefixes ...string) func(c *core.Context) bool {
+	return func(c *core.Context) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(c.Path(), p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type accessLogFunc func(c *core.Context, start time.Time, latency time.Duration, status int, err error)
+
+func newAccessLogWriter(config LoggerConfig) accessLogFunc {
+	switch config.Format {
+	case LogFormatCommon, LogFormatCombined:
+		out := config.Output
+		if out == nil {
+			out = os.Stdout
+		}
+		combined := config.Format == LogFormatCombined
+		var mu sync.Mutex
+		return func(c *core.Context, start time.Time, _ time.Duration, status int, _ error) {
+			line := formatCLF(c, start, status, combined)
+			mu.Lock()
+			io.WriteString(out, line)
+			mu.Unlock()
+		}
+
+	case "", LogFormatText, LogFormatJSON:
+		logger := config.Logger
+		if logger == nil {
+			switch {
+			case config.Output == nil:
+				logger = slog.Default()
+			case config.Format == LogFormatJSON:
+				logger = slog.New(slog.NewJSONHandler(config.Output, nil))
+			default:
+				logger = slog.New(slog.NewTextHandler(config.Output, nil))
+			}
+		}
+		return func(c *core.Context, _ time.Time, latency time.Duration, status int, err error) {
+			level := slog.LevelInfo
+			switch {
+			case status >= 500 || err != nil:
+				level = slog.LevelError
+			case status >= 400:
+				level = slog.LevelWarn
+			}
+			attrs := []slog.Attr{
+				slog.String("method", c.Method()),
+				slog.String("path", c.Path()),
+				slog.String("route", c.Route()),
+				slog.Int("status", status),
+				slog.Int64("bytes", c.Size()),
+				slog.Duration("latency", latency),
+				slog.String("ip", c.IP()),
+				slog.String("user_agent", c.Header("User-Agent")),
+			}
+			if id := c.RequestID(); id != "" {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+			logger.LogAttrs(c.Context(), level, "request", attrs...)
+		}
+
+	default:
+		// Legacy printf format: method, path, latency.
+		return func(c *core.Context, _ time.Time, latency time.Duration, _ int, _ error) {
+			log.Printf(config.Format, c.Method(), c.Path(), latency)
+		}
+	}
+}
+
+// formatCLF renders an NCSA Common (or Combined) Log Format line.
+func formatCLF(c *core.Context, start time.Time, status int, combined bool) string {
+	host := c.IP()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	user := "-"
+	if u, _, ok := c.Request.BasicAuth(); ok && u != "" {
+		user = u
+	}
+
+	size := "-"
+	if n := c.Size(); n > 0 {
+		size = strconv.FormatInt(n, 10)
+	}
+
+	line := fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		host,
+		user,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		c.Method(),
+		c.Request.RequestURI,
+		c.Request.Proto,
+		status,
+		size,
+	)
+	if combined {
+		line += fmt.Sprintf(` %q %q`, c.Header("Referer"), c.Header("User-Agent"))
+	}
+	return line + "\n"
+}
+
 // ColorLogger returns a middleware that logs with colors.
 func ColorLogger() core.Middleware {
 	return func(next core.HandlerFunc) core.HandlerFunc {
@@ -75,12 +218,13 @@ func ColorLogger() core.Middleware {
 			methodColor := methodToColor(c.Method())
 			resetColor := "\033[0m"
 
-			fmt.Printf("%s[%s]%s %s %v\n",
+			fmt.Printf("%s[%s]%s %s %v%s\n",
 				methodColor,
 				c.Method(),
 				resetColor,
 				c.Path(),
 				latency,
+				requestIDSuffix(c),
 			)
 
 			return err
@@ -88,6 +232,14 @@ func ColorLogger() core.Middleware {
 	}
 }
 
+// requestIDSuffix returns " id=<request id>" when the request has an ID.
+func requestIDSuffix(c *core.Context) string {
+	if id := c.RequestID(); id != "" {
+		return " id=" + id
+	}
+	return ""
+}
+
 func methodToColor(method string) string {
 	switch method {
 	case "GET":
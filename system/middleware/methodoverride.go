@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/semutdev/goigniter/system/core"
+)
+
+// MethodOverrideConfig holds configuration for the method override middleware.
+type MethodOverrideConfig struct {
+	// FieldName is the form field holding the method (default: "_method").
+	FieldName string
+
+	// HeaderName is the header holding the method (default: "X-HTTP-Method-Override").
+	HeaderName string
+
+	// Methods lists the methods a POST may be turned into
+	// (default: PUT, PATCH, DELETE).
+	Methods []string
+
+	// MaxFormSize is the largest urlencoded body read for the form field
+	// (default: 1MB). Larger bodies, and bodies of unknown length, are
+	// left unread and keep POST.
+	MaxFormSize int
+}
+
+// MethodOverride returns a middleware that lets HTML forms reach PUT,
+// PATCH and DELETE routes. Register it with app.Pre so it runs before
+// routing:
+//
+//	app.Pre(middleware.MethodOverride())
+//
+//	<form method="POST" action="/users/5">
+//		<input type="hidden" name="_method" value="DELETE">
+//	</form>
+//
+// Multipart forms, e.g. with file uploads, must put the field in the
+// action URL instead: action="/users/5?_method=PUT".
+func MethodOverride() core.Middleware {
+	return MethodOverrideWithConfig(MethodOverrideConfig{})
+}
+
+// MethodOverrideWithConfig returns a MethodOverride middleware with custom config.
+//
+// Only POST requests are rewritten. The header is checked first, then the
+// field in the URL query, then the field in urlencoded bodies. Multipart
+// bodies are never parsed: that runs before routing, so it would spool
+// uploads to disk before BodyLimit or the upload library limit them.
+func MethodOverrideWithConfig(config MethodOverrideConfig) core.Middleware {
+	if config.FieldName == "" {
+		config.FieldName = "_method"
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = "X-HTTP-Method-Override"
+	}
+	if len(config.Methods) == 0 {
+		config.Methods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	if config.MaxFormSize == 0 {
+		config.MaxFormSize = 1 << 20
+	}
+
+	allowed := make(map[string]bool, len(config.Methods))
+	for _, m := range config.Methods {
+		allowed[strings.ToUpper(m)] = true
+	}
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			if c.Method() != http.MethodPost {
+				return next(c)
+			}
+
+			method := c.Header(config.HeaderName)
+			if method == "" {
+				method = c.Query(config.FieldName)
+			}
+			if method == "" && isURLEncodedForm(c, config.MaxFormSize) {
+				req := c.Request
+				req.Body = http.MaxBytesReader(c.Response, req.Body, int64(config.MaxFormSize))
+				if req.ParseForm() == nil {
+					method = req.PostForm.Get(config.FieldName)
+				}
+			}
+			if method = strings.ToUpper(strings.TrimSpace(method)); allowed[method] {
+				c.Request.Method = method
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// isURLEncodedForm reports whether c has an urlencoded body of known
+// length no larger than max.
+func isURLEncodedForm(c *core.Context, max int) bool {
+	n := c.Request.ContentLength
+	return n > 0 && n <= int64(max) &&
+		strings.HasPrefix(c.Header("Content-Type"), "application/x-www-form-urlencoded")
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/semutdev/goigniter/system/core"
+	"github.com/semutdev/goigniter/system/libraries/metrics"
+)
+
+// MetricsConfig holds configuration for the metrics middleware.
+type MetricsConfig struct {
+	// Registry receives the metrics (default: metrics.Default).
+	Registry *metrics.Registry
+
+	// Buckets are the latency histogram buckets in seconds
+	// (default: metrics.DefBuckets).
+	Buckets []float64
+
+	// Skip bypasses the middleware, e.g. for the metrics route itself.
+	Skip func(c *core.Context) bool
+}
+
+// Metrics returns a middleware recording request metrics in metrics.Default.
+func Metrics() core.Middleware {
+	return MetricsWithConfig(MetricsConfig{})
+}
+
+// MetricsWithConfig returns a Metrics middleware with custom config.
+//
+// It records http_requests_total, http_request_duration_seconds and
+// http_requests_in_flight, labelled by method and route pattern (not the
+// raw path, so "/users/:id" is one series). Serve them with MetricsHandler:
+//
+//	app.Use(middleware.Metrics())
+//	app.GET("/metrics", middleware.MetricsHandler(nil))
+func MetricsWithConfig(config MetricsConfig) core.Middleware {
+	reg := config.Registry
+	if reg == nil {
+		reg = metrics.Default
+	}
+
+	requests := reg.Counter("http_requests_total",
+		"Total number of HTTP requests.", "method", "route", "status")
+	duration := reg.Histogram("http_request_duration_seconds",
+		"HTTP request latency in seconds.", config.Buckets, "method", "route")
+	inFlight := reg.Gauge("http_requests_in_flight",
+		"Number of HTTP requests being served.", "method", "route")
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			if config.Skip != nil && config.Skip(c) {
+				return next(c)
+			}
+
+			method, route := c.Method(), c.Route()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			inFlight.Inc(method, route)
+			// Deferred, so panics recovered further out don't leak it.
+			defer inFlight.Dec(method, route)
+			start := time.Now()
+			err := next(c)
+			elapsed := time.Since(start)
+
+			status := c.ResultStatus(err)
+
+			requests.Inc(method, route, strconv.Itoa(status))
+			duration.Observe(elapsed.Seconds(), method, route)
+			return err
+		}
+	}
+}
+
+// MetricsHandler returns a handler serving reg (default: metrics.Default)
+// in the Prometheus text format. Register it at any route.
+func MetricsHandler(reg *metrics.Registry) core.HandlerFunc {
+	if reg == nil {
+		reg = metrics.Default
+	}
+	h := reg.Handler()
+	return func(c *core.Context) error {
+		h.ServeHTTP(c.Response, c.Request)
+		return nil
+	}
+}
@@ -1,12 +1,33 @@
 package middleware
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/semutdev/goigniter/system/core"
+	"github.com/semutdev/goigniter/system/helpers"
+	"github.com/semutdev/goigniter/system/libraries/cache"
+	"github.com/semutdev/goigniter/system/libraries/database"
+	"github.com/semutdev/goigniter/system/libraries/metrics"
+	"github.com/semutdev/goigniter/system/libraries/tracing"
 )
 
 func TestLogger(t *testing.T) {
@@ -127,6 +148,119 @@ func TestCORSWithConfig(t *testing.T) {
 	}
 }
 
+func TestCORS_Origins(t *testing.T) {
+	wrapped := CORSWithConfig(CORSConfig{
+		AllowOrigins:        []string{"https://*.example.com"},
+		AllowOriginPatterns: []string{`^https://pr-\d+\.preview\.dev$`},
+		AllowOriginFunc:     func(origin string) bool { return origin == "https://partner.test" },
+		AllowCredentials:    true,
+	})(func(c *core.Context) error {
+		return c.String(200, "OK")
+	})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", false},
+		{"https://evil.com/.example.com", false},
+		{"http://app.example.com", false},
+		{"https://pr-42.preview.dev", true},
+		{"https://pr-x.preview.dev", false},
+		{"https://partner.test", true},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Origin", tt.origin)
+		wrapped(createTestContext(rec, req))
+
+		got := rec.Header().Get("Access-Control-Allow-Origin")
+		if tt.want && got != tt.origin || !tt.want && got != "" {
+			t.Errorf("%s: got Access-Control-Allow-Origin %q", tt.origin, got)
+		}
+		if rec.Header().Get("Vary") != "Origin" {
+			t.Errorf("%s: expected Vary: Origin, got %q", tt.origin, rec.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestCORS_CredentialsReflectOrigin(t *testing.T) {
+	wrapped := CORSWithConfig(CORSConfig{
+		AllowOrigins:     []string{"https://*.test"},
+		AllowCredentials: true,
+	})(func(c *core.Context) error {
+		return c.String(200, "OK")
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://app.test")
+	wrapped(createTestContext(rec, req))
+
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://app.test" ||
+		rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected reflected origin with credentials, got %v", rec.Header())
+	}
+}
+
+func TestCORS_CredentialsAllowAllPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error(`Expected a panic for "*" with AllowCredentials`)
+		}
+	}()
+	CORSWithConfig(CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true})
+}
+
+func TestCORS_GroupPreflight(t *testing.T) {
+	app := core.New()
+	api := app.Group("/api", CORSWithConfig(CORSConfig{
+		AllowOrigins:        []string{"https://app.test"},
+		AllowMethods:        []string{"GET", "PUT"},
+		AllowPrivateNetwork: true,
+		MaxAge:              600,
+	}))
+	api.PUT("/items/:id", func(c *core.Context) error {
+		return c.NoContent(204)
+	})
+	app.PUT("/other", func(c *core.Context) error {
+		return c.NoContent(204)
+	})
+
+	preflight := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", path, nil)
+		req.Header.Set("Origin", "https://app.test")
+		req.Header.Set("Access-Control-Request-Method", "PUT")
+		req.Header.Set("Access-Control-Request-Headers", "content-type, x-token")
+		req.Header.Set("Access-Control-Request-Private-Network", "true")
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preflight("/api/items/1")
+	h := rec.Header()
+	if rec.Code != 204 || h.Get("Access-Control-Allow-Origin") != "https://app.test" ||
+		h.Get("Access-Control-Allow-Methods") != "GET, PUT" || h.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Unexpected preflight response %d %v", rec.Code, h)
+	}
+	if h.Get("Access-Control-Allow-Headers") != "content-type, x-token" {
+		t.Errorf("Expected reflected request headers, got %q", h.Get("Access-Control-Allow-Headers"))
+	}
+	if h.Get("Access-Control-Allow-Private-Network") != "true" {
+		t.Error("Expected private network access to be allowed")
+	}
+
+	// Routes outside the group don't answer preflights
+	rec = preflight("/other")
+	if rec.Code != 404 || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected 404 without CORS headers outside group, got %d %v", rec.Code, rec.Header())
+	}
+}
+
 func TestRateLimit(t *testing.T) {
 	handler := func(c *core.Context) error {
 		return c.String(200, "OK")
@@ -163,6 +297,598 @@ func TestRateLimit(t *testing.T) {
 	}
 }
 
+func TestRateLimit_Headers(t *testing.T) {
+	app := core.New()
+	app.Use(RateLimitWithConfig(RateLimitConfig{
+		Max:    2,
+		Window: time.Minute,
+		Routes: map[string]RateLimitPolicy{
+			"/login": {Max: 1, Window: time.Minute},
+		},
+	}))
+	app.GET("/", func(c *core.Context) error { return c.String(200, "OK") })
+	app.GET("/login", func(c *core.Context) error { return c.String(200, "OK") })
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	rec := get("/")
+	if rec.Header().Get("RateLimit-Limit") != "2" || rec.Header().Get("RateLimit-Remaining") != "1" ||
+		rec.Header().Get("RateLimit-Reset") != "60" {
+		t.Errorf("Unexpected headers %v", rec.Header())
+	}
+
+	// The route policy has its own budget
+	if rec := get("/login"); rec.Code != 200 || rec.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("Expected route policy, got %d %v", rec.Code, rec.Header())
+	}
+	rec = get("/login")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected 429 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+	if rec := get("/"); rec.Code != 200 {
+		t.Errorf("Default policy should still allow, got %d", rec.Code)
+	}
+}
+
+func TestRateLimitAlgorithms(t *testing.T) {
+	start := time.Unix(1000, 0)
+	window := 10 * time.Second
+
+	t.Run("sliding window", func(t *testing.T) {
+		var s rateLimitState
+		slidingWindow(&s, start, 2, window)
+		slidingWindow(&s, start.Add(5*time.Second), 2, window)
+		r := slidingWindow(&s, start.Add(6*time.Second), 2, window)
+		if r.Allowed || r.RetryAfter != 4*time.Second {
+			t.Errorf("Expected denial until first hit expires, got %+v", r)
+		}
+		// A fixed window would have reset at 10s; the log still holds the 5s hit
+		r = slidingWindow(&s, start.Add(11*time.Second), 2, window)
+		if !r.Allowed || r.Remaining != 0 {
+			t.Errorf("Expected one slot freed, got %+v", r)
+		}
+	})
+
+	t.Run("token bucket", func(t *testing.T) {
+		var s rateLimitState
+		for i := 0; i < 5; i++ {
+			if r := tokenBucket(&s, start, 5, window); !r.Allowed {
+				t.Fatalf("Burst request %d denied", i+1)
+			}
+		}
+		r := tokenBucket(&s, start, 5, window)
+		if r.Allowed || r.RetryAfter != 2*time.Second {
+			t.Errorf("Expected denial for one refill period, got %+v", r)
+		}
+		if r := tokenBucket(&s, start.Add(2*time.Second), 5, window); !r.Allowed || r.Remaining != 0 {
+			t.Errorf("Expected one refilled token, got %+v", r)
+		}
+	})
+
+	t.Run("fixed window", func(t *testing.T) {
+		var s rateLimitState
+		fixedWindow(&s, start, 1, window)
+		if r := fixedWindow(&s, start.Add(9*time.Second), 1, window); r.Allowed {
+			t.Errorf("Expected denial within window, got %+v", r)
+		}
+		if r := fixedWindow(&s, start.Add(10*time.Second), 1, window); !r.Allowed {
+			t.Errorf("Expected new window, got %+v", r)
+		}
+	})
+}
+
+func TestRateLimitDBStore(t *testing.T) {
+	db, err := database.Open("sqlite", filepath.Join(t.TempDir(), "rate.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewRateLimitDBStore(db, "")
+	if err := store.CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two limiters sharing a store behave like two instances
+	newLimiter := func() core.HandlerFunc {
+		return RateLimitWithConfig(RateLimitConfig{
+			Max:       3,
+			Window:    time.Minute,
+			Algorithm: RateLimitSlidingWindow,
+			Store:     store,
+		})(func(c *core.Context) error { return c.String(200, "OK") })
+	}
+	a, b := newLimiter(), newLimiter()
+
+	codes := make([]int, 0, 4)
+	for i, h := range []core.HandlerFunc{a, b, a, b} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		if err := h(createTestContext(rec, req)); err != nil {
+			t.Fatalf("Request %d: %v", i+1, err)
+		}
+		codes = append(codes, rec.Code)
+	}
+	if codes[2] != 200 || codes[3] != http.StatusTooManyRequests {
+		t.Errorf("Expected shared limit of 3, got %v", codes)
+	}
+
+	// Concurrent updates of a new key neither collide nor get lost
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.Update("counter", time.Minute, func(state []byte) []byte {
+				n, _ := strconv.Atoi(string(state))
+				return []byte(strconv.Itoa(n + 1))
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	var final []byte
+	store.Update("counter", time.Minute, func(state []byte) []byte {
+		final = state
+		return state
+	})
+	if string(final) != "20" {
+		t.Errorf("Expected 20 counted updates, got %q", final)
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	created := 0
+	started, release := make(chan struct{}), make(chan struct{})
+	app := core.New()
+	app.Use(Idempotency(nil))
+	app.POST("/orders", func(c *core.Context) error {
+		if c.Query("slow") != "" {
+			close(started)
+			<-release
+		}
+		created++
+		c.SetHeader("Location", "/orders/1")
+		c.SetHeader("RateLimit-Remaining", "9")
+		return c.JSON(201, core.Map{"id": created})
+	})
+	app.POST("/fail", func(c *core.Context) error {
+		created++
+		return core.NewHTTPError(500)
+	})
+
+	post := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := post("/orders", "k1", `{"item":1}`)
+	retry := post("/orders", "k1", `{"item":1}`)
+	if first.Code != 201 || retry.Code != 201 || retry.Body.String() != first.Body.String() {
+		t.Errorf("Expected replayed response, got %d %q then %d %q",
+			first.Code, first.Body.String(), retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || created != 1 {
+		t.Errorf("Expected handler to run once, ran %d times", created)
+	}
+	if retry.Header().Get("Location") != "/orders/1" || retry.Header().Get("RateLimit-Remaining") != "" {
+		t.Errorf("Expected only response headers to be replayed, got %v", retry.Header())
+	}
+
+	if rec := post("/orders", "k1", `{"item":2}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a different body, got %d", rec.Code)
+	}
+
+	// Server errors are not stored
+	post("/fail", "k2", "")
+	post("/fail", "k2", "")
+	if created != 3 {
+		t.Errorf("Expected failed request to run again, created=%d", created)
+	}
+
+	// Concurrent duplicate while the first is still running
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post("/orders?slow=1", "k3", "") }()
+	<-started
+	dup := post("/orders?slow=1", "k3", "")
+	close(release)
+	if rec := <-done; rec.Code != 201 {
+		t.Errorf("Expected first request to succeed, got %d", rec.Code)
+	}
+	if dup.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for concurrent duplicate, got %d", dup.Code)
+	}
+
+	// Request bodies are read up to MaxRequestSize
+	app = core.New()
+	app.Use(IdempotencyWithConfig(IdempotencyConfig{MaxRequestSize: 8}))
+	app.POST("/orders", func(c *core.Context) error {
+		return c.String(201, "created")
+	})
+	if rec := post("/orders", "k4", `{"item":1}`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large request, got %d", rec.Code)
+	}
+
+	// A response the store can't keep releases its key
+	store := &failingCompleteStore{IdempotencyStore: NewIdempotencyMemoryStore()}
+	app = core.New()
+	app.Use(Idempotency(store))
+	app.POST("/orders", func(c *core.Context) error {
+		return c.String(201, "created")
+	})
+	post("/orders", "k5", "")
+	if rec := post("/orders", "k5", ""); rec.Code != 201 || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected the key to be released, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+type failingCompleteStore struct {
+	IdempotencyStore
+}
+
+func (s *failingCompleteStore) Complete(string, *IdempotencyRecord, time.Duration) error {
+	return errors.New("record too large")
+}
+
+func TestIdempotencyDBStore(t *testing.T) {
+	db, err := database.Open("sqlite", filepath.Join(t.TempDir(), "idem.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewIdempotencyDBStore(db, "")
+	if err := store.CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec, err := store.Begin("k", "fp", time.Minute); rec != nil || err != nil {
+		t.Fatalf("Expected reservation, got %v %v", rec, err)
+	}
+	if rec, err := store.Begin("k", "fp", time.Minute); err != nil || rec == nil || rec.Done {
+		t.Fatalf("Expected in-flight record, got %+v %v", rec, err)
+	}
+
+	store.Complete("k", &IdempotencyRecord{Fingerprint: "fp", Done: true, Status: 201, Body: []byte("ok")}, time.Hour)
+	rec, err := store.Begin("k", "fp", time.Minute)
+	if err != nil || rec == nil || !rec.Done || rec.Status != 201 || string(rec.Body) != "ok" {
+		t.Fatalf("Expected stored response, got %+v %v", rec, err)
+	}
+
+	store.Release("k")
+	if rec, err := store.Begin("k", "fp", time.Minute); rec != nil || err != nil {
+		t.Errorf("Expected released key to be reusable, got %v %v", rec, err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	app := core.New()
+	app.Use(Recovery())
+	app.Use(MetricsWithConfig(MetricsConfig{Registry: reg}))
+	app.GET("/users/:id", func(c *core.Context) error {
+		return c.String(200, "user")
+	})
+	app.GET("/panic", func(c *core.Context) error {
+		panic("boom")
+	})
+	app.GET("/missing/:id", func(c *core.Context) error {
+		return core.NewHTTPError(404)
+	})
+	app.GET("/metrics", MetricsHandler(reg))
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing/3", "/panic"} {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/users/:id",status="200"} 2`,
+		`http_requests_total{method="GET",route="/missing/:id",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/users/:id"} 2`,
+		`http_requests_in_flight{method="GET",route="/metrics"} 1`,
+		`http_requests_in_flight{method="GET",route="/panic"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in:\n%s", want, body)
+		}
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected Content-Type %q", rec.Header().Get("Content-Type"))
+	}
+}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) Export(_ context.Context, spans []tracing.SpanData) error {
+	r.mu.Lock()
+	r.spans = append(r.spans, spans...)
+	r.mu.Unlock()
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	recorder := &spanRecorder{}
+	tracer := tracing.NewTracer(tracing.Config{ServiceName: "test", Exporter: recorder})
+
+	db, err := database.Open("sqlite", filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "user.html"), []byte("<p>{{.count}}</p>"), 0644)
+	renderer, err := core.NewTemplateEngine(core.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With a default tracer, queries outside the request's trace must
+	// not start traces of their own.
+	tracing.SetTracer(tracer)
+	defer tracing.SetTracer(nil)
+
+	app := core.New()
+	app.SetRenderer(renderer)
+	app.Use(TracingWithConfig(TracingConfig{Tracer: tracer}))
+	app.GET("/users/:id", func(c *core.Context) error {
+		count, err := db.For(c).Table("users").Count()
+		if err != nil {
+			return err
+		}
+		db.Table("users").Count()
+		var user struct {
+			Name string `db:"name"`
+		}
+		if err := db.For(c).Table("users").Where("id", c.Param("id")).First(&user); !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("expected no rows, got %v", err)
+		}
+		return c.View("user", core.Map{"count": count})
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/users/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=1")
+	app.ServeHTTP(rec, req)
+
+	if rec.Code != 200 {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	sc, ok := tracing.ParseTraceparent(rec.Header().Get("traceparent"))
+	if !ok || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !sc.Sampled {
+		t.Errorf("Unexpected response traceparent %q", rec.Header().Get("traceparent"))
+	}
+	if rec.Header().Get("tracestate") != "vendor=1" {
+		t.Errorf("Expected tracestate to propagate, got %q", rec.Header().Get("tracestate"))
+	}
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	byName := make(map[string]tracing.SpanData)
+	for _, s := range recorder.spans {
+		byName[s.Name] = s
+	}
+	if len(recorder.spans) != 4 {
+		t.Errorf("Expected server, two query and render spans, got %+v", recorder.spans)
+	}
+	for _, s := range recorder.spans {
+		if s.Name == "SELECT users" && s.Status == tracing.StatusError {
+			t.Errorf("Expected no rows not to fail the span, got %+v", s)
+		}
+	}
+	server, ok := byName["GET /users/:id"]
+	if !ok {
+		t.Fatalf("Expected server span named after the route, got %+v", recorder.spans)
+	}
+	if server.Kind != tracing.SpanKindServer || server.ParentSpanID.String() != "00f067aa0ba902b7" ||
+		server.SpanID != sc.SpanID || server.Attributes["http.route"] != "/users/:id" ||
+		server.Attributes["http.response.status_code"] != 200 {
+		t.Errorf("Unexpected server span %+v", server)
+	}
+	for _, name := range []string{"SELECT users", "render user"} {
+		child, ok := byName[name]
+		if !ok {
+			t.Errorf("Expected child span %q, got %+v", name, recorder.spans)
+			continue
+		}
+		if child.TraceID != server.TraceID || child.ParentSpanID != server.SpanID {
+			t.Errorf("Span %q is not a child of the server span", name)
+		}
+	}
+	if byName["SELECT users"].Attributes["db.system"] != "sqlite" {
+		t.Errorf("Unexpected db span attributes %v", byName["SELECT users"].Attributes)
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	db, err := database.Open("sqlite", filepath.Join(t.TempDir(), "profiler.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "page.html"), []byte("<html><body><p>{{.count}}</p></body></html>"), 0644)
+	renderer, err := core.NewTemplateEngine(core.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := core.New()
+	app.SetEnv(core.EnvDevelopment)
+	app.SetRenderer(renderer)
+	app.Use(Profiler())
+	api := app.Group("/api", RequestID())
+	api.GET("/users/:id", func(c *core.Context) error {
+		// No request context: attributed to the only profiled request.
+		if err := db.Table("users").Where("name", "ann").Insert(map[string]any{"name": "ann"}); err != nil {
+			return err
+		}
+		count, err := db.WithContext(c.Context()).Table("users").Where("name", "ann").Count()
+		if err != nil {
+			return err
+		}
+		return c.View("page", core.Map{"count": count})
+	})
+	app.GET("/fragment", func(c *core.Context) error {
+		return c.HTML(200, "<tr><td>row</td></tr>")
+	})
+	var started, queried sync.WaitGroup
+	started.Add(2)
+	queried.Add(2)
+	app.GET("/concurrent", func(c *core.Context) error {
+		started.Done()
+		started.Wait()
+		// Two requests in flight: the query belongs to neither.
+		_, err := db.Table("users").Count()
+		queried.Done()
+		queried.Wait()
+		if err != nil {
+			return err
+		}
+		return c.HTML(200, "<html><body></body></html>")
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/users/7", nil)
+	req.Header.Set("Cookie", "session=secret")
+	app.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, "<html><body><p>1</p>") || !strings.HasSuffix(body, "</body></html>") {
+		t.Fatalf("Expected toolbar inside the page, got %s", body)
+	}
+	for _, want := range []string{
+		`id="gi-profiler"`,
+		"2 queries",
+		"INSERT INTO &#34;users&#34;",
+		"SELECT COUNT(*) as count FROM &#34;users&#34; WHERE &#34;name&#34; = ?",
+		"args: &#34;ann&#34;",
+		"1 templates",
+		"/api/users/:id",
+		"<td>7</td>",
+		"middleware.ProfilerWithConfig",
+		"middleware.RequestIDWithConfig",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in toolbar", want)
+		}
+	}
+	if strings.Contains(body, "secret") || !strings.Contains(body, "[redacted]") {
+		t.Errorf("Expected the Cookie header redacted, got %s", body)
+	}
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 2)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest("GET", "/concurrent", nil))
+			bodies[i] = rec.Body.String()
+		}()
+	}
+	wg.Wait()
+	for _, body := range bodies {
+		if !strings.Contains(body, "0 queries") || !strings.Contains(body, "2 queries not attributed") {
+			t.Errorf("Expected both queries counted as not attributed, got %s", body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/fragment", nil))
+	if rec.Body.String() != "<tr><td>row</td></tr>" {
+		t.Errorf("Expected fragment untouched, got %q", rec.Body.String())
+	}
+
+	app.SetEnv(core.EnvProduction)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/api/users/7", nil))
+	if strings.Contains(rec.Body.String(), "gi-profiler") {
+		t.Error("Expected no toolbar in production")
+	}
+}
+
+func TestQueryCounter(t *testing.T) {
+	db, err := database.Open("sqlite", filepath.Join(t.TempDir(), "counter.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE posts (id INTEGER PRIMARY KEY, author_id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	db.AddHook(database.NewQueryCounterHook())
+
+	var buf bytes.Buffer
+	app := core.New()
+	app.Use(RequestID(), QueryCounterWithConfig(QueryCounterConfig{
+		MaxRepeats: 2,
+		MaxQueries: 3,
+		Logger:     slog.New(slog.NewTextHandler(&buf, nil)),
+	}))
+	app.GET("/posts", func(c *core.Context) error {
+		tx := db.WithContext(c.Context())
+		for i := 0; i < 3; i++ {
+			if _, err := tx.Table("posts").Where("author_id", i).Count(); err != nil {
+				return err
+			}
+		}
+		stats := database.QueryStatsFromContext(c.Context())
+		return c.String(200, strconv.Itoa(stats.Count()))
+	})
+	app.GET("/post", func(c *core.Context) error {
+		_, err := db.WithContext(c.Context()).Table("posts").Count()
+		return err
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/posts", nil))
+	if rec.Body.String() != "3" {
+		t.Errorf("Expected 3 counted queries, got %q", rec.Body.String())
+	}
+	out := buf.String()
+	if !strings.Contains(out, `msg="possible N+1 query" sql="SELECT COUNT(*) as count FROM \"posts\" WHERE \"author_id\" = ?" count=3`) ||
+		!strings.Contains(out, "route=/posts request_id=") {
+		t.Errorf("Expected N+1 warning, got %s", out)
+	}
+	if strings.Contains(out, "too many queries") {
+		t.Errorf("Expected no total warning at the limit, got %s", out)
+	}
+
+	buf.Reset()
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/post", nil))
+	if buf.Len() != 0 {
+		t.Errorf("Expected no warnings, got %s", buf.String())
+	}
+}
+
 func TestBasicAuth(t *testing.T) {
 	handler := func(c *core.Context) error {
 		return c.String(200, "OK")
@@ -262,3 +988,928 @@ func createTestContext(rec *httptest.ResponseRecorder, req *http.Request) *core.
 		Response: rec,
 	}
 }
+
+func TestTimeout(t *testing.T) {
+	slow := func(c *core.Context) error {
+		select {
+		case <-time.After(time.Second):
+			return c.String(200, "done")
+		case <-c.Context().Done():
+			return c.Context().Err()
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	Timeout(20 * time.Millisecond)(slow)(createTestContext(rec, req))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", rec.Code)
+	}
+
+	fast := func(c *core.Context) error {
+		c.SetHeader("X-Handler", "fast")
+		return c.String(201, "created")
+	}
+
+	rec2 := httptest.NewRecorder()
+	req2 := httptest.NewRequest("GET", "/", nil)
+	if err := Timeout(time.Second)(fast)(createTestContext(rec2, req2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec2.Code != 201 || rec2.Body.String() != "created" {
+		t.Errorf("Expected 201 created, got %d %q", rec2.Code, rec2.Body.String())
+	}
+	if rec2.Header().Get("X-Handler") != "fast" {
+		t.Error("Expected handler headers to be copied")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen, fromCtx string
+	handler := func(c *core.Context) error {
+		seen = c.RequestID()
+		fromCtx = core.RequestIDFromContext(c.Context())
+		return c.String(200, "OK")
+	}
+
+	wrapped := RequestID()(handler)
+
+	// Generated when missing
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	wrapped(createTestContext(rec, req))
+
+	if len(seen) != 32 || seen != fromCtx {
+		t.Errorf("Expected generated ID in store and context, got %q / %q", seen, fromCtx)
+	}
+	if rec.Header().Get("X-Request-ID") != seen {
+		t.Errorf("Expected ID echoed in response, got %q", rec.Header().Get("X-Request-ID"))
+	}
+
+	// Incoming ID is reused
+	rec2 := httptest.NewRecorder()
+	req2 := httptest.NewRequest("GET", "/", nil)
+	req2.Header.Set("X-Request-ID", "abc-123")
+	wrapped(createTestContext(rec2, req2))
+
+	if seen != "abc-123" || rec2.Header().Get("X-Request-ID") != "abc-123" {
+		t.Errorf("Expected incoming ID abc-123, got %q", seen)
+	}
+
+	// Unsafe incoming ID is replaced
+	rec3 := httptest.NewRecorder()
+	req3 := httptest.NewRequest("GET", "/", nil)
+	req3.Header.Set("X-Request-ID", "bad id\n")
+	wrapped(createTestContext(rec3, req3))
+
+	if seen == "bad id\n" || len(seen) != 32 {
+		t.Errorf("Expected unsafe ID to be replaced, got %q", seen)
+	}
+}
+
+func TestLoggerWithConfig_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	wrapped := LoggerWithConfig(LoggerConfig{Format: LogFormatJSON, Output: &buf})(func(c *core.Context) error {
+		return c.String(404, "missing")
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/items/9", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	wrapped(createTestContext(rec, req))
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected JSON log line, got %q: %v", buf.String(), err)
+	}
+	if entry["status"] != float64(404) || entry["bytes"] != float64(7) {
+		t.Errorf("Expected status 404 and 7 bytes, got %v / %v", entry["status"], entry["bytes"])
+	}
+	if entry["level"] != "WARN" || entry["user_agent"] != "test-agent" {
+		t.Errorf("Unexpected entry %v", entry)
+	}
+}
+
+func TestLoggerWithConfig_HTTPError(t *testing.T) {
+	var buf bytes.Buffer
+	wrapped := LoggerWithConfig(LoggerConfig{Format: LogFormatCommon, Output: &buf})(func(c *core.Context) error {
+		return core.NewHTTPError(http.StatusNotFound)
+	})
+
+	rec := httptest.NewRecorder()
+	wrapped(createTestContext(rec, httptest.NewRequest("GET", "/missing", nil)))
+
+	if !strings.Contains(buf.String(), `"GET /missing HTTP/1.1" 404 `) {
+		t.Errorf("Expected the ErrorHandler's 404 to be logged, got %q", buf.String())
+	}
+}
+
+func TestLoggerWithConfig_Combined(t *testing.T) {
+	var buf bytes.Buffer
+	wrapped := LoggerWithConfig(LoggerConfig{Format: LogFormatCombined, Output: &buf})(func(c *core.Context) error {
+		return c.String(200, "OK")
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/a?b=1", nil)
+	req.RemoteAddr = "10.0.0.5:4321"
+	req.Header.Set("Referer", "http://example.com/")
+	req.Header.Set("User-Agent", "curl/8")
+	wrapped(createTestContext(rec, req))
+
+	line := buf.String()
+	if !strings.HasPrefix(line, "10.0.0.5 - - [") {
+		t.Errorf("Unexpected CLF prefix: %q", line)
+	}
+	if !strings.HasSuffix(line, `"GET /a?b=1 HTTP/1.1" 200 2 "http://example.com/" "curl/8"`+"\n") {
+		t.Errorf("Unexpected CLF line: %q", line)
+	}
+}
+
+func TestLoggerWithConfig_Skip(t *testing.T) {
+	var buf bytes.Buffer
+	wrapped := LoggerWithConfig(LoggerConfig{
+		Format: LogFormatCommon,
+		Output: &buf,
+		Skip:   SkipPathPrefix("/health"),
+	})(func(c *core.Context) error {
+		return c.String(200, "OK")
+	})
+
+	rec := httptest.NewRecorder()
+	wrapped(createTestContext(rec, httptest.NewRequest("GET", "/healthz", nil)))
+
+	if buf.Len() != 0 {
+		t.Errorf("Expected skipped request not to be logged, got %q", buf.String())
+	}
+}
+
+func TestRecoveryWithConfig_Debug(t *testing.T) {
+	handler := func(c *core.Context) error {
+		panic("boom in handler")
+	}
+
+	wrapped := RecoveryWithConfig(RecoveryConfig{Mode: RecoveryModeDebug, DisablePrintStack: true})(handler)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/orders/5", nil)
+	req.Header.Set("X-Trace", "abc")
+	wrapped(createTestContext(rec, req))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"boom in handler", "TestRecoveryWithConfig_Debug", "middleware_test.go", "X-Trace"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected debug page to contain %q", want)
+		}
+	}
+}
+
+func panicInTimeout(c *core.Context) error {
+	panic("boom behind timeout")
+}
+
+func TestRecoveryWithConfig_Timeout(t *testing.T) {
+	var logged any
+	var loggedStack []byte
+	wrapped := RecoveryWithConfig(RecoveryConfig{
+		Mode: RecoveryModeDebug,
+		LogFunc: func(c *core.Context, err any, stack []byte) {
+			logged, loggedStack = err, stack
+		},
+	})(Timeout(time.Second)(panicInTimeout))
+
+	rec := httptest.NewRecorder()
+	wrapped(createTestContext(rec, httptest.NewRequest("GET", "/", nil)))
+
+	if logged != "boom behind timeout" || !bytes.Contains(loggedStack, []byte("panicInTimeout")) {
+		t.Errorf("Expected the handler's panic and stack to be logged, got %v\n%s", logged, loggedStack)
+	}
+	if !strings.Contains(rec.Body.String(), "middleware.panicInTimeout") {
+		t.Errorf("Expected the handler's frames on the debug page, got %s", rec.Body.String())
+	}
+}
+
+func TestRecoveryWithConfig_Production(t *testing.T) {
+	app := core.New()
+	app.SetEnv(core.EnvProduction)
+	app.Use(RecoveryWithConfig(RecoveryConfig{DisablePrintStack: true}))
+	app.SetErrorHandler(func(c *core.Context, err error) {
+		c.JSON(http.StatusInternalServerError, core.Map{"error": err.Error()})
+	})
+	app.GET("/", func(c *core.Context) error {
+		panic("secret detail")
+	})
+	app.GET("/partial", func(c *core.Context) error {
+		c.String(200, "half")
+		panic("late failure")
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "secret detail") {
+		t.Error("Panic value must not leak in production")
+	}
+	if !strings.Contains(rec.Body.String(), `"error":"Internal Server Error"`) {
+		t.Errorf("Expected app ErrorHandler response, got %s", rec.Body.String())
+	}
+
+	rec2 := httptest.NewRecorder()
+	app.ServeHTTP(rec2, httptest.NewRequest("GET", "/partial", nil))
+
+	if rec2.Body.String() != "half" {
+		t.Errorf("Expected written response to be left alone, got %q", rec2.Body.String())
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	handler := func(c *core.Context) error {
+		body, err := c.Body()
+		if err != nil {
+			return err
+		}
+		return c.String(200, string(body))
+	}
+
+	wrapped := BodyLimit("8B")(handler)
+
+	// Within limit
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/", strings.NewReader("small"))
+	if err := wrapped(createTestContext(rec, req)); err != nil || rec.Body.String() != "small" {
+		t.Errorf("Expected body to pass, got %q, err=%v", rec.Body.String(), err)
+	}
+
+	// Declared Content-Length over limit
+	rec2 := httptest.NewRecorder()
+	req2 := httptest.NewRequest("POST", "/", strings.NewReader("this is far too large"))
+	err := wrapped(createTestContext(rec2, req2))
+	if he, ok := err.(*core.HTTPError); !ok || he.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 HTTPError, got %v", err)
+	}
+
+	// Unknown length, cut off while reading
+	rec3 := httptest.NewRecorder()
+	req3 := httptest.NewRequest("POST", "/", io.MultiReader(strings.NewReader("this is "), strings.NewReader("far too large")))
+	req3.ContentLength = -1
+	err = wrapped(createTestContext(rec3, req3))
+	if he, ok := err.(*core.HTTPError); !ok || he.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 HTTPError while reading, got %v", err)
+	}
+}
+
+func TestBodyLimit_Decompress(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(strings.Repeat("a", 100)))
+	zw.Close()
+
+	handler := func(c *core.Context) error {
+		body, err := c.Body()
+		if err != nil {
+			return err
+		}
+		return c.String(200, strconv.Itoa(len(body)))
+	}
+
+	wrapped := BodyLimitWithConfig(BodyLimitConfig{Limit: "1KB", Decompress: true})(handler)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	if err := wrapped(createTestContext(rec, req)); err != nil || rec.Body.String() != "100" {
+		t.Errorf("Expected 100 inflated bytes, got %q, err=%v", rec.Body.String(), err)
+	}
+
+	capped := BodyLimitWithConfig(BodyLimitConfig{Limit: "1KB", Decompress: true, MaxDecompressedSize: "50B"})(handler)
+
+	rec2 := httptest.NewRecorder()
+	req2 := httptest.NewRequest("POST", "/", bytes.NewReader(compressed.Bytes()))
+	req2.Header.Set("Content-Encoding", "gzip")
+	err := capped(createTestContext(rec2, req2))
+	if he, ok := err.(*core.HTTPError); !ok || he.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for oversized inflated body, got %v", err)
+	}
+
+	var deflated bytes.Buffer
+	dw := zlib.NewWriter(&deflated)
+	dw.Write([]byte(strings.Repeat("b", 70)))
+	dw.Close()
+
+	rec3 := httptest.NewRecorder()
+	req3 := httptest.NewRequest("POST", "/", bytes.NewReader(deflated.Bytes()))
+	req3.Header.Set("Content-Encoding", "deflate")
+	if err := wrapped(createTestContext(rec3, req3)); err != nil || rec3.Body.String() != "70" {
+		t.Errorf("Expected 70 inflated bytes from a zlib body, got %q, err=%v", rec3.Body.String(), err)
+	}
+
+	req4 := httptest.NewRequest("POST", "/", strings.NewReader("not zlib"))
+	req4.Header.Set("Content-Encoding", "deflate")
+	err = wrapped(createTestContext(httptest.NewRecorder(), req4))
+	if he, ok := err.(*core.HTTPError); !ok || he.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid deflate body, got %v", err)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"100":   100,
+		"512B":  512,
+		"64KB":  64 << 10,
+		"2MB":   2 << 20,
+		"1gb":   1 << 30,
+		"3 MiB": 3 << 20,
+	}
+	for in, want := range tests {
+		got, err := ParseByteSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := ParseByteSize("lots"); err == nil {
+		t.Error("Expected error for invalid size")
+	}
+}
+
+func TestCompress(t *testing.T) {
+	page := strings.Repeat("<p>GoIgniter</p>", 200)
+	wrapped := Compress()(func(c *core.Context) error {
+		switch c.Path() {
+		case "/small":
+			return c.String(200, "tiny")
+		case "/png":
+			return c.Blob(200, "image/png", []byte(page))
+		}
+		return c.HTML(200, page)
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "deflate;q=0.5, gzip")
+	if err := wrapped(createTestContext(rec, req)); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip encoding, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", rec.Header().Get("Vary"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(zr)
+	if string(body) != page {
+		t.Error("Decompressed body mismatch")
+	}
+
+	for _, path := range []string{"/small", "/png"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		wrapped(createTestContext(rec, req))
+
+		if rec.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s: expected no compression", path)
+		}
+	}
+
+	// Client without gzip support
+	rec2 := httptest.NewRecorder()
+	wrapped(createTestContext(rec2, httptest.NewRequest("GET", "/", nil)))
+	if rec2.Header().Get("Content-Encoding") != "" || rec2.Body.String() != page {
+		t.Error("Expected identity response without Accept-Encoding")
+	}
+
+	// deflate is a zlib stream, readable by standard decoders.
+	rec3 := httptest.NewRecorder()
+	req3 := httptest.NewRequest("GET", "/", nil)
+	req3.Header.Set("Accept-Encoding", "deflate")
+	wrapped(createTestContext(rec3, req3))
+	if rec3.Header().Get("Content-Encoding") != "deflate" {
+		t.Fatalf("Expected deflate encoding, got %q", rec3.Header().Get("Content-Encoding"))
+	}
+	dr, err := zlib.NewReader(rec3.Body)
+	if err != nil {
+		t.Fatalf("Expected a zlib stream: %v", err)
+	}
+	if body, _ := io.ReadAll(dr); string(body) != page {
+		t.Error("Inflated deflate body mismatch")
+	}
+}
+
+func TestCompress_NoCompression(t *testing.T) {
+	page := strings.Repeat("<p>GoIgniter</p>", 200)
+	wrapped := CompressWithConfig(CompressConfig{Level: NoCompression})(func(c *core.Context) error {
+		return c.HTML(200, page)
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	wrapped(createTestContext(rec, req))
+
+	if rec.Body.Len() <= len(page) {
+		t.Errorf("Expected stored blocks larger than the page, got %d bytes", rec.Body.Len())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != page {
+		t.Error("Decompressed body mismatch")
+	}
+}
+
+func TestCompress_Flush(t *testing.T) {
+	wrapped := Compress()(func(c *core.Context) error {
+		c.SetHeader("Content-Type", "text/event-stream")
+		c.Response.Write([]byte("data: hello\n\n"))
+		c.Response.(http.Flusher).Flush()
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	wrapped(createTestContext(rec, req))
+
+	if !rec.Flushed || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected flushed gzip stream, flushed=%v encoding=%q", rec.Flushed, rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(zr)
+	if string(body) != "data: hello\n\n" {
+		t.Errorf("Unexpected event body %q", body)
+	}
+}
+
+func TestETag(t *testing.T) {
+	wrapped := ETag()(func(c *core.Context) error {
+		return c.JSON(200, core.Map{"products": []string{"a", "b"}})
+	})
+
+	rec := httptest.NewRecorder()
+	wrapped(createTestContext(rec, httptest.NewRequest("GET", "/catalog", nil)))
+
+	etag := rec.Header().Get("ETag")
+	if rec.Code != 200 || etag == "" || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("Expected 200 with strong ETag, got %d %q", rec.Code, etag)
+	}
+
+	rec2 := httptest.NewRecorder()
+	req2 := httptest.NewRequest("GET", "/catalog", nil)
+	req2.Header.Set("If-None-Match", etag)
+	wrapped(createTestContext(rec2, req2))
+
+	if rec2.Code != http.StatusNotModified || rec2.Body.Len() != 0 {
+		t.Errorf("Expected empty 304, got %d with %d bytes", rec2.Code, rec2.Body.Len())
+	}
+
+	// POST requests are not touched
+	rec3 := httptest.NewRecorder()
+	wrapped(createTestContext(rec3, httptest.NewRequest("POST", "/catalog", nil)))
+	if rec3.Header().Get("ETag") != "" {
+		t.Error("Expected no ETag on POST")
+	}
+}
+
+func TestETag_HandlerValidator(t *testing.T) {
+	rendered := false
+	wrapped := ETagWithConfig(ETagConfig{Weak: true})(func(c *core.Context) error {
+		if c.ETag("rev-7") {
+			return nil
+		}
+		rendered = true
+		return c.String(200, "catalog")
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", `"rev-7"`)
+	wrapped(createTestContext(rec, req))
+
+	if rendered || rec.Code != http.StatusNotModified {
+		t.Errorf("Expected handler to short-circuit with 304, got %d (rendered=%v)", rec.Code, rendered)
+	}
+}
+
+func TestPageCache(t *testing.T) {
+	config := PageCacheConfig{TTL: time.Minute, Store: cache.NewMemory()}
+	hits := 0
+	wrapped := PageCacheWithConfig(config)(func(c *core.Context) error {
+		hits++
+		c.SetHeader("ETag", `"v`+strconv.Itoa(hits)+`"`)
+		c.SetHeader("RateLimit-Remaining", strconv.Itoa(10-hits))
+		return c.HTML(200, "<h1>Products</h1>")
+	})
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		wrapped(createTestContext(rec, httptest.NewRequest("GET", "/products?page=1", nil)))
+
+		if rec.Body.String() != "<h1>Products</h1>" || rec.Header().Get("ETag") != `"v1"` {
+			t.Errorf("Request %d: unexpected response %q (etag %s)", i+1, rec.Body.String(), rec.Header().Get("ETag"))
+		}
+		if i == 1 && rec.Header().Get("RateLimit-Remaining") != "" {
+			t.Errorf("Expected request-scoped headers not to be replayed, got %v", rec.Header())
+		}
+	}
+	if hits != 1 {
+		t.Errorf("Expected handler to run once, ran %d times", hits)
+	}
+
+	// POST bypasses the cache
+	wrapped(createTestContext(httptest.NewRecorder(), httptest.NewRequest("POST", "/products?page=1", nil)))
+	if hits != 2 {
+		t.Errorf("Expected POST to reach the handler, hits=%d", hits)
+	}
+
+	// Purging by prefix forces a re-render
+	config.PurgePrefix("/products")
+	wrapped(createTestContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/products?page=1", nil)))
+	if hits != 3 {
+		t.Errorf("Expected purge to force re-render, hits=%d", hits)
+	}
+}
+
+func TestPageCache_ViewData(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "page.html"), []byte(`<p>{{.Title}}</p>`), 0o644)
+
+	app := core.New()
+	if err := app.LoadTemplates(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	hits := 0
+	app.Use(PageCache(time.Minute, nil))
+	app.GET("/public", func(c *core.Context) error {
+		hits++
+		return c.View("page", core.Map{"Title": "Public"})
+	})
+	app.GET("/form", func(c *core.Context) error {
+		hits++
+		c.SetViewData("csrf_token", strconv.Itoa(hits))
+		return c.View("page", core.Map{"Title": "Form"})
+	})
+
+	for i := 0; i < 2; i++ {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/public", nil))
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/form", nil))
+	}
+	if hits != 3 {
+		t.Errorf("Expected only the page without request-scoped data to be cached, hits=%d", hits)
+	}
+	PurgePage("/public")
+}
+
+func TestPageCache_Compress(t *testing.T) {
+	page := strings.Repeat("<p>page</p>", 200)
+	hits := 0
+	handler := func(c *core.Context) error {
+		hits++
+		return c.HTML(200, page)
+	}
+
+	get := func(app *core.Application, gzipped bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if gzipped {
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Compressed inside the cache: not stored.
+	inner := core.New()
+	inner.Use(PageCacheWithConfig(PageCacheConfig{TTL: time.Minute, Store: cache.NewMemory()}))
+	inner.Use(Compress())
+	inner.GET("/", handler)
+	get(inner, true)
+	if rec := get(inner, false); rec.Body.String() != page || rec.Header().Get("Content-Encoding") != "" || hits != 2 {
+		t.Errorf("Expected the gzipped page not to be cached, hits=%d, got %q", hits, rec.Header().Get("Content-Encoding"))
+	}
+
+	// Compressed outside the cache: stored plain, encoded per client.
+	hits = 0
+	outer := core.New()
+	outer.Use(Compress())
+	outer.Use(PageCacheWithConfig(PageCacheConfig{TTL: time.Minute, Store: cache.NewMemory()}))
+	outer.GET("/", handler)
+	get(outer, false)
+	rec := get(outer, true)
+	if hits != 1 || rec.Header().Get("X-Cache") != "HIT" || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a compressed cache hit, hits=%d, got %v", hits, rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != page {
+		t.Errorf("Expected the cached page, got %q", body)
+	}
+}
+
+func TestPageCache_CacheFor(t *testing.T) {
+	hits := 0
+	wrapped := PageCache(0, nil)(func(c *core.Context) error {
+		hits++
+		if c.Path() == "/cached" {
+			c.CacheFor(time.Minute)
+		}
+		return c.String(200, "page")
+	})
+
+	for i := 0; i < 2; i++ {
+		wrapped(createTestContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/cached", nil)))
+		wrapped(createTestContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/uncached", nil)))
+	}
+	if hits != 3 {
+		t.Errorf("Expected only /cached to be cached, hits=%d", hits)
+	}
+
+	PurgePage("/cached")
+	wrapped(createTestContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/cached", nil)))
+	if hits != 4 {
+		t.Errorf("Expected PurgePage to drop /cached, hits=%d", hits)
+	}
+}
+
+func TestSecure(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "page.html"), []byte(`<script nonce="{{.csp_nonce}}">init()</script>`), 0644)
+
+	app := core.New()
+	if err := app.LoadTemplates(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultSecureConfig()
+	config.ContentSecurityPolicy = NewCSP().
+		DefaultSrc("'self'").
+		ScriptSrc("'self'", CSPNonceSource).
+		ObjectSrc("'none'")
+	app.Use(Secure(config))
+	app.GET("/", func(c *core.Context) error {
+		return c.View("page", nil)
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	app.ServeHTTP(rec, req)
+
+	if rec.Header().Get("X-Frame-Options") != "SAMEORIGIN" || rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("Missing default headers: %v", rec.Header())
+	}
+	if rec.Header().Get("Strict-Transport-Security") != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Unexpected HSTS %q", rec.Header().Get("Strict-Transport-Security"))
+	}
+
+	csp := rec.Header().Get("Content-Security-Policy")
+	start := strings.Index(csp, "'nonce-")
+	if start < 0 {
+		t.Fatalf("Expected nonce in CSP, got %q", csp)
+	}
+	nonce := csp[start+len("'nonce-"):]
+	nonce = nonce[:strings.Index(nonce, "'")]
+	if !strings.Contains(rec.Body.String(), `nonce="`+nonce+`"`) {
+		t.Errorf("Expected template to receive nonce %q, got %s", nonce, rec.Body.String())
+	}
+	if !strings.HasPrefix(csp, "default-src 'self'; script-src 'self' 'nonce-") || !strings.HasSuffix(csp, "; object-src 'none'") {
+		t.Errorf("Unexpected CSP %q", csp)
+	}
+
+	// Plain HTTP gets no HSTS and a fresh nonce
+	rec2 := httptest.NewRecorder()
+	app.ServeHTTP(rec2, httptest.NewRequest("GET", "/", nil))
+	if rec2.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS must not be sent over plain HTTP")
+	}
+	if rec2.Header().Get("Content-Security-Policy") == csp {
+		t.Error("Expected a new nonce per request")
+	}
+}
+
+func TestCSRF_Cookie(t *testing.T) {
+	app := core.New()
+	app.Use(CSRFWithConfig(CSRFConfig{Mode: CSRFModeCookie, Secret: "test-secret"}))
+	app.GET("/form", func(c *core.Context) error {
+		return c.String(200, CSRFToken(c))
+	})
+	app.POST("/submit", func(c *core.Context) error {
+		return c.String(200, "OK")
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/form", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "_csrf" {
+		t.Fatalf("Expected CSRF cookie, got %v", cookies)
+	}
+	token := rec.Body.String()
+
+	post := func(token, origin string) int {
+		form := strings.NewReader("_csrf=" + token)
+		req := httptest.NewRequest("POST", "http://example.com/submit", form)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		req.AddCookie(cookies[0])
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post(token, "http://example.com"); code != 200 {
+		t.Errorf("Expected 200 with valid token, got %d", code)
+	}
+	if code := post("", ""); code != 403 {
+		t.Errorf("Expected 403 without token, got %d", code)
+	}
+	if code := post(token, "https://evil.test"); code != 403 {
+		t.Errorf("Expected 403 for foreign origin, got %d", code)
+	}
+	if code := post(token, "null"); code != 403 {
+		t.Errorf("Expected 403 for null origin, got %d", code)
+	}
+
+	// Tokens are masked per request but stay valid
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/form", nil)
+	req.AddCookie(cookies[0])
+	app.ServeHTTP(rec, req)
+	if rec.Body.String() == token {
+		t.Error("Expected a freshly masked token")
+	}
+	if code := post(rec.Body.String(), ""); code != 200 {
+		t.Errorf("Expected 200 with re-masked token, got %d", code)
+	}
+}
+
+func TestCSRF_HeaderAndExempt(t *testing.T) {
+	app := core.New()
+	app.Use(CSRFWithConfig(CSRFConfig{
+		Mode:           CSRFModeCookie,
+		Secret:         "test-secret",
+		TrustedOrigins: []string{"https://app.example.com"},
+		Exempt:         []string{"/webhook/:provider"},
+	}))
+	app.GET("/form", func(c *core.Context) error {
+		return c.String(200, CSRFToken(c))
+	})
+	app.DELETE("/items/:id", func(c *core.Context) error {
+		return c.NoContent(204)
+	})
+	app.POST("/webhook/:provider", func(c *core.Context) error {
+		return c.String(200, "OK")
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/form", nil))
+	cookie := rec.Result().Cookies()[0]
+
+	req := httptest.NewRequest("DELETE", "http://example.com/items/1", nil)
+	req.Header.Set("X-CSRF-Token", rec.Body.String())
+	req.Header.Set("Origin", "https://app.example.com")
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != 204 {
+		t.Errorf("Expected 204 with header token, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("POST", "/webhook/stripe", nil))
+	if rec.Code != 200 {
+		t.Errorf("Expected exempt route to pass, got %d", rec.Code)
+	}
+}
+
+func TestCSRF_TemplateFuncs(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "form.html"),
+		[]byte(`<form>{{csrf_field}}<i>{{csrf_token}}</i>{{.Title}}</form>`), 0o644)
+
+	app := core.New()
+	if err := app.LoadTemplatesWithFuncs(dir, false, helpers.AllTemplateFuncs()); err != nil {
+		t.Fatal(err)
+	}
+	app.Use(CSRFWithConfig(CSRFConfig{Mode: CSRFModeCookie, Secret: "test-secret"}))
+	app.GET("/form", func(c *core.Context) error {
+		return c.View("form", core.Map{"Title": "New"})
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/form", nil))
+	body := rec.Body.String()
+	start := strings.Index(body, "<i>") + 3
+	token := body[start:strings.Index(body, "</i>")]
+	want := `<form><input type="hidden" name="_csrf" value="` + token + `"><i>` + token + `</i>New</form>`
+	if token == "" || body != want {
+		t.Errorf("Expected %q, got %q", want, body)
+	}
+
+	var buf bytes.Buffer
+	if err := app.Renderer().Render(&buf, "form", nil); err != nil || buf.String() != "<form><i></i></form>" {
+		t.Errorf("Expected empty CSRF funcs outside a request, got %q, %v", buf.String(), err)
+	}
+}
+
+func TestMatchRoutePattern(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/api/*", "/api/users/1", true},
+		{"/api/*", "/apix", false},
+		{"/webhook/:provider", "/webhook/stripe", true},
+		{"/webhook/:provider", "/webhook/stripe/extra", false},
+		{"/login", "/login", true},
+		{"/login", "/logout", false},
+	}
+	for _, tt := range tests {
+		if got := matchRoutePattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchRoutePattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMethodOverride(t *testing.T) {
+	app := core.New()
+	app.Pre(MethodOverride())
+	app.DELETE("/users/:id", func(c *core.Context) error {
+		return c.String(200, "deleted "+c.Param("id"))
+	})
+	app.POST("/users/:id", func(c *core.Context) error {
+		return c.String(200, "posted")
+	})
+
+	tests := []struct {
+		name, body, header, want string
+	}{
+		{"form field", "_method=delete", "", "deleted 5"},
+		{"header", "", "DELETE", "deleted 5"},
+		{"disallowed method", "_method=GET", "", "posted"},
+		{"no override", "name=x", "", "posted"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/users/5", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.header != "" {
+			req.Header.Set("X-HTTP-Method-Override", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if rec.Body.String() != tt.want {
+			t.Errorf("%s: expected %q, got %d %q", tt.name, tt.want, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Multipart bodies are left unparsed; the field must be in the URL.
+	var formParsed bool
+	mapp := core.New()
+	mapp.Pre(MethodOverride())
+	echoMethod := func(c *core.Context) error {
+		formParsed = c.Request.MultipartForm != nil || c.Request.PostForm != nil
+		return c.String(200, c.Method())
+	}
+	mapp.POST("/users/:id", echoMethod)
+	mapp.DELETE("/users/:id", echoMethod)
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("_method", "DELETE")
+	mw.Close()
+	for target, want := range map[string]string{"/users/5": "POST", "/users/5?_method=DELETE": "DELETE"} {
+		req := httptest.NewRequest("POST", target, bytes.NewReader(body.Bytes()))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		mapp.ServeHTTP(rec, req)
+		if rec.Body.String() != want || formParsed {
+			t.Errorf("multipart %s: expected %q with the body unparsed, got %q (parsed %v)", target, want, rec.Body.String(), formParsed)
+		}
+	}
+
+	// GET requests are never rewritten
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/users/5", nil)
+	req.Header.Set("X-HTTP-Method-Override", "DELETE")
+	app.ServeHTTP(rec, req)
+	if rec.Code != 404 {
+		t.Errorf("Expected GET to stay unrouted, got %d", rec.Code)
+	}
+}
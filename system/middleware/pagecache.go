@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/semutdev/goigniter/system/core"
+	"github.com/semutdev/goigniter/system/libraries/cache"
+	"github.com/semutdev/goigniter/system/libraries/session"
+)
+
+// PageCacheConfig holds configuration for the page cache middleware.
+type PageCacheConfig struct {
+	// TTL is how long pages are cached. If zero, only responses whose
+	// handler called c.CacheFor are cached.
+	TTL time.Duration
+
+	// KeyFunc builds the cache key (default: the request URI).
+	KeyFunc func(c *core.Context) string
+
+	// Store holds cached pages (default: a shared in-memory store that
+	// PurgePage and PurgePagePrefix operate on). Purge pages of another
+	// store with the config's Purge and PurgePrefix methods.
+	Store cache.Store
+
+	// Bypass skips the cache, e.g. for logged-in users.
+	Bypass func(c *core.Context) bool
+
+	// BypassSessionKey skips the cache when the session holds this key,
+	// e.g. "user_id".
+	BypassSessionKey string
+
+	// MaxSize is the largest body that is cached (default: 2MB).
+	MaxSize int
+}
+
+// cachedPage is what PageCache keeps in the store.
+type cachedPage struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+var defaultPageStore = cache.NewMemory()
+
+// pageCacheHeaders are the response headers stored with a page. Others,
+// like request IDs, rate limit counters or a CSP with a nonce, describe
+// the request that rendered it rather than the page.
+var pageCacheHeaders = []string{
+	"Content-Type",
+	"Content-Language",
+	"Cache-Control",
+	"ETag",
+	"Last-Modified",
+}
+
+// PurgePage removes a page from the default page cache store.
+func PurgePage(key string) error {
+	return defaultPageStore.Delete(key)
+}
+
+// PurgePagePrefix removes all pages whose key starts with prefix from
+// the default page cache store, e.g. PurgePagePrefix("/products/").
+func PurgePagePrefix(prefix string) error {
+	return defaultPageStore.DeletePrefix(prefix)
+}
+
+// Purge removes a page from the config's store, or the default store
+// when Store is nil.
+func (config PageCacheConfig) Purge(key string) error {
+	return config.store().Delete(key)
+}
+
+// PurgePrefix removes all pages whose key starts with prefix from the
+// config's store, or the default store when Store is nil.
+func (config PageCacheConfig) PurgePrefix(prefix string) error {
+	return config.store().DeletePrefix(prefix)
+}
+
+func (config PageCacheConfig) store() cache.Store {
+	if config.Store == nil {
+		return defaultPageStore
+	}
+	return config.Store
+}
+
+// PageCache returns a full-page output cache middleware.
+// keyFunc may be nil to key pages by request URI.
+func PageCache(ttl time.Duration, keyFunc func(c *core.Context) string) core.Middleware {
+	return PageCacheWithConfig(PageCacheConfig{TTL: ttl, KeyFunc: keyFunc})
+}
+
+// PageCacheWithConfig returns a PageCache middleware with custom config.
+//
+// Only GET and HEAD requests are served from the cache, and only 200
+// responses without Set-Cookie, Content-Encoding or a private/no-store
+// Cache-Control are stored. Register Compress before PageCache, so pages
+// are cached uncompressed and compressed for each client; compressed by
+// middleware inside PageCache, they aren't cached at all. Pages rendered with request-scoped view data, such as the CSP
+// nonce of Secure or the token of CSRF, are not stored either, since
+// they would hand one visitor's values to everyone; leave those
+// middleware off the routes whose pages should be cached.
+func PageCacheWithConfig(config PageCacheConfig) core.Middleware {
+	if config.KeyFunc == nil {
+		config.KeyFunc = func(c *core.Context) string {
+			return c.Request.URL.RequestURI()
+		}
+	}
+	if config.Store == nil {
+		config.Store = defaultPageStore
+	}
+	if config.MaxSize == 0 {
+		config.MaxSize = 2 << 20
+	}
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			method := c.Method()
+			if method != http.MethodGet && method != http.MethodHead {
+				return next(c)
+			}
+			if config.Bypass != nil && config.Bypass(c) {
+				return next(c)
+			}
+			if config.BypassSessionKey != "" && session.Get(c).Get(config.BypassSessionKey) != nil {
+				return next(c)
+			}
+
+			key := config.KeyFunc(c)
+			if data, ok, _ := config.Store.Get(key); ok {
+				var page cachedPage
+				if json.Unmarshal(data, &page) == nil {
+					h := c.Response.Header()
+					for k, v := range page.Header {
+						h[k] = v
+					}
+					h.Set("X-Cache", "HIT")
+					return c.Blob(page.Status, h.Get("Content-Type"), page.Body)
+				}
+			}
+
+			pw := &pageCacheWriter{ResponseWriter: c.Response, maxSize: config.MaxSize}
+			c.Response.Header().Set("X-Cache", "MISS")
+			c.Response = pw
+			err := next(c)
+			c.Response = pw.ResponseWriter
+
+			ttl := config.TTL
+			if d, ok := c.Get(core.CacheForKey).(time.Duration); ok {
+				ttl = d
+			}
+			if err != nil || ttl <= 0 || pw.overflow || method != http.MethodGet ||
+				!cacheable(pw) || c.ViewDataRendered() {
+				return err
+			}
+
+			header := make(http.Header)
+			for _, h := range pageCacheHeaders {
+				if v := c.Response.Header().Values(h); len(v) > 0 {
+					header[http.CanonicalHeaderKey(h)] = v
+				}
+			}
+			data, merr := json.Marshal(cachedPage{Status: pw.code, Header: header, Body: pw.buf.Bytes()})
+			if merr == nil {
+				config.Store.Set(key, data, ttl)
+			}
+			return nil
+		}
+	}
+}
+
+func cacheable(pw *pageCacheWriter) bool {
+	if pw.code != http.StatusOK {
+		return false
+	}
+	h := pw.Header()
+	// Cookies belong to one visitor, and an encoded body would reach
+	// clients that can't decode it.
+	if h.Get("Set-Cookie") != "" || h.Get("Content-Encoding") != "" {
+		return false
+	}
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	return !strings.Contains(cc, "private") && !strings.Contains(cc, "no-store")
+}
+
+// pageCacheWriter passes the response through while keeping a copy.
+type pageCacheWriter struct {
+	http.ResponseWriter
+	maxSize  int
+	buf      bytes.Buffer
+	code     int
+	overflow bool
+}
+
+func (w *pageCacheWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *pageCacheWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if !w.overflow {
+		if w.buf.Len()+len(p) > w.maxSize {
+			w.overflow = true
+			w.buf.Reset()
+		} else {
+			w.buf.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher.
+func (w *pageCacheWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter.
+func (w *pageCacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
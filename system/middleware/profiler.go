@@ -0,0 +1,380 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/semutdev/goigniter/system/core"
+	"github.com/semutdev/goigniter/system/libraries/database"
+	"github.com/semutdev/goigniter/system/libraries/session"
+)
+
+// ProfilerConfig holds configuration for the profiler middleware.
+type ProfilerConfig struct {
+	// MaxBodySize is the largest response that is buffered to receive the
+	// toolbar (default: 5MB). Larger or flushed responses pass through.
+	MaxBodySize int
+
+	// MaxQueries caps the queries listed per request (default: 500).
+	MaxQueries int
+
+	// Skip bypasses the middleware for matching requests.
+	Skip func(c *core.Context) bool
+}
+
+// Profiler returns a middleware that adds a debug toolbar to HTML pages
+// in development, like CodeIgniter's enable_profiler.
+func Profiler() core.Middleware {
+	return ProfilerWithConfig(ProfilerConfig{})
+}
+
+// ProfilerWithConfig returns a Profiler middleware with custom config.
+//
+// The toolbar is inserted before </body> of HTML responses, so fragments
+// (e.g. htmx partials) are left alone. It shows elapsed time, memory,
+// SQL queries with timing and arguments, rendered templates, session
+// data, request headers, the matched route and the middleware chain.
+// Outside development the middleware does nothing.
+//
+// Queries run with db.For(c) are always attributed to their request.
+// Queries without a request context are attributed to the request being
+// profiled if it is the only one in flight; otherwise every request in
+// flight counts them as not attributed. Cookie and Authorization request
+// headers are redacted.
+//
+// Register it early so it covers the other middleware, but after
+// Compress, whose output can't be modified:
+//
+//	app.Use(middleware.Logger())
+//	app.Use(middleware.Profiler())
+func ProfilerWithConfig(config ProfilerConfig) core.Middleware {
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = 5 << 20
+	}
+	if config.MaxQueries == 0 {
+		config.MaxQueries = 500
+	}
+	profilerHooksOnce.Do(registerProfilerHooks)
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			if !c.IsDevelopment() || (config.Skip != nil && config.Skip(c)) {
+				return next(c)
+			}
+
+			p := &profile{start: time.Now(), maxQueries: config.MaxQueries}
+			var mem runtime.MemStats
+			runtime.ReadMemStats(&mem)
+			p.allocBefore = mem.TotalAlloc
+
+			activeProfiles.add(p)
+			c.SetContext(context.WithValue(c.Context(), profileKey{}, p))
+
+			ew := &etagWriter{ResponseWriter: c.Response, maxSize: config.MaxBodySize}
+			c.Response = ew
+			err := next(c)
+			c.Response = ew.ResponseWriter
+			activeProfiles.remove(p)
+
+			if ew.passthrough || (err != nil && ew.code == 0) {
+				return err
+			}
+			if ew.code == 0 {
+				ew.code = http.StatusOK
+			}
+
+			body := ew.buf
+			h := c.Response.Header()
+			if strings.HasPrefix(h.Get("Content-Type"), "text/html") && h.Get("Content-Encoding") == "" {
+				if i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>")); i >= 0 {
+					var toolbar bytes.Buffer
+					p.render(&toolbar, c, ew.code)
+					out := make([]byte, 0, len(body)+toolbar.Len())
+					out = append(out, body[:i]...)
+					out = append(out, toolbar.Bytes()...)
+					body = append(out, body[i:]...)
+					if h.Get("Content-Length") != "" {
+						h.Set("Content-Length", strconv.Itoa(len(body)))
+					}
+				}
+			}
+
+			c.Response.WriteHeader(ew.code)
+			if c.Method() != http.MethodHead && len(body) > 0 {
+				if _, werr := c.Response.Write(body); werr != nil && err == nil {
+					err = werr
+				}
+			}
+			return err
+		}
+	}
+}
+
+type profileKey struct{}
+
+// profile collects what happens during one request.
+type profile struct {
+	start       time.Time
+	allocBefore uint64
+	maxQueries  int
+
+	mu           sync.Mutex
+	queries      []database.QueryEvent
+	dropped      int
+	unattributed int
+	templates    []core.RenderEvent
+}
+
+// profileSet tracks the requests being profiled.
+type profileSet struct {
+	mu       sync.Mutex
+	profiles map[*profile]struct{}
+}
+
+var (
+	profilerHooksOnce sync.Once
+	activeProfiles    = &profileSet{profiles: make(map[*profile]struct{})}
+)
+
+func (s *profileSet) add(p *profile) {
+	s.mu.Lock()
+	s.profiles[p] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *profileSet) remove(p *profile) {
+	s.mu.Lock()
+	delete(s.profiles, p)
+	s.mu.Unlock()
+}
+
+// only returns the single profile in flight, or nil.
+func (s *profileSet) only() *profile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.profiles) != 1 {
+		return nil
+	}
+	for p := range s.profiles {
+		return p
+	}
+	return nil
+}
+
+// unattributed counts a query that could not be attributed to one of
+// the profiles in flight.
+func (s *profileSet) unattributed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := range s.profiles {
+		p.mu.Lock()
+		p.unattributed++
+		p.mu.Unlock()
+	}
+}
+
+// profileFor returns the profile of the request ctx belongs to.
+func profileFor(ctx context.Context) *profile {
+	if p, ok := ctx.Value(profileKey{}).(*profile); ok {
+		return p
+	}
+	return activeProfiles.only()
+}
+
+func registerProfilerHooks() {
+	database.OnQuery(func(ctx context.Context, e database.QueryEvent) {
+		p := profileFor(ctx)
+		if p == nil {
+			activeProfiles.unattributed()
+			return
+		}
+		p.mu.Lock()
+		if len(p.queries) < p.maxQueries {
+			p.queries = append(p.queries, e)
+		} else {
+			p.dropped++
+		}
+		p.mu.Unlock()
+	})
+	core.OnRender(func(ctx context.Context, e core.RenderEvent) {
+		if p := profileFor(ctx); p != nil {
+			p.mu.Lock()
+			p.templates = append(p.templates, e)
+			p.mu.Unlock()
+		}
+	})
+}
+
+// profilerRedactedHeaders are request headers whose values the toolbar
+// hides, since pages may be shared or captured in screenshots.
+var profilerRedactedHeaders = []string{"Cookie", "Authorization"}
+
+type profiledQuery struct {
+	SQL      string
+	Args     string
+	Duration string
+	Error    string
+}
+
+type profiledTemplate struct {
+	Name     string
+	Duration string
+	Error    string
+}
+
+// render writes the toolbar for the finished request.
+func (p *profile) render(w *bytes.Buffer, c *core.Context, status int) {
+	elapsed := time.Since(p.start)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	p.mu.Lock()
+	var queryTime time.Duration
+	queries := make([]profiledQuery, len(p.queries))
+	for i, q := range p.queries {
+		queryTime += q.Duration
+		queries[i] = profiledQuery{SQL: q.SQL, Args: formatArgs(q.Args), Duration: formatDuration(q.Duration)}
+		if q.Err != nil {
+			queries[i].Error = q.Err.Error()
+		}
+	}
+	templates := make([]profiledTemplate, len(p.templates))
+	for i, t := range p.templates {
+		templates[i] = profiledTemplate{Name: t.Name, Duration: formatDuration(t.Duration)}
+		if t.Err != nil {
+			templates[i].Error = t.Err.Error()
+		}
+	}
+	dropped, unattributed := p.dropped, p.unattributed
+	p.mu.Unlock()
+
+	var sess []keyValue
+	if s := session.Get(c); s != nil {
+		sess = sortedPairs(s.Data, func(v any) string { return fmt.Sprintf("%v", v) })
+	}
+
+	headers := c.Request.Header.Clone()
+	for _, h := range profilerRedactedHeaders {
+		if headers.Get(h) != "" {
+			headers.Set(h, "[redacted]")
+		}
+	}
+
+	data := map[string]any{
+		"Nonce":        CSPNonce(c),
+		"Elapsed":      formatDuration(elapsed),
+		"Allocated":    formatBytes(mem.TotalAlloc - p.allocBefore),
+		"Heap":         formatBytes(mem.HeapAlloc),
+		"Goroutines":   runtime.NumGoroutine(),
+		"Method":       c.Method(),
+		"URL":          c.Request.URL.String(),
+		"Status":       status,
+		"Route":        c.Route(),
+		"Params":       sortedPairs(c.Params(), func(v string) string { return v }),
+		"Middleware":   c.MiddlewareChain(),
+		"Queries":      queries,
+		"QueryTime":    formatDuration(queryTime),
+		"Dropped":      dropped,
+		"Unattributed": unattributed,
+		"Templates":    templates,
+		"Session":      sess,
+		"Headers":      sortedPairs(headers, func(v []string) string { return strings.Join(v, ", ") }),
+	}
+	if err := profilerTemplate.Execute(w, data); err != nil {
+		fmt.Fprintf(w, "<pre>profiler: %s</pre>", template.HTMLEscapeString(err.Error()))
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	return strconv.FormatFloat(float64(d.Microseconds())/1000, 'f', 2, 64) + " ms"
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<20:
+		return strconv.FormatFloat(float64(n)/(1<<20), 'f', 2, 64) + " MB"
+	case n >= 1<<10:
+		return strconv.FormatFloat(float64(n)/(1<<10), 'f', 1, 64) + " KB"
+	}
+	return strconv.FormatUint(n, 10) + " B"
+}
+
+// formatArgs renders query arguments compactly, shortening long values.
+func formatArgs(args []any) string {
+	if len(args) == 0 {
+		return ""
+	}
+	parts := make([]string, len(args))
+	for i, a := range args {
+		var s string
+		switch v := a.(type) {
+		case []byte:
+			s = fmt.Sprintf("[%d bytes]", len(v))
+		case string:
+			s = strconv.Quote(v)
+		default:
+			s = fmt.Sprintf("%v", v)
+		}
+		if len(s) > 100 {
+			s = strings.ToValidUTF8(s[:100], "") + "…"
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, ", ")
+}
+
+var profilerTemplate = template.Must(template.New("profiler").Parse(`
+<div id="gi-profiler">
+<style{{if .Nonce}} nonce="{{.Nonce}}"{{end}}>
+#gi-profiler{position:fixed;left:0;right:0;bottom:0;z-index:2147483647;max-height:60vh;overflow:auto;background:#1e1e1e;color:#ddd;font:12px/1.4 -apple-system,Segoe UI,Helvetica,Arial,sans-serif;box-shadow:0 -2px 6px rgba(0,0,0,.3);text-align:left}
+#gi-profiler summary{cursor:pointer;padding:6px 12px}
+#gi-profiler>details>summary{background:#c0392b;color:#fff;font-weight:600}
+#gi-profiler section{border-top:1px solid #333}
+#gi-profiler section summary{color:#f0a500;font-weight:600}
+#gi-profiler table{border-collapse:collapse;width:100%}
+#gi-profiler td{border-top:1px solid #333;padding:3px 12px;vertical-align:top;word-break:break-all}
+#gi-profiler td.k{width:22%;color:#9cdcfe}
+#gi-profiler code{color:#ce9178;white-space:pre-wrap}
+#gi-profiler .err{color:#f48771}
+#gi-profiler .t{white-space:nowrap;color:#b5cea8;width:80px}
+</style>
+<details>
+<summary>{{.Elapsed}} &middot; {{.Allocated}} allocated &middot; {{len .Queries}} queries ({{.QueryTime}}) &middot; {{len .Templates}} templates &middot; {{.Method}} {{if .Route}}{{.Route}}{{else}}{{.URL}}{{end}} &rarr; {{.Status}}</summary>
+<section><details open><summary>Request</summary><table>
+<tr><td class="k">URL</td><td>{{.Method}} {{.URL}}</td></tr>
+<tr><td class="k">Status</td><td>{{.Status}}</td></tr>
+<tr><td class="k">Elapsed</td><td>{{.Elapsed}}</td></tr>
+<tr><td class="k">Memory</td><td>{{.Allocated}} allocated during request (all goroutines), {{.Heap}} heap in use, {{.Goroutines}} goroutines</td></tr>
+<tr><td class="k">Route</td><td>{{if .Route}}{{.Route}}{{else}}none{{end}}</td></tr>
+{{range .Params}}<tr><td class="k">:{{.Key}}</td><td>{{.Value}}</td></tr>{{end}}
+</table></details></section>
+<section><details><summary>Queries ({{len .Queries}}, {{.QueryTime}})</summary><table>
+{{range .Queries}}<tr><td class="t">{{.Duration}}</td><td><code>{{.SQL}}</code>{{if .Args}}<br>args: {{.Args}}{{end}}{{if .Error}}<br><span class="err">{{.Error}}</span>{{end}}</td></tr>
+{{else}}<tr><td colspan="2">none</td></tr>{{end}}
+{{if .Dropped}}<tr><td colspan="2">{{.Dropped}} more not shown</td></tr>{{end}}
+{{if .Unattributed}}<tr><td colspan="2">{{.Unattributed}} queries not attributed: they ran without a request context while other requests were profiled</td></tr>{{end}}
+</table></details></section>
+<section><details><summary>Templates ({{len .Templates}})</summary><table>
+{{range .Templates}}<tr><td class="t">{{.Duration}}</td><td>{{.Name}}{{if .Error}} <span class="err">{{.Error}}</span>{{end}}</td></tr>
+{{else}}<tr><td colspan="2">none</td></tr>{{end}}
+</table></details></section>
+<section><details><summary>Middleware ({{len .Middleware}})</summary><table>
+{{range $i, $m := .Middleware}}<tr><td class="t">{{$i}}</td><td>{{$m}}</td></tr>{{else}}<tr><td colspan="2">none</td></tr>{{end}}
+</table></details></section>
+<section><details><summary>Session</summary><table>
+{{range .Session}}<tr><td class="k">{{.Key}}</td><td>{{.Value}}</td></tr>{{else}}<tr><td colspan="2">none</td></tr>{{end}}
+</table></details></section>
+<section><details><summary>Request Headers</summary><table>
+{{range .Headers}}<tr><td class="k">{{.Key}}</td><td>{{.Value}}</td></tr>{{end}}
+</table></details></section>
+</details>
+</div>
+`))
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"log/slog"
+
+	"github.com/semutdev/goigniter/system/core"
+	"github.com/semutdev/goigniter/system/libraries/database"
+)
+
+// QueryCounterConfig holds configuration for the query counter middleware.
+type QueryCounterConfig struct {
+	// MaxRepeats is how often one statement may run per request before
+	// it is reported as a likely N+1 pattern (default: 5).
+	MaxRepeats int
+
+	// MaxQueries reports requests running more statements in total
+	// (default: 0, no limit).
+	MaxQueries int
+
+	// Logger receives the warnings (default: slog.Default()).
+	Logger *slog.Logger
+
+	// Skip bypasses the middleware for matching requests.
+	Skip func(c *core.Context) bool
+}
+
+// QueryCounter returns a middleware counting each request's queries and
+// warning about statements repeated more than 5 times.
+func QueryCounter() core.Middleware {
+	return QueryCounterWithConfig(QueryCounterConfig{})
+}
+
+// QueryCounterWithConfig returns a QueryCounter middleware with custom
+// config.
+//
+// Statements are counted by the hook from database.NewQueryCounterHook
+// when they run with the request context. Handlers can read the counts
+// with database.QueryStatsFromContext(c.Context()):
+//
+//	db.AddHook(database.NewQueryCounterHook())
+//	app.Use(middleware.QueryCounter())
+//
+//	// in handlers
+//	db.For(c).Table("posts").Get(&posts)
+func QueryCounterWithConfig(config QueryCounterConfig) core.Middleware {
+	if config.MaxRepeats == 0 {
+		config.MaxRepeats = 5
+	}
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			if config.Skip != nil && config.Skip(c) {
+				return next(c)
+			}
+
+			ctx, stats := database.WithQueryStats(c.Context())
+			c.SetContext(ctx)
+			err := next(c)
+
+			logger := config.Logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+			attrs := []any{"method", c.Method(), "path", c.Path(), "route", c.Route()}
+			if id := c.RequestID(); id != "" {
+				attrs = append(attrs, "request_id", id)
+			}
+
+			for _, q := range stats.Repeated(config.MaxRepeats + 1) {
+				logger.Warn("possible N+1 query", append([]any{"sql", q.SQL, "count", q.Count}, attrs...)...)
+			}
+			if config.MaxQueries > 0 && stats.Count() > config.MaxQueries {
+				logger.Warn("too many queries", append([]any{"count", stats.Count(), "duration", stats.Duration()}, attrs...)...)
+			}
+			return err
+		}
+	}
+}
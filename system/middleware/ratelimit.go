@@ -1,27 +1,79 @@
 package middleware
 
 import (
+	"encoding/json"
+	"log/slog"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/semutdev/goigniter/system/core"
 )
 
+// Rate limiting algorithms for RateLimitConfig.Algorithm.
+const (
+	// RateLimitFixedWindow counts requests in consecutive windows (default).
+	RateLimitFixedWindow = "fixed-window"
+	// RateLimitSlidingWindow keeps a log of request times over the last window.
+	RateLimitSlidingWindow = "sliding-window"
+	// RateLimitTokenBucket refills Max tokens evenly over Window, allowing bursts up to Max.
+	RateLimitTokenBucket = "token-bucket"
+)
+
+// RateLimitPolicy is a named limit. Counters are kept per policy name,
+// so routes or users with different policies don't share a budget.
+type RateLimitPolicy struct {
+	Name   string
+	Max    int
+	Window time.Duration
+}
+
 // RateLimitConfig holds configuration for the rate limiter.
 type RateLimitConfig struct {
 	Max     int
 	Window  time.Duration
 	KeyFunc func(c *core.Context) string
 	Message string
+
+	// Algorithm is one of the RateLimit* algorithms (default: RateLimitFixedWindow).
+	Algorithm string
+
+	// Store keeps the counters (default: a process-local memory store).
+	// Use a shared store when running several instances.
+	Store RateLimitStore
+
+	// Routes overrides Max/Window for route patterns, e.g. "/auth/dologin".
+	Routes map[string]RateLimitPolicy
+
+	// PolicyFunc picks a policy per request, e.g. by user plan. It is
+	// consulted before Routes; returning false falls through.
+	PolicyFunc func(c *core.Context) (RateLimitPolicy, bool)
+
+	// Skip bypasses the limiter for matching requests.
+	Skip func(c *core.Context) bool
+
+	// FailClosed rejects requests with 503 when the store fails.
+	// By default such requests are let through and the error is logged.
+	FailClosed bool
+}
+
+// RateLimitResult is the outcome of counting one request.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the limit is fully restored
+	RetryAfter time.Duration // until the next request is allowed, when denied
 }
 
 // DefaultRateLimitConfig returns a default rate limit configuration.
 func DefaultRateLimitConfig() RateLimitConfig {
 	return RateLimitConfig{
-		Max:     100,
-		Window:  time.Minute,
-		Message: "Too many requests",
+		Max:       100,
+		Window:    time.Minute,
+		Message:   "Too many requests",
+		Algorithm: RateLimitFixedWindow,
 		KeyFunc: func(c *core.Context) string {
 			return c.IP()
 		},
@@ -37,6 +89,9 @@ func RateLimit(max int, window time.Duration) core.Middleware {
 }
 
 // RateLimitWithConfig returns a rate limiting middleware with custom config.
+//
+// Every response carries RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers; rejected requests also get Retry-After.
 func RateLimitWithConfig(config RateLimitConfig) core.Middleware {
 	if config.KeyFunc == nil {
 		config.KeyFunc = func(c *core.Context) string {
@@ -46,14 +101,69 @@ func RateLimitWithConfig(config RateLimitConfig) core.Middleware {
 	if config.Message == "" {
 		config.Message = "Too many requests"
 	}
+	if config.Algorithm == "" {
+		config.Algorithm = RateLimitFixedWindow
+	}
+	take, ok := rateLimitAlgorithms[config.Algorithm]
+	if !ok {
+		panic("middleware: unknown rate limit algorithm " + strconv.Quote(config.Algorithm))
+	}
+	if config.Store == nil {
+		config.Store = NewRateLimitMemoryStore()
+	}
 
-	store := newRateLimitStore(config.Window)
+	defaultPolicy := RateLimitPolicy{Name: "default", Max: config.Max, Window: config.Window}
 
 	return func(next core.HandlerFunc) core.HandlerFunc {
 		return func(c *core.Context) error {
-			key := config.KeyFunc(c)
+			if config.Skip != nil && config.Skip(c) {
+				return next(c)
+			}
+
+			policy := defaultPolicy
+			if p, ok := config.Routes[c.Route()]; ok {
+				policy = p
+				if policy.Name == "" {
+					policy.Name = c.Route()
+				}
+			}
+			if config.PolicyFunc != nil {
+				if p, ok := config.PolicyFunc(c); ok {
+					policy = p
+					if policy.Name == "" {
+						policy.Name = strconv.Itoa(p.Max) + "/" + p.Window.String()
+					}
+				}
+			}
 
-			if !store.Allow(key, config.Max) {
+			key := "ratelimit:" + policy.Name + ":" + config.KeyFunc(c)
+			now := time.Now()
+
+			var result RateLimitResult
+			err := config.Store.Update(key, policy.Window, func(data []byte) []byte {
+				var state rateLimitState
+				if len(data) > 0 {
+					json.Unmarshal(data, &state)
+				}
+				result = take(&state, now, policy.Max, policy.Window)
+				data, _ = json.Marshal(state)
+				return data
+			})
+			if err != nil {
+				if config.FailClosed {
+					return core.NewHTTPError(http.StatusServiceUnavailable).WithInternal(err)
+				}
+				slog.Warn("rate limit store failed", "key", key, "error", err)
+				return next(c)
+			}
+
+			h := c.Response.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+
+			if !result.Allowed {
+				h.Set("Retry-After", ceilSeconds(result.RetryAfter))
 				return c.String(http.StatusTooManyRequests, config.Message)
 			}
 
@@ -62,57 +172,92 @@ func RateLimitWithConfig(config RateLimitConfig) core.Middleware {
 	}
 }
 
-type rateLimitStore struct {
-	mu      sync.RWMutex
-	entries map[string]*rateLimitEntry
-	window  time.Duration
+func ceilSeconds(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
 }
 
-type rateLimitEntry struct {
-	count    int
-	expireAt time.Time
+// rateLimitState is the per-key state, stored as JSON so any store
+// can hold it.
+type rateLimitState struct {
+	Count  int     `json:"c,omitempty"`
+	Tokens float64 `json:"t,omitempty"`
+	Start  int64   `json:"s,omitempty"` // window start or last refill, unix nanos
+	Log    []int64 `json:"l,omitempty"`
 }
 
-func newRateLimitStore(window time.Duration) *rateLimitStore {
-	store := &rateLimitStore{
-		entries: make(map[string]*rateLimitEntry),
-		window:  window,
-	}
-	go store.cleanup()
-	return store
+type rateLimitFunc func(s *rateLimitState, now time.Time, max int, window time.Duration) RateLimitResult
+
+var rateLimitAlgorithms = map[string]rateLimitFunc{
+	RateLimitFixedWindow:   fixedWindow,
+	RateLimitSlidingWindow: slidingWindow,
+	RateLimitTokenBucket:   tokenBucket,
 }
 
-func (s *rateLimitStore) Allow(key string, max int) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func fixedWindow(s *rateLimitState, now time.Time, max int, window time.Duration) RateLimitResult {
+	if s.Start == 0 || now.UnixNano() >= s.Start+int64(window) {
+		s.Start = now.UnixNano()
+		s.Count = 0
+	}
+	reset := time.Duration(s.Start + int64(window) - now.UnixNano())
 
-	now := time.Now()
-	entry, exists := s.entries[key]
+	r := RateLimitResult{Limit: max, Reset: reset}
+	if s.Count < max {
+		s.Count++
+		r.Allowed = true
+	} else {
+		r.RetryAfter = reset
+	}
+	r.Remaining = max - s.Count
+	return r
+}
 
-	if !exists || now.After(entry.expireAt) {
-		s.entries[key] = &rateLimitEntry{
-			count:    1,
-			expireAt: now.Add(s.window),
-		}
-		return true
+func slidingWindow(s *rateLimitState, now time.Time, max int, window time.Duration) RateLimitResult {
+	cutoff := now.UnixNano() - int64(window)
+	i := 0
+	for i < len(s.Log) && s.Log[i] <= cutoff {
+		i++
 	}
+	s.Log = s.Log[i:]
 
-	entry.count++
-	return entry.count <= max
+	r := RateLimitResult{Limit: max}
+	if len(s.Log) < max {
+		s.Log = append(s.Log, now.UnixNano())
+		r.Allowed = true
+	} else {
+		r.RetryAfter = time.Duration(s.Log[0] - cutoff)
+	}
+	r.Remaining = max - len(s.Log)
+	if len(s.Log) > 0 {
+		r.Reset = time.Duration(s.Log[len(s.Log)-1] - cutoff)
+	}
+	return r
 }
 
-func (s *rateLimitStore) cleanup() {
-	ticker := time.NewTicker(s.window)
-	defer ticker.Stop()
+func tokenBucket(s *rateLimitState, now time.Time, max int, window time.Duration) RateLimitResult {
+	// refill returns the time needed to gain n tokens.
+	refill := func(n float64) time.Duration {
+		return time.Duration(math.Ceil(n * float64(window) / float64(max)))
+	}
 
-	for range ticker.C {
-		s.mu.Lock()
-		now := time.Now()
-		for key, entry := range s.entries {
-			if now.After(entry.expireAt) {
-				delete(s.entries, key)
-			}
-		}
-		s.mu.Unlock()
+	if s.Start == 0 {
+		s.Tokens = float64(max)
+	} else {
+		gained := float64(now.UnixNano()-s.Start) * float64(max) / float64(window)
+		s.Tokens = math.Min(float64(max), s.Tokens+gained)
+	}
+	s.Start = now.UnixNano()
+
+	r := RateLimitResult{Limit: max}
+	if s.Tokens >= 1 {
+		s.Tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = refill(1 - s.Tokens)
 	}
+	r.Remaining = int(s.Tokens)
+	r.Reset = refill(float64(max) - s.Tokens)
+	return r
 }
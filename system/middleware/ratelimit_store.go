@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/semutdev/goigniter/system/libraries/cache"
+	"github.com/semutdev/goigniter/system/libraries/database"
+)
+
+// RateLimitStore persists rate limit state.
+type RateLimitStore interface {
+	// Update loads the state for key (nil if missing or expired), passes
+	// it to fn and stores the result for ttl. Stores must not run
+	// concurrent updates of the same key.
+	Update(key string, ttl time.Duration, fn func(state []byte) []byte) error
+}
+
+// NewRateLimitMemoryStore returns a process-local RateLimitStore.
+// Expired keys are swept lazily; it starts no goroutines.
+func NewRateLimitMemoryStore() RateLimitStore {
+	return NewRateLimitCacheStore(cache.NewMemory())
+}
+
+// NewRateLimitCacheStore returns a RateLimitStore backed by a cache.Store.
+// Updates are serialized within the process only; instances sharing the
+// cache may occasionally let a few extra requests through under
+// contention. Use NewRateLimitDBStore for strict shared limits.
+func NewRateLimitCacheStore(store cache.Store) RateLimitStore {
+	return &cacheRateLimitStore{store: store}
+}
+
+type cacheRateLimitStore struct {
+	mu    sync.Mutex
+	store cache.Store
+}
+
+func (s *cacheRateLimitStore) Update(key string, ttl time.Duration, fn func([]byte) []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, _, err := s.store.Get(key)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(key, fn(state), ttl)
+}
+
+// DBRateLimitStore keeps rate limit state in a database table, so
+// several instances share limits. Each update runs in a transaction that
+// first upserts the key's row, which locks it until the update commits.
+// On SQLite, set a busy timeout in the DSN, e.g. "?_pragma=busy_timeout(5000)",
+// so concurrent updates wait for each other instead of failing.
+type DBRateLimitStore struct {
+	db      *database.DB
+	table   string
+	updates atomic.Int64
+}
+
+// NewRateLimitDBStore returns a store using table (default: "rate_limits").
+// Call CreateTable once, or create the table with a migration.
+func NewRateLimitDBStore(db *database.DB, table string) *DBRateLimitStore {
+	if table == "" {
+		table = "rate_limits"
+	}
+	return &DBRateLimitStore{db: db, table: table}
+}
+
+// CreateTable creates the state table if it doesn't exist.
+func (s *DBRateLimitStore) CreateTable() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS ` + s.table + ` (
+		rate_key VARCHAR(255) NOT NULL PRIMARY KEY,
+		state TEXT NOT NULL,
+		expires_at BIGINT NOT NULL
+	)`)
+	return err
+}
+
+// Update implements RateLimitStore.
+func (s *DBRateLimitStore) Update(key string, ttl time.Duration, fn func([]byte) []byte) error {
+	now := time.Now()
+	err := s.db.Transaction(func(tx *database.DB) error {
+		// Create the row if it's missing, or write its key onto itself.
+		// Either way the row exists and is locked against concurrent
+		// updates, so first requests don't race to insert it either.
+		row := []map[string]any{{"rate_key": key, "state": "", "expires_at": int64(0)}}
+		if err := tx.Table(s.table).Upsert(row, []string{"rate_key"}, []string{"rate_key"}); err != nil {
+			return err
+		}
+
+		var current struct {
+			State     string `db:"state"`
+			ExpiresAt int64  `db:"expires_at"`
+		}
+		if err := tx.Table(s.table).Select("state", "expires_at").Where("rate_key", key).First(&current); err != nil {
+			return err
+		}
+
+		var state []byte
+		if current.ExpiresAt > now.UnixNano() {
+			state = []byte(current.State)
+		}
+		return tx.Table(s.table).Where("rate_key", key).Update(map[string]any{
+			"state":      string(fn(state)),
+			"expires_at": now.Add(ttl).UnixNano(),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// Sweep expired rows now and then instead of running a goroutine. The
+	// update has succeeded, so a failed sweep must not fail the request.
+	if s.updates.Add(1)%1000 == 0 {
+		if err := s.Cleanup(); err != nil {
+			slog.Default().Error("ratelimit: sweep expired keys", "error", err)
+		}
+	}
+	return nil
+}
+
+// Cleanup deletes expired rows.
+func (s *DBRateLimitStore) Cleanup() error {
+	return s.db.Table(s.table).Where("expires_at", "<", time.Now().UnixNano()).Delete()
+}
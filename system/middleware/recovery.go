@@ -5,10 +5,21 @@ import (
 	"log"
 	"net/http"
 	"runtime"
+	"runtime/debug"
 
 	"github.com/semutdev/goigniter/system/core"
 )
 
+// Recovery modes for RecoveryConfig.Mode.
+const (
+	// RecoveryModeAuto shows the debug page when the app runs in development.
+	RecoveryModeAuto = ""
+	// RecoveryModeDebug always renders the debug page.
+	RecoveryModeDebug = "debug"
+	// RecoveryModeProduction always hands a 500 error to the app ErrorHandler.
+	RecoveryModeProduction = "production"
+)
+
 // Recovery returns a middleware that recovers from panics.
 func Recovery() core.Middleware {
 	return RecoveryWithConfig(RecoveryConfig{})
@@ -20,6 +31,17 @@ type RecoveryConfig struct {
 	DisableStackAll   bool
 	DisablePrintStack bool
 	LogFunc           func(c *core.Context, err any, stack []byte)
+
+	// Mode selects what the client sees, see the RecoveryMode* constants.
+	// In development the response is an HTML page with the stack, source
+	// around each frame, request headers, route params and session data.
+	// Otherwise a generic 500 goes through the app ErrorHandler, so the
+	// panic value never leaks to clients.
+	Mode string
+
+	// SourceLines is the number of source lines shown around each frame
+	// on the debug page (default: 5).
+	SourceLines int
 }
 
 // RecoveryWithConfig returns a Recovery middleware with custom config.
@@ -27,23 +49,50 @@ func RecoveryWithConfig(config RecoveryConfig) core.Middleware {
 	if config.StackSize == 0 {
 		config.StackSize = 4 << 10
 	}
+	if config.SourceLines == 0 {
+		config.SourceLines = 5
+	}
 
 	return func(next core.HandlerFunc) core.HandlerFunc {
 		return func(c *core.Context) error {
 			defer func() {
 				if r := recover(); r != nil {
-					stack := make([]byte, config.StackSize)
-					length := runtime.Stack(stack, !config.DisableStackAll)
-					stack = stack[:length]
+					if r == http.ErrAbortHandler {
+						panic(r)
+					}
+
+					var stack []byte
+					var frames []stackFrame
+					if ps, ok := r.(*panicStack); ok {
+						// Re-raised by Timeout: report where it happened.
+						r, frames = ps.value, stackFrames(ps.pcs)
+						stack = ps.stack[:min(len(ps.stack), config.StackSize)]
+					} else {
+						stack = make([]byte, config.StackSize)
+						stack = stack[:runtime.Stack(stack, !config.DisableStackAll)]
+						frames = callerFrames(3)
+					}
 
 					if config.LogFunc != nil {
 						config.LogFunc(c, r, stack)
 					} else if !config.DisablePrintStack {
-						log.Printf("[PANIC RECOVER] %v\n%s", r, stack)
+						log.Printf("[PANIC RECOVER] %v%s\n%s", r, requestIDSuffix(c), stack)
+					}
+
+					// Appending to a half-written response would only corrupt it.
+					if c.Written() {
+						return
 					}
 
-					c.String(http.StatusInternalServerError,
-						fmt.Sprintf("Internal Server Error: %v", r))
+					debug := config.Mode == RecoveryModeDebug ||
+						(config.Mode == RecoveryModeAuto && c.IsDevelopment())
+					if debug {
+						renderDebugPage(c, r, frames, config.SourceLines)
+						return
+					}
+
+					c.Error(core.NewHTTPError(http.StatusInternalServerError).
+						WithInternal(fmt.Errorf("panic: %v", r)))
 				}
 			}()
 
@@ -51,3 +100,27 @@ func RecoveryWithConfig(config RecoveryConfig) core.Middleware {
 		}
 	}
 }
+
+// panicStack is a panic re-raised on another goroutine, as Timeout does
+// for its handler, carrying the stack of the goroutine that panicked.
+type panicStack struct {
+	value any
+	stack []byte // as printed by debug.Stack
+	pcs   []uintptr
+}
+
+// newPanicStack records the stack of a panic with value. Call it right
+// in the deferred function that recovered it.
+func newPanicStack(value any) *panicStack {
+	if ps, ok := value.(*panicStack); ok {
+		return ps
+	}
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	return &panicStack{value: value, stack: debug.Stack(), pcs: pcs[:n]}
+}
+
+// Error shows the original stack when the panic reaches net/http.
+func (p *panicStack) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/semutdev/goigniter/system/core"
+	"github.com/semutdev/goigniter/system/libraries/session"
+)
+
+// stackFrame is one frame of a recovered panic, with surrounding source.
+type stackFrame struct {
+	Function string
+	File     string
+	Line     int
+	Source   []sourceLine
+}
+
+type sourceLine struct {
+	Number  int
+	Code    string
+	Current bool
+}
+
+// callerFrames returns the goroutine's stack, skipping runtime internals.
+func callerFrames(skip int) []stackFrame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	return stackFrames(pcs[:n])
+}
+
+// stackFrames resolves pcs, skipping runtime internals.
+func stackFrames(pcs []uintptr) []stackFrame {
+	frames := runtime.CallersFrames(pcs)
+
+	var out []stackFrame
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") {
+			out = append(out, stackFrame{Function: f.Function, File: f.File, Line: f.Line})
+		}
+		if !more {
+			break
+		}
+	}
+	return out
+}
+
+// readSource returns the lines around line in file, or nil if unreadable.
+func readSource(file string, line, around int) []sourceLine {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var lines []sourceLine
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if n < line-around {
+			continue
+		}
+		if n > line+around {
+			break
+		}
+		lines = append(lines, sourceLine{Number: n, Code: scanner.Text(), Current: n == line})
+	}
+	return lines
+}
+
+type keyValue struct {
+	Key   string
+	Value string
+}
+
+func sortedPairs[V any](m map[string]V, format func(V) string) []keyValue {
+	pairs := make([]keyValue, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, keyValue{Key: k, Value: format(v)})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	return pairs
+}
+
+// renderDebugPage writes the development error page for a recovered panic.
+func renderDebugPage(c *core.Context, recovered any, frames []stackFrame, around int) {
+	for i := range frames {
+		frames[i].Source = readSource(frames[i].File, frames[i].Line, around)
+	}
+
+	var sess []keyValue
+	if s := session.Get(c); s != nil {
+		sess = sortedPairs(s.Data, func(v any) string { return fmt.Sprintf("%v", v) })
+	}
+
+	data := map[string]any{
+		"Panic":     fmt.Sprintf("%v", recovered),
+		"Type":      fmt.Sprintf("%T", recovered),
+		"Method":    c.Method(),
+		"URL":       c.Request.URL.String(),
+		"Route":     c.Route(),
+		"RequestID": c.RequestID(),
+		"Frames":    frames,
+		"Headers":   sortedPairs(c.Request.Header, func(v []string) string { return strings.Join(v, ", ") }),
+		"Params":    sortedPairs(c.Params(), func(v string) string { return v }),
+		"Session":   sess,
+	}
+
+	c.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response.Header().Set("Cache-Control", "no-store")
+	c.Response.WriteHeader(http.StatusInternalServerError)
+	if err := debugPageTemplate.Execute(c.Response, data); err != nil {
+		fmt.Fprintf(c.Response, "\n<pre>%s</pre>", template.HTMLEscapeString(err.Error()))
+	}
+}
+
+var debugPageTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Panic: {{.Panic}}</title>
+<style>
+body{font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;margin:0;background:#f5f5f5;color:#222}
+header{background:#c0392b;color:#fff;padding:20px 30px}
+header h1{margin:0 0 6px;font-size:20px;word-break:break-word}
+header p{margin:0;opacity:.85;font-size:13px}
+section{background:#fff;margin:20px 30px;padding:16px 20px;border-radius:4px;box-shadow:0 1px 2px rgba(0,0,0,.1)}
+h2{font-size:15px;margin:0 0 12px}
+.frame{margin-bottom:14px}
+.fn{font-weight:600;font-size:13px}
+.loc{color:#777;font-size:12px;margin-bottom:4px}
+pre{margin:0;background:#2d2d2d;color:#ccc;font-size:12px;overflow-x:auto;padding:6px 0}
+pre span{display:block;padding:0 10px}
+pre span.cur{background:#5a2a27;color:#fff}
+table{border-collapse:collapse;width:100%;font-size:13px}
+td{border-top:1px solid #eee;padding:4px 8px;vertical-align:top;word-break:break-all}
+td:first-child{width:25%;font-weight:600}
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Type}}: {{.Panic}}</h1>
+<p>{{.Method}} {{.URL}}{{if .Route}} &middot; route {{.Route}}{{end}}{{if .RequestID}} &middot; request {{.RequestID}}{{end}}</p>
+</header>
+<section>
+<h2>Stack</h2>
+{{range .Frames}}<div class="frame">
+<div class="fn">{{.Function}}</div>
+<div class="loc">{{.File}}:{{.Line}}</div>
+{{if .Source}}<pre>{{range .Source}}<span{{if .Current}} class="cur"{{end}}>{{printf "%4d" .Number}}  {{.Code}}</span>{{end}}</pre>{{end}}
+</div>
+{{end}}</section>
+<section>
+<h2>Route Params</h2>
+<table>{{range .Params}}<tr><td>{{.Key}}</td><td>{{.Value}}</td></tr>{{else}}<tr><td colspan="2">none</td></tr>{{end}}</table>
+</section>
+<section>
+<h2>Session</h2>
+<table>{{range .Session}}<tr><td>{{.Key}}</td><td>{{.Value}}</td></tr>{{else}}<tr><td colspan="2">none</td></tr>{{end}}</table>
+</section>
+<section>
+<h2>Request Headers</h2>
+<table>{{range .Headers}}<tr><td>{{.Key}}</td><td>{{.Value}}</td></tr>{{end}}</table>
+</section>
+</body>
+</html>
+`))
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/semutdev/goigniter/system/core"
+)
+
+// RequestIDConfig holds configuration for the request ID middleware.
+type RequestIDConfig struct {
+	// Header is the request/response header carrying the ID (default: "X-Request-ID").
+	Header string
+
+	// Generator creates a new ID when the request doesn't carry a usable one.
+	Generator func() string
+
+	// IgnoreIncoming always generates a fresh ID instead of trusting the client.
+	IgnoreIncoming bool
+}
+
+// DefaultRequestIDConfig returns a default request ID configuration.
+func DefaultRequestIDConfig() RequestIDConfig {
+	return RequestIDConfig{
+		Header:    "X-Request-ID",
+		Generator: generateRequestID,
+	}
+}
+
+// RequestID returns a middleware that assigns every request an ID.
+// An incoming X-Request-ID is reused so IDs stay stable across services.
+// The ID is available via c.RequestID(), core.RequestIDFromContext and
+// is echoed back in the response header.
+func RequestID() core.Middleware {
+	return RequestIDWithConfig(DefaultRequestIDConfig())
+}
+
+// RequestIDWithConfig returns a RequestID middleware with custom config.
+func RequestIDWithConfig(config RequestIDConfig) core.Middleware {
+	if config.Header == "" {
+		config.Header = "X-Request-ID"
+	}
+	if config.Generator == nil {
+		config.Generator = generateRequestID
+	}
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			id := ""
+			if !config.IgnoreIncoming {
+				id = c.Header(config.Header)
+			}
+			if !validRequestID(id) {
+				id = config.Generator()
+			}
+
+			c.Set(core.RequestIDKey, id)
+			c.SetContext(core.WithRequestID(c.Context(), id))
+			c.SetHeader(config.Header, id)
+
+			return next(c)
+		}
+	}
+}
+
+// validRequestID rejects empty, oversized or non-printable client IDs so
+// they can't be used to inject content into logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// generateRequestID generates a random 128-bit hex ID.
+func generateRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
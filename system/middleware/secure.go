@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/semutdev/goigniter/system/core"
+)
+
+// CSPNonceKey is the key under which the per-request CSP nonce is kept in
+// the request store and the view data ({{.csp_nonce}}).
+const CSPNonceKey = "csp_nonce"
+
+// CSPNonceSource is a CSP source expression that Secure replaces with the
+// per-request nonce, e.g. NewCSP().ScriptSrc("'self'", CSPNonceSource).
+const CSPNonceSource = "'nonce'"
+
+// SecureConfig holds configuration for the security headers middleware.
+// Empty fields don't emit their header.
+type SecureConfig struct {
+	// HSTSMaxAge is the Strict-Transport-Security max-age in seconds.
+	// The header is only sent on HTTPS requests (TLS or X-Forwarded-Proto).
+	HSTSMaxAge            int
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	XFrameOptions       string // e.g. "DENY" or "SAMEORIGIN"
+	XContentTypeOptions string // "nosniff"
+	ReferrerPolicy      string // e.g. "strict-origin-when-cross-origin"
+	PermissionsPolicy   string // e.g. "camera=(), microphone=()"
+
+	CrossOriginOpenerPolicy string // e.g. "same-origin"
+
+	// ContentSecurityPolicy is sent as Content-Security-Policy.
+	ContentSecurityPolicy *CSP
+
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only.
+	CSPReportOnly bool
+}
+
+// DefaultSecureConfig returns a recommended security headers configuration.
+// It has no Content-Security-Policy, since a useful one is app specific.
+func DefaultSecureConfig() SecureConfig {
+	return SecureConfig{
+		HSTSMaxAge:              31536000,
+		HSTSIncludeSubdomains:   true,
+		XFrameOptions:           "SAMEORIGIN",
+		XContentTypeOptions:     "nosniff",
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+		CrossOriginOpenerPolicy: "same-origin",
+	}
+}
+
+// Secure returns a middleware that sets security response headers.
+//
+// When the CSP uses CSPNonceSource, a fresh nonce is generated for every
+// request and exposed to templates as {{.csp_nonce}}:
+//
+//	<script nonce="{{.csp_nonce}}">...</script>
+func Secure(config SecureConfig) core.Middleware {
+	hsts := ""
+	if config.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(config.HSTSMaxAge)
+		if config.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if config.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if config.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	useNonce := config.ContentSecurityPolicy != nil && config.ContentSecurityPolicy.usesNonce()
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			h := c.Response.Header()
+
+			if hsts != "" && isHTTPS(c) {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			if config.XFrameOptions != "" {
+				h.Set("X-Frame-Options", config.XFrameOptions)
+			}
+			if config.XContentTypeOptions != "" {
+				h.Set("X-Content-Type-Options", config.XContentTypeOptions)
+			}
+			if config.ReferrerPolicy != "" {
+				h.Set("Referrer-Policy", config.ReferrerPolicy)
+			}
+			if config.PermissionsPolicy != "" {
+				h.Set("Permissions-Policy", config.PermissionsPolicy)
+			}
+			if config.CrossOriginOpenerPolicy != "" {
+				h.Set("Cross-Origin-Opener-Policy", config.CrossOriginOpenerPolicy)
+			}
+
+			if config.ContentSecurityPolicy != nil {
+				nonce := ""
+				if useNonce {
+					nonce = generateNonce()
+					c.Set(CSPNonceKey, nonce)
+					c.SetViewData(CSPNonceKey, nonce)
+				}
+				h.Set(cspHeader, config.ContentSecurityPolicy.Build(nonce))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// CSPNonce returns the CSP nonce of the current request, or "".
+func CSPNonce(c *core.Context) string {
+	return c.GetString(CSPNonceKey)
+}
+
+func isHTTPS(c *core.Context) bool {
+	return c.Request.TLS != nil || strings.EqualFold(c.Header("X-Forwarded-Proto"), "https")
+}
+
+func generateNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+// CSP builds a Content-Security-Policy header value.
+//
+//	csp := middleware.NewCSP().
+//		DefaultSrc("'self'").
+//		ScriptSrc("'self'", middleware.CSPNonceSource, "https://unpkg.com").
+//		ObjectSrc("'none'")
+type CSP struct {
+	directives []cspDirective
+}
+
+type cspDirective struct {
+	name    string
+	sources []string
+}
+
+// NewCSP creates an empty policy.
+func NewCSP() *CSP {
+	return &CSP{}
+}
+
+// Add appends sources to a directive, creating it if needed.
+// Directives without sources (e.g. "upgrade-insecure-requests") are allowed.
+func (p *CSP) Add(directive string, sources ...string) *CSP {
+	for i := range p.directives {
+		if p.directives[i].name == directive {
+			p.directives[i].sources = append(p.directives[i].sources, sources...)
+			return p
+		}
+	}
+	p.directives = append(p.directives, cspDirective{name: directive, sources: sources})
+	return p
+}
+
+// DefaultSrc adds sources to default-src.
+func (p *CSP) DefaultSrc(sources ...string) *CSP { return p.Add("default-src", sources...) }
+
+// ScriptSrc adds sources to script-src.
+func (p *CSP) ScriptSrc(sources ...string) *CSP { return p.Add("script-src", sources...) }
+
+// StyleSrc adds sources to style-src.
+func (p *CSP) StyleSrc(sources ...string) *CSP { return p.Add("style-src", sources...) }
+
+// ImgSrc adds sources to img-src.
+func (p *CSP) ImgSrc(sources ...string) *CSP { return p.Add("img-src", sources...) }
+
+// ConnectSrc adds sources to connect-src.
+func (p *CSP) ConnectSrc(sources ...string) *CSP { return p.Add("connect-src", sources...) }
+
+// FontSrc adds sources to font-src.
+func (p *CSP) FontSrc(sources ...string) *CSP { return p.Add("font-src", sources...) }
+
+// ObjectSrc adds sources to object-src.
+func (p *CSP) ObjectSrc(sources ...string) *CSP { return p.Add("object-src", sources...) }
+
+// FrameAncestors adds sources to frame-ancestors.
+func (p *CSP) FrameAncestors(sources ...string) *CSP { return p.Add("frame-ancestors", sources...) }
+
+// BaseURI adds sources to base-uri.
+func (p *CSP) BaseURI(sources ...string) *CSP { return p.Add("base-uri", sources...) }
+
+// FormAction adds sources to form-action.
+func (p *CSP) FormAction(sources ...string) *CSP { return p.Add("form-action", sources...) }
+
+// ReportURI sets report-uri.
+func (p *CSP) ReportURI(uri string) *CSP { return p.Add("report-uri", uri) }
+
+// Build renders the policy, substituting CSPNonceSource with nonce.
+func (p *CSP) Build(nonce string) string {
+	parts := make([]string, 0, len(p.directives))
+	for _, d := range p.directives {
+		sources := make([]string, 0, len(d.sources))
+		for _, src := range d.sources {
+			if src == CSPNonceSource {
+				if nonce == "" {
+					continue
+				}
+				src = "'nonce-" + nonce + "'"
+			}
+			sources = append(sources, src)
+		}
+		if len(sources) == 0 {
+			parts = append(parts, d.name)
+			continue
+		}
+		parts = append(parts, d.name+" "+strings.Join(sources, " "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// String renders the policy without a nonce.
+func (p *CSP) String() string {
+	return p.Build("")
+}
+
+func (p *CSP) usesNonce() bool {
+	for _, d := range p.directives {
+		for _, src := range d.sources {
+			if src == CSPNonceSource {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/semutdev/goigniter/system/core"
+)
+
+// TimeoutConfig holds configuration for the timeout middleware.
+type TimeoutConfig struct {
+	Timeout time.Duration
+	Message string
+}
+
+// Timeout returns a middleware that cancels the request context after d
+// and responds with 503 Service Unavailable if the handler hasn't finished.
+func Timeout(d time.Duration) core.Middleware {
+	return TimeoutWithConfig(TimeoutConfig{Timeout: d})
+}
+
+// TimeoutWithConfig returns a Timeout middleware with custom config.
+//
+// The handler runs in its own goroutine on a copy of the context (see
+// core.Context.Copy) and its output is buffered, so nothing reaches the
+// client until it returns. Handlers should watch c.Context().Done() and
+// stop work early; whatever they write after the deadline is discarded.
+// Values stored with c.Set inside the handler are not visible to outer
+// middleware. A panic in the handler is raised again on the request's
+// goroutine; Recovery still reports the handler's stack.
+func TimeoutWithConfig(config TimeoutConfig) core.Middleware {
+	if config.Message == "" {
+		config.Message = "Service Unavailable"
+	}
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			if config.Timeout <= 0 {
+				return next(c)
+			}
+
+			ctx, cancel := context.WithTimeout(c.Context(), config.Timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			cc := c.Copy()
+			cc.SetContext(ctx)
+			cc.Response = tw
+
+			done := make(chan error, 1)
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						if r != http.ErrAbortHandler {
+							r = newPanicStack(r)
+						}
+						panicked <- r
+					}
+				}()
+				done <- next(cc)
+			}()
+
+			select {
+			case r := <-panicked:
+				panic(r)
+			case err := <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				if err != nil && !tw.wroteHeader && tw.buf.Len() == 0 {
+					return err
+				}
+				dst := c.Response.Header()
+				for k, v := range tw.header {
+					dst[k] = v
+				}
+				if !tw.wroteHeader {
+					tw.code = http.StatusOK
+				}
+				c.Response.WriteHeader(tw.code)
+				if _, werr := c.Response.Write(tw.buf.Bytes()); werr != nil && err == nil {
+					err = werr
+				}
+				return err
+			case <-ctx.Done():
+				tw.mu.Lock()
+				tw.timedOut = true
+				tw.mu.Unlock()
+				if ctx.Err() == context.DeadlineExceeded {
+					return c.String(http.StatusServiceUnavailable, config.Message)
+				}
+				// Client went away; there is nobody left to answer.
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// timeoutWriter buffers a handler's response until it completes.
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.code = http.StatusOK
+		tw.wroteHeader = true
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.code = code
+	tw.wroteHeader = true
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/semutdev/goigniter/system/core"
+	"github.com/semutdev/goigniter/system/libraries/tracing"
+)
+
+// TracingConfig holds configuration for the tracing middleware.
+type TracingConfig struct {
+	// Tracer records the spans (default: tracing.Default()). Without a
+	// tracer the middleware does nothing.
+	Tracer *tracing.Tracer
+
+	// Skip bypasses the middleware, e.g. for health checks.
+	Skip func(c *core.Context) bool
+}
+
+// traceRenders registers the hook recording template renders as spans.
+var traceRenders sync.Once
+
+// Tracing returns a middleware tracing requests with tracing.Default().
+func Tracing() core.Middleware {
+	return TracingWithConfig(TracingConfig{})
+}
+
+// TracingWithConfig returns a Tracing middleware with custom config.
+//
+// Each request gets a server span named after its method and route
+// pattern, continuing the trace from the incoming traceparent header.
+// The span is stored in c.Context(), so queries run with db.For(c),
+// templates rendered with c.View and requests sent through
+// tracing.Transport become its children. The response carries the
+// traceparent header for correlation:
+//
+//	tracer := tracing.NewTracer(tracing.Config{ServiceName: "shop", Exporter: tracing.NewStdoutExporter()})
+//	tracing.SetTracer(tracer)
+//	app.Use(middleware.Tracing())
+func TracingWithConfig(config TracingConfig) core.Middleware {
+	traceRenders.Do(func() {
+		core.OnRender(func(ctx context.Context, e core.RenderEvent) {
+			if !tracing.SpanContextFromContext(ctx).IsValid() {
+				return
+			}
+			_, span := tracing.StartAt(ctx, "render "+e.Name, tracing.SpanKindInternal, e.Start)
+			span.SetAttribute("template.name", e.Name)
+			span.RecordError(e.Err)
+			span.EndAt(e.Start.Add(e.Duration))
+		})
+	})
+
+	return func(next core.HandlerFunc) core.HandlerFunc {
+		return func(c *core.Context) error {
+			tracer := config.Tracer
+			if tracer == nil {
+				tracer = tracing.Default()
+			}
+			if tracer == nil || (config.Skip != nil && config.Skip(c)) {
+				return next(c)
+			}
+
+			name := c.Method()
+			if route := c.Route(); route != "" {
+				name += " " + route
+			}
+
+			ctx := tracing.Extract(c.Context(), c.Request.Header)
+			ctx, span := tracer.Start(ctx, name, tracing.SpanKindServer)
+			defer span.End()
+
+			span.SetAttribute("http.request.method", c.Method())
+			span.SetAttribute("url.path", c.Path())
+			span.SetAttribute("client.address", c.IP())
+			if route := c.Route(); route != "" {
+				span.SetAttribute("http.route", route)
+			}
+			if ua := c.Header("User-Agent"); ua != "" {
+				span.SetAttribute("user_agent.original", ua)
+			}
+
+			c.SetContext(ctx)
+			tracing.Inject(ctx, c.Response.Header())
+
+			err := next(c)
+
+			status := c.ResultStatus(err)
+			span.SetAttribute("http.response.status_code", status)
+			if err != nil {
+				span.RecordError(err)
+			} else if status >= 500 {
+				span.SetStatus(tracing.StatusError, http.StatusText(status))
+			}
+			return err
+		}
+	}
+}